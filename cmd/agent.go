@@ -0,0 +1,158 @@
+package cmd
+
+import (
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/open-zhy/secm/pkg/agent"
+	"github.com/open-zhy/secm/pkg/errors"
+	"github.com/open-zhy/secm/pkg/screen"
+	"github.com/open-zhy/secm/pkg/workspace"
+	"github.com/spf13/cobra"
+)
+
+var (
+	agentSocket string
+	agentTTL    time.Duration
+)
+
+var agentCmd = &cobra.Command{
+	Use:   "agent",
+	Short: "Run an agent holding the unlocked identity key",
+	Long: `Run secm-agent in the foreground. It loads the identity key once, prompting for its passphrase
+if it is protected, and unwraps the data keys of secrets for the commands run with
+` + agent.SockEnv + ` pointing to its socket, the private key never leaves the agent.
+The key is dropped after --ttl without use, or with 'secm agent lock', and loaded again
+with 'secm agent unlock'. The socket is only accessible to the current user.`,
+	Args: cobra.NoArgs,
+	RunE: runAgent,
+}
+
+var agentLockCmd = &cobra.Command{
+	Use:   "lock",
+	Short: "Make the agent drop the identity key",
+	Args:  cobra.NoArgs,
+	RunE:  runAgentLock,
+}
+
+var agentUnlockCmd = &cobra.Command{
+	Use:   "unlock",
+	Short: "Make the agent load the identity key again",
+	Long: `Make the agent load the identity key again, the passphrase of a protected key is read
+from --passphrase-file, ` + PassphraseEnv + ` or prompted.`,
+	Args: cobra.NoArgs,
+	RunE: runAgentUnlock,
+}
+
+func init() {
+	agentCmd.PersistentFlags().StringVar(&agentSocket, "socket", "", "Socket path, defaults to "+agent.SockEnv+" or agent.sock in the workspace")
+	agentCmd.Flags().DurationVar(&agentTTL, "ttl", 15*time.Minute, "Drop the identity key after this idle time, 0 keeps it until locked")
+	agentCmd.AddCommand(agentLockCmd)
+	agentCmd.AddCommand(agentUnlockCmd)
+	rootCmd.AddCommand(agentCmd)
+}
+
+// agentSocketPath returns the socket given with --socket, in the environment,
+// or the default one of the workspace
+func agentSocketPath(ws *workspace.Workspace) string {
+	if agentSocket != "" {
+		return agentSocket
+	}
+	if socket := os.Getenv(agent.SockEnv); socket != "" {
+		return socket
+	}
+	return filepath.Join(ws.RootDir, agent.DefaultSocketName)
+}
+
+func runAgent(cmd *cobra.Command, args []string) error {
+	ws, err := workspace.Load(profile)
+	if err != nil {
+		return errors.Wrapf(err, "failed to load workspace")
+	}
+
+	identity, err := ws.LoadKey()
+	if err != nil {
+		return err
+	}
+
+	server, err := agent.NewServer(ws.KeyPath, identity, agentTTL)
+	if err != nil {
+		return err
+	}
+	defer server.Close()
+
+	socket := agentSocketPath(ws)
+	l, err := agent.Listen(socket)
+	if err != nil {
+		return err
+	}
+
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-sigCh
+		l.Close()
+	}()
+
+	screen.Printf("%s=%s; export %s;\n", agent.SockEnv, socket, agent.SockEnv)
+	screen.Infof("Agent listening on %s\n", socket)
+
+	return server.Serve(l)
+}
+
+func dialAgent() (*agent.Client, error) {
+	ws, err := workspace.Load(profile)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to load workspace")
+	}
+
+	return agent.Dial(agentSocketPath(ws))
+}
+
+func runAgentLock(cmd *cobra.Command, args []string) error {
+	client, err := dialAgent()
+	if err != nil {
+		return err
+	}
+
+	if err := client.Lock(); err != nil {
+		return errors.Wrapf(err, "failed to lock agent")
+	}
+
+	screen.Successf("Agent locked\n")
+	return nil
+}
+
+func runAgentUnlock(cmd *cobra.Command, args []string) error {
+	ws, err := workspace.Load(profile)
+	if err != nil {
+		return errors.Wrapf(err, "failed to load workspace")
+	}
+
+	client, err := agent.Dial(agentSocketPath(ws))
+	if err != nil {
+		return err
+	}
+
+	var passphrase []byte
+	protected, err := ws.IsKeyProtected()
+	if err != nil {
+		return err
+	}
+	if protected {
+		passphrase, err = readPassphrase(ws.KeyPath)
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := client.Unlock(passphrase); err != nil {
+		return errors.Wrapf(err, "failed to unlock agent")
+	}
+
+	screen.Successf("Agent unlocked\n")
+	return nil
+}
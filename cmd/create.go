@@ -1,9 +1,12 @@
 package cmd
 
 import (
+	"crypto/hmac"
+	"io"
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/open-zhy/secm/pkg/crypto"
@@ -21,13 +24,27 @@ var (
 	secretType   string
 	secretTags   string
 	secretFormat string
+	recipients   []string
+
+	secretPassphrase bool
+	secretCipher     string
+	secretDedup      bool
+	secretExpires    time.Duration
+	secretMaxReads   int
 )
 
 var createCmd = &cobra.Command{
 	Use:   "create [file]",
 	Short: "Create a new secret from a file",
 	Long: `Create a new secret by encrypting the contents of a file and storing it in the secm workspace.
-The file will be encrypted using the RSA identity key and stored with a unique hash identifier.`,
+The file will be encrypted using the identity key and stored under a new random identifier.
+With --dedup, a secret holding the same content is reused instead, contents are compared by
+their HMAC keyed with a random key encrypted to the identity, so that the ID leaks nothing about them.
+Additional recipients given with --recipient are able to decrypt the same secret with their own identity.
+With --passphrase, the secret is encrypted with a key derived from a passphrase (scrypt) instead of the
+identity, anyone knowing the passphrase can decrypt it and the identity key cannot.
+With --expires, the secret cannot be read after the given duration, and with --max-reads it is deleted
+by its last read, 'secm purge --expired' removes expired secrets.`,
 	Args: cobra.ExactArgs(1),
 	RunE: runCreate,
 }
@@ -38,45 +55,119 @@ func init() {
 	createCmd.Flags().StringVarP(&secretType, "type", "t", "", "Type of secret (e.g., api-key, certificate)")
 	createCmd.Flags().StringVar(&secretTags, "tags", "", "Comma-separated list of tags")
 	createCmd.Flags().StringVarP(&secretFormat, "format", "f", "text", "Format of the secret (text, json, binary)")
+	createCmd.Flags().StringArrayVarP(&recipients, "recipient", "R", nil, "Public key or certificate file of an additional recipient, can be repeated")
+	createCmd.Flags().BoolVar(&secretPassphrase, "passphrase", false, "Encrypt the secret with a passphrase instead of the identity key")
+	createCmd.Flags().StringVar(&secretCipher, "cipher", "", "Cipher of the secret data (aes-256-gcm, chacha20-poly1305, xchacha20-poly1305), defaults to the profile cipher")
+	createCmd.Flags().BoolVar(&secretDedup, "dedup", false, "Reuse the secret holding the same content instead of creating a new one")
+	createCmd.Flags().DurationVar(&secretExpires, "expires", 0, "Duration after which the secret expires (e.g., 30m, 72h)")
+	createCmd.Flags().IntVar(&secretMaxReads, "max-reads", 0, "Number of reads after which the secret is deleted")
+	addSecretPassphraseFlag(createCmd)
+	addExpectFingerprintFlag(createCmd)
 
 	createCmd.MarkFlagRequired("name")
+	createCmd.MarkFlagsMutuallyExclusive("passphrase", "recipient")
+	// an existing secret is returned as is, without the recipients or passphrase asked for
+	createCmd.MarkFlagsMutuallyExclusive("dedup", "recipient")
+	createCmd.MarkFlagsMutuallyExclusive("dedup", "passphrase")
+	createCmd.MarkFlagsMutuallyExclusive("dedup", "expires")
+	createCmd.MarkFlagsMutuallyExclusive("dedup", "max-reads")
 	rootCmd.AddCommand(createCmd)
 }
 
 func runCreate(cmd *cobra.Command, args []string) error {
 	filePath := args[0]
 
+	if secretExpires < 0 {
+		return errors.New("invalid expiry: %s", secretExpires)
+	}
+	if secretMaxReads < 0 {
+		return errors.New("invalid number of reads: %d", secretMaxReads)
+	}
+
 	// Load workspace
 	ws, err := workspace.Load(profile)
 	if err != nil {
 		return errors.Wrapf(err, "failed to load workspace")
 	}
 
-	// Read the input file
-	data, err := os.ReadFile(filePath)
+	lock, err := ws.LockWrites()
 	if err != nil {
-		return errors.Wrapf(err, "failed to read input file")
+		return err
 	}
+	defer lock.Close()
 
-	// create uuid of the file
-	secretId := uuid.NewSHA1(uuid.NameSpaceDNS, data).String()
-
-	identity, err := id.LoadKeyFile(ws.KeyPath)
+	c, err := dataCipher(ws, secretCipher)
 	if err != nil {
-		return errors.Wrapf(err, "failed to load identity")
+		return err
 	}
 
-	// Encrypt the data using hybrid encryption
-	encrypted, err := crypto.EncryptData(identity.PublicKey(), data)
+	var encrypters []id.Encrypter
+	var subjects []string
+	if secretPassphrase {
+		passphrase, err := readNewPassphrase(secretPassphraseFile, "--secret-passphrase-file", SecretPassphraseEnv)
+		if err != nil {
+			return err
+		}
+
+		recipient, err := id.NewScryptRecipient(passphrase)
+		if err != nil {
+			return err
+		}
+		encrypters = []id.Encrypter{recipient}
+	} else {
+		self, err := ws.LoadPublicKey()
+		if err != nil {
+			return errors.Wrapf(err, "failed to load identity")
+		}
+
+		encrypters, subjects, err = loadRecipients(ws, self, recipients)
+		if err != nil {
+			return err
+		}
+	}
+
+	s := newSecretFromFlags(secretFormat)
+	if secretExpires > 0 {
+		s.ExpiresAt = s.CreatedAt.Add(secretExpires)
+	}
+	s.MaxReads = secretMaxReads
+	addRecipientSubjects(s, subjects...)
+	open := func() (io.ReadCloser, error) {
+		f, err := os.Open(filePath)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to read input file")
+		}
+		return f, nil
+	}
+
+	secretId, secretPath, err := storeSecret(ws, s, open, c, encrypters, secretDedup)
 	if err != nil {
-		return errors.Wrapf(err, "failed to encrypt data")
+		return err
+	}
+	if secretPath == "" {
+		screen.Infof("Secret with the same content already exists with ID: %s\n", secretId)
+		return nil
 	}
 
-	// Create secret with metadata
-	s := secret.New(secretName, encrypted)
+	screen.Successf("Created secret '%s' with ID: %s\n", secretName, secretId)
+	screen.Successf("Stored at: %s\n", secretPath)
+	return nil
+}
+
+// dataCipher returns the named cipher, or the default cipher of the profile when name is empty
+func dataCipher(ws *workspace.Workspace, name string) (crypto.Cipher, error) {
+	if name == "" {
+		return ws.DefaultCipher()
+	}
+	return crypto.ParseCipher(name)
+}
+
+// newSecretFromFlags creates the secret described by the metadata flags
+func newSecretFromFlags(format string) *secret.Secret {
+	s := secret.New(secretName, nil)
 	s.Description = secretDesc
 	s.Type = secretType
-	s.Format = secretFormat
+	s.Format = format
 	if secretTags != "" {
 		s.Tags = strings.Split(secretTags, ",")
 		// Trim spaces from tags
@@ -85,13 +176,124 @@ func runCreate(cmd *cobra.Command, args []string) error {
 		}
 	}
 
+	return s
+}
+
+// storeSecret encrypts the content returned by open with the cipher into the workspace under
+// a new random ID, then signs and saves the secret. The content is encrypted as a stream, so it
+// is never held in memory. With dedup, open is called twice, the content is first hashed to find
+// a secret holding the same content, whose ID is returned with an empty path instead.
+func storeSecret(ws *workspace.Workspace, s *secret.Secret, open func() (io.ReadCloser, error), c crypto.Cipher, encrypters []id.Encrypter, dedup bool) (string, string, error) {
+	if dedup {
+		src, err := open()
+		if err != nil {
+			return "", "", err
+		}
+		mac, err := ws.ContentMAC(src)
+		src.Close()
+		if err != nil {
+			return "", "", errors.Wrapf(err, "failed to hash content")
+		}
+
+		existing, err := findSecretByContentMAC(ws, mac)
+		if err != nil || existing != "" {
+			return existing, "", err
+		}
+		s.ContentMAC = mac
+	}
+
+	// random and time ordered, an ID tells nothing about the content
+	u, err := uuid.NewV7()
+	if err != nil {
+		return "", "", errors.Wrapf(err, "failed to generate secret ID")
+	}
+	secretId := u.String()
+
+	// the ID and metadata are bound to the ciphertext
+	ad, err := s.AssociatedData(secretId)
+	if err != nil {
+		return "", "", err
+	}
+
+	// Encrypt the content as a stream into a staging file, then move it in place
+	src, err := open()
+	if err != nil {
+		return "", "", err
+	}
+	defer src.Close()
+
+	staged, size, err := ws.StageBlob(src, c, encrypters, ad)
+	if err != nil {
+		return "", "", errors.Wrapf(err, "failed to encrypt data")
+	}
+	defer os.Remove(staged)
+
+	s.Size = size
+	s.Blob = workspace.BlobName(secretId, 1)
+	if err := os.Rename(staged, ws.BlobPath(s.Blob)); err != nil {
+		return "", "", errors.Wrapf(err, "failed to store encrypted data")
+	}
+
+	// Sign the ciphertext and metadata
+	signingKey, created, err := ws.EnsureSigningKey()
+	if err != nil {
+		return "", "", errors.Wrapf(err, "failed to load signing key")
+	}
+	if created {
+		screen.Infof("Generated signing key at %s\n", ws.SigningKeyPath)
+	}
+
+	if err := ws.SignSecret(secretId, s, signingKey); err != nil {
+		return "", "", errors.Wrapf(err, "failed to sign secret")
+	}
+
 	// Save the secret as YAML
 	secretPath := filepath.Join(ws.SecretsDir, secretId+".yml")
 	if err := s.Save(secretPath); err != nil {
-		return errors.Wrapf(err, "failed to save secret")
+		return "", "", errors.Wrapf(err, "failed to save secret")
 	}
 
-	screen.Successf("Created secret '%s' with ID: %s\n", secretName, secretId)
-	screen.Successf("Stored at: %s\n", secretPath)
-	return nil
+	return secretId, secretPath, nil
+}
+
+// loadRecipients returns the workspace public key followed by the public keys
+// read from the given files, and the subjects of those given as certificates
+func loadRecipients(ws *workspace.Workspace, self id.PublicKey, paths []string) ([]id.Encrypter, []string, error) {
+	encrypters := []id.Encrypter{self}
+	var subjects []string
+	for _, path := range paths {
+		pub, subject, err := loadRecipientKey(ws, path)
+		if err != nil {
+			return nil, nil, err
+		}
+		encrypters = append(encrypters, pub)
+		if subject != "" {
+			subjects = append(subjects, subject)
+		}
+	}
+
+	return encrypters, subjects, nil
+}
+
+// findSecretByContentMAC returns the ID of the secret created with the content MAC, if any
+func findSecretByContentMAC(ws *workspace.Workspace, mac string) (string, error) {
+	secretIDs, err := listSecretIDs(ws)
+	if err != nil {
+		return "", err
+	}
+
+	for _, secretID := range secretIDs {
+		s, err := secret.Load(ws.SecretPath(secretID + ".yml"))
+		if err != nil {
+			return "", errors.Wrapf(err, "failed to load secret %s", secretID)
+		}
+		if ws.CheckPolicy(secretID, s) != nil {
+			continue
+		}
+		if s.ContentMAC != "" && hmac.Equal([]byte(s.ContentMAC), []byte(mac)) {
+			return secretID, nil
+		}
+	}
+
+	return "", nil
 }
@@ -0,0 +1,83 @@
+package cmd
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/open-zhy/secm/pkg/agent"
+	"github.com/open-zhy/secm/pkg/crypto"
+	"github.com/open-zhy/secm/pkg/id"
+	"github.com/open-zhy/secm/pkg/secret"
+	"github.com/open-zhy/secm/pkg/workspace"
+)
+
+// newTestWorkspace initializes a workspace under a temporary home directory,
+// decrypting without agent, it is the profile the commands load
+func newTestWorkspace(t *testing.T) *workspace.Workspace {
+	t.Helper()
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv(agent.SockEnv, "")
+	profile = "test"
+	t.Cleanup(func() { profile = "default" })
+
+	ws, err := workspace.Initialize("test")
+	if err != nil {
+		t.Fatalf("Initialize: %v", err)
+	}
+	identity, err := id.GenerateKey(id.GenerateKeyOpts{Type: "ec25519"})
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	if err := ws.SaveKey(identity, nil); err != nil {
+		t.Fatalf("SaveKey: %v", err)
+	}
+
+	return ws
+}
+
+func TestStoreSecretDedup(t *testing.T) {
+	ws := newTestWorkspace(t)
+	pub, err := ws.LoadPublicKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	content := []byte("same content")
+	open := func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(content)), nil
+	}
+	store := func(dedup bool) (string, string) {
+		t.Helper()
+		secretID, secretPath, err := storeSecret(ws, secret.New("token", nil), open, crypto.DefaultCipher, []id.Encrypter{pub}, dedup)
+		if err != nil {
+			t.Fatalf("storeSecret: %v", err)
+		}
+		return secretID, secretPath
+	}
+
+	// without --dedup, identical contents are distinct secrets
+	first, path := store(false)
+	if path == "" {
+		t.Fatal("secret created without --dedup was not stored")
+	}
+	if second, path := store(false); path == "" || second == first {
+		t.Fatal("secret with the same content was deduplicated without --dedup")
+	}
+
+	// only secrets created with --dedup carry the MAC they are found by
+	dedup, path := store(true)
+	if path == "" || dedup == first {
+		t.Fatal("secret created with --dedup matched a secret created without it")
+	}
+	if again, path := store(true); path != "" || again != dedup {
+		t.Fatalf("secret with the same content created with --dedup: got ID %s stored at %q, want %s", again, path, dedup)
+	}
+
+	secretIDs, err := listSecretIDs(ws)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(secretIDs) != 3 {
+		t.Fatalf("%d secrets stored, want 3", len(secretIDs))
+	}
+}
@@ -2,7 +2,6 @@ package cmd
 
 import (
 	"fmt"
-	"os"
 
 	"github.com/open-zhy/secm/pkg/screen"
 	"github.com/open-zhy/secm/pkg/secret"
@@ -32,9 +31,15 @@ func runDelete(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("failed to load workspace: %w", err)
 	}
 
+	lock, err := ws.LockWrites()
+	if err != nil {
+		return err
+	}
+	defer lock.Close()
+
 	// Load the secret
 	secretPath := ws.SecretPath(secretID + ".yml")
-	_, err = secret.Load(secretPath)
+	s, err := secret.Load(secretPath)
 	if err != nil {
 		return fmt.Errorf("no such a secret: %w", err)
 	}
@@ -50,9 +55,9 @@ func runDelete(cmd *cobra.Command, args []string) error {
 		}
 	}
 
-	// Delete the secret file
-	if err := os.Remove(secretPath); err != nil {
-		return fmt.Errorf("failed to delete secret file: %w", err)
+	// Delete the secret file and its data
+	if err := ws.RemoveSecret(secretPath, s); err != nil {
+		return err
 	}
 
 	return nil
@@ -0,0 +1,269 @@
+package cmd
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+
+	"github.com/open-zhy/secm/pkg/errors"
+	"github.com/open-zhy/secm/pkg/screen"
+	"github.com/open-zhy/secm/pkg/secret"
+	"github.com/open-zhy/secm/pkg/workspace"
+	"github.com/spf13/cobra"
+)
+
+var editCmd = &cobra.Command{
+	Use:   "edit [secret-id]",
+	Short: "Edit a secret in $EDITOR",
+	Long: `Decrypt a secret into a private file on a memory file system ($XDG_RUNTIME_DIR or /dev/shm),
+open it with $VISUAL or $EDITOR, and store the result as a new version of the secret when it changed.
+The file and anything the editor left next to it are overwritten and removed afterwards, also when
+the editor fails or secm is interrupted, the changes being discarded then.`,
+	Args: cobra.ExactArgs(1),
+	RunE: runEdit,
+}
+
+func init() {
+	addSecretPassphraseFlag(editCmd)
+	rootCmd.AddCommand(editCmd)
+}
+
+func runEdit(cmd *cobra.Command, args []string) error {
+	secretID := args[0]
+
+	ws, err := workspace.Load(profile)
+	if err != nil {
+		return errors.Wrapf(err, "failed to load workspace")
+	}
+
+	lock, err := ws.LockWrites()
+	if err != nil {
+		return err
+	}
+	defer lock.Close()
+
+	s, err := secret.Load(ws.SecretPath(secretID + ".yml"))
+	if err != nil {
+		return errors.Wrapf(err, "failed to load secret")
+	}
+	if s.Format == "binary" {
+		return errors.New("binary secrets cannot be edited, use 'secm update' instead")
+	}
+	if err := ws.CheckPolicy(secretID, s); err != nil {
+		return err
+	}
+	if s.MaxReads > 0 {
+		return errors.New("secrets with a read limit cannot be edited, use 'secm update' instead")
+	}
+
+	dir, err := privateEditDir()
+	if err != nil {
+		return err
+	}
+
+	// removed on every path out, a signal included
+	var once sync.Once
+	cleanup := func() {
+		once.Do(func() {
+			if err := wipeDir(dir); err != nil {
+				screen.Errorf("failed to remove %s: %s\n", dir, err)
+			}
+		})
+	}
+	defer cleanup()
+
+	// the editor is stopped first, it would otherwise keep writing plaintext
+	var editor atomic.Pointer[os.Process]
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	defer signal.Stop(sigCh)
+	go func() {
+		if _, ok := <-sigCh; ok {
+			if p := editor.Load(); p != nil {
+				p.Kill()
+				p.Wait()
+			}
+			cleanup()
+			screen.Errorf("Interrupted, changes discarded\n")
+			os.Exit(130)
+		}
+	}()
+
+	path := filepath.Join(dir, editFileName(s))
+	before, err := decryptToFile(ws, secretID, s, path)
+	if err != nil {
+		return err
+	}
+
+	if err := runEditor(path, &editor); err != nil {
+		return errors.Wrapf(err, "editor failed, changes discarded")
+	}
+
+	after, err := fileSum(path)
+	if err != nil {
+		return err
+	}
+	if bytes.Equal(before, after) {
+		screen.Println("No changes")
+		return nil
+	}
+
+	open := func() (io.ReadCloser, error) {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to read edited file")
+		}
+		return f, nil
+	}
+
+	return updateSecret(ws, secretID, s, open)
+}
+
+// privateEditDir creates a directory only accessible to the user on a memory file
+// system, plaintext written there never reaches a disk
+func privateEditDir() (string, error) {
+	var candidates []string
+	if runtimeDir := os.Getenv("XDG_RUNTIME_DIR"); runtimeDir != "" {
+		candidates = append(candidates, runtimeDir)
+	}
+	candidates = append(candidates, "/dev/shm")
+
+	for _, base := range candidates {
+		if !isMemoryFS(base) {
+			continue
+		}
+
+		dir, err := os.MkdirTemp(base, "secm-edit-")
+		if err != nil {
+			continue
+		}
+		if err := os.Chmod(dir, 0700); err != nil {
+			os.Remove(dir)
+			return "", errors.Wrapf(err, "failed to protect %s", dir)
+		}
+		return dir, nil
+	}
+
+	return "", errors.New("no memory file system found to edit the secret, tried %s", strings.Join(candidates, ", "))
+}
+
+// editFileName gives the editor a hint of the content type
+func editFileName(s *secret.Secret) string {
+	if s.Format == "json" {
+		return "secret.json"
+	}
+	return "secret.txt"
+}
+
+// decryptToFile writes the plaintext of the secret into a new 0600 file and
+// returns its SHA-256
+func decryptToFile(ws *workspace.Workspace, secretID string, s *secret.Secret, path string) ([]byte, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to create temporary file")
+	}
+
+	h := sha256.New()
+	err = ws.DecryptSecretTo(secretID, s, io.MultiWriter(f, h))
+	if closeErr := f.Close(); err == nil && closeErr != nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to decrypt secret")
+	}
+
+	return h.Sum(nil), nil
+}
+
+// runEditor opens the file with $VISUAL, $EDITOR or vi, the variable may hold arguments.
+// The editor process is stored in proc while it runs.
+func runEditor(path string, proc *atomic.Pointer[os.Process]) error {
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if editor == "" {
+		editor = "vi"
+	}
+
+	fields := strings.Fields(editor)
+	c := exec.Command(fields[0], append(fields[1:], path)...)
+	c.Stdin = os.Stdin
+	c.Stdout = os.Stdout
+	c.Stderr = os.Stderr
+
+	if err := c.Start(); err != nil {
+		return err
+	}
+	proc.Store(c.Process)
+	defer proc.Store(nil)
+
+	return c.Wait()
+}
+
+// fileSum returns the SHA-256 of the file
+func fileSum(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read edited file")
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return nil, errors.Wrapf(err, "failed to read edited file")
+	}
+
+	return h.Sum(nil), nil
+}
+
+// wipeDir overwrites every file of the directory with zeros before removing it,
+// swap and backup files of the editor included
+func wipeDir(dir string) error {
+	err := filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return nil
+		}
+		return wipeFile(path)
+	})
+	if rmErr := os.RemoveAll(dir); err == nil {
+		err = rmErr
+	}
+
+	return err
+}
+
+// wipeFile overwrites the content of the file with zeros
+func wipeFile(path string) error {
+	f, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.CopyN(f, zeroReader{}, info.Size()); err != nil {
+		return err
+	}
+
+	return f.Sync()
+}
+
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	clear(p)
+	return len(p), nil
+}
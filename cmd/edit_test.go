@@ -0,0 +1,104 @@
+package cmd
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/open-zhy/secm/pkg/crypto"
+	"github.com/open-zhy/secm/pkg/id"
+	"github.com/open-zhy/secm/pkg/secret"
+	"github.com/open-zhy/secm/pkg/workspace"
+)
+
+// setupEdit stores a secret to edit with the editor script and returns its ID
+// along with the memory file system directory the edits happen in
+func setupEdit(t *testing.T, script string) (*workspace.Workspace, string, string) {
+	t.Helper()
+	base, err := os.MkdirTemp("/dev/shm", "secm-test-")
+	if err != nil || !isMemoryFS(base) {
+		t.Skip("no memory file system at /dev/shm")
+	}
+	t.Cleanup(func() { os.RemoveAll(base) })
+
+	ws := newTestWorkspace(t)
+	pub, err := ws.LoadPublicKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	open := func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader([]byte("before\n"))), nil
+	}
+	secretID, _, err := storeSecret(ws, secret.New("config", nil), open, crypto.DefaultCipher, []id.Encrypter{pub}, false)
+	if err != nil {
+		t.Fatalf("storeSecret: %v", err)
+	}
+
+	editor := filepath.Join(t.TempDir(), "editor")
+	if err := os.WriteFile(editor, []byte("#!/bin/sh\n"+script), 0700); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("XDG_RUNTIME_DIR", base)
+	t.Setenv("VISUAL", "")
+	t.Setenv("EDITOR", editor)
+
+	return ws, secretID, base
+}
+
+// checkEditDirRemoved fails when an edit directory is left in base
+func checkEditDirRemoved(t *testing.T, base string) {
+	t.Helper()
+	left, err := filepath.Glob(filepath.Join(base, "secm-edit-*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(left) > 0 {
+		t.Fatalf("edit directory left behind: %v", left)
+	}
+}
+
+func TestEditFailingEditorWipes(t *testing.T) {
+	// the editor keeps a second name for the plaintext file, then crashes
+	_, secretID, base := setupEdit(t, `ln "$1" "$XDG_RUNTIME_DIR/link"; exit 1`)
+
+	if err := runEdit(editCmd, []string{secretID}); err == nil {
+		t.Fatal("edit succeeded with a failing editor")
+	}
+	checkEditDirRemoved(t, base)
+
+	// the content was overwritten, not only unlinked
+	linked, err := os.ReadFile(filepath.Join(base, "link"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(linked) != len("before\n") || bytes.Count(linked, []byte{0}) != len(linked) {
+		t.Fatalf("plaintext file not wiped: %q", linked)
+	}
+}
+
+func TestEditUpdatesSecret(t *testing.T) {
+	ws, secretID, base := setupEdit(t, `echo after > "$1"`)
+
+	if err := runEdit(editCmd, []string{secretID}); err != nil {
+		t.Fatalf("edit: %v", err)
+	}
+	checkEditDirRemoved(t, base)
+
+	s, err := secret.Load(ws.SecretPath(secretID + ".yml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.CurrentVersion() != 2 {
+		t.Fatalf("current version %d after edit, want 2", s.CurrentVersion())
+	}
+	got, err := ws.DecryptSecret(secretID, s)
+	if err != nil {
+		t.Fatalf("DecryptSecret: %v", err)
+	}
+	defer got.Destroy()
+	if string(got.Bytes()) != "after\n" {
+		t.Fatalf("edited secret holds %q", got.Bytes())
+	}
+}
@@ -0,0 +1,211 @@
+package cmd
+
+import (
+	"io"
+	"os"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+	"github.com/open-zhy/secm/pkg/crypto"
+	"github.com/open-zhy/secm/pkg/errors"
+	"github.com/open-zhy/secm/pkg/screen"
+	"github.com/open-zhy/secm/pkg/secret"
+	"github.com/open-zhy/secm/pkg/workspace"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+// FormatAge is the age file format, see https://age-encryption.org/v1
+const FormatAge = "age"
+
+var (
+	exportFormat         string
+	exportRecipients     []string
+	exportRecipientFiles []string
+	exportOutput         string
+	exportArmor          bool
+	exportPassphrase     bool
+)
+
+var exportCmd = &cobra.Command{
+	Use:   "export [secret-id]",
+	Short: "Export a secret to a file readable without secm",
+	Long: `Decrypt a secret and encrypt it again as a standard age file for the given recipients,
+X25519 (age1...) or SSH (ssh-ed25519, ssh-rsa) public keys. With --passphrase, the file is encrypted
+with a passphrase (scrypt) instead, read from --new-passphrase-file, ` + NewPassphraseEnv + ` or prompted
+twice, and opens with 'age --decrypt' or 'secm import'.`,
+	Args: cobra.ExactArgs(1),
+	RunE: runExport,
+}
+
+func init() {
+	exportCmd.Flags().StringVar(&exportFormat, "format", FormatAge, "Format of the exported file, supports age")
+	exportCmd.Flags().StringArrayVar(&exportRecipients, "recipient", nil, "age or SSH public key of a recipient, can be repeated")
+	exportCmd.Flags().StringArrayVarP(&exportRecipientFiles, "recipients-file", "R", nil, "File with one age or SSH public key per line, can be repeated")
+	exportCmd.Flags().StringVarP(&exportOutput, "output", "o", "", "Output file path, defaults to stdout")
+	exportCmd.Flags().BoolVarP(&exportArmor, "armor", "a", false, "Write a PEM encoded (ASCII) age file")
+	exportCmd.Flags().BoolVar(&exportPassphrase, "passphrase", false, "Encrypt the file with a passphrase instead of recipients")
+	exportCmd.Flags().StringVar(&newPassphraseFile, "new-passphrase-file", "", "File holding the passphrase to encrypt the file with")
+	addSecretPassphraseFlag(exportCmd)
+	exportCmd.MarkFlagsMutuallyExclusive("passphrase", "recipient")
+	exportCmd.MarkFlagsMutuallyExclusive("passphrase", "recipients-file")
+	rootCmd.AddCommand(exportCmd)
+}
+
+func runExport(cmd *cobra.Command, args []string) error {
+	secretID := args[0]
+
+	if exportFormat != FormatAge {
+		return errors.New("unsupported export format: %s", exportFormat)
+	}
+
+	var ageRecipients []age.Recipient
+	if exportPassphrase {
+		passphrase, err := readNewPassphrase(newPassphraseFile, "--new-passphrase-file", NewPassphraseEnv)
+		if err != nil {
+			return err
+		}
+
+		recipient, err := age.NewScryptRecipient(string(passphrase))
+		if err != nil {
+			return errors.Wrapf(err, "invalid passphrase")
+		}
+		ageRecipients = []age.Recipient{recipient}
+	} else {
+		var err error
+		ageRecipients, err = loadAgeRecipients(exportRecipients, exportRecipientFiles)
+		if err != nil {
+			return err
+		}
+	}
+
+	ws, err := workspace.Load(profile)
+	if err != nil {
+		return errors.Wrapf(err, "failed to load workspace")
+	}
+
+	secretPath := ws.SecretPath(secretID + ".yml")
+	s, err := secret.Load(secretPath)
+	if err != nil {
+		return errors.Wrapf(err, "failed to load secret")
+	}
+	if err := ws.CheckPolicy(secretID, s); err != nil {
+		return err
+	}
+
+	if exportOutput == "" && !exportArmor && term.IsTerminal(int(os.Stdout.Fd())) {
+		return errors.New("refusing to write a binary age file to the terminal, use --armor or --output")
+	}
+
+	// a secret burnt by this read must not be brought back by a rotation
+	if s.MaxReads > 0 {
+		lock, err := ws.LockWrites()
+		if err != nil {
+			return err
+		}
+		defer lock.Close()
+	}
+
+	// the read is counted before anything is revealed
+	last, err := ws.RecordRead(secretID, s)
+	if err != nil {
+		return err
+	}
+
+	if exportOutput == "" {
+		if err := exportAge(ws, secretID, s, os.Stdout, ageRecipients); err != nil {
+			return err
+		}
+		if last {
+			return ws.BurnSecret(secretID, s)
+		}
+		return nil
+	}
+
+	f, err := os.OpenFile(exportOutput, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return errors.Wrapf(err, "failed to create output file")
+	}
+
+	if err := exportAge(ws, secretID, s, f, ageRecipients); err != nil {
+		f.Close()
+		os.Remove(exportOutput)
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		return errors.Wrapf(err, "failed to write output file")
+	}
+
+	screen.Successf("Secret '%s' exported to: %s\n", s.Name, exportOutput)
+	if last {
+		if err := ws.BurnSecret(secretID, s); err != nil {
+			return err
+		}
+		screen.Infof("Last read of the secret, it has been deleted\n")
+	}
+	return nil
+}
+
+// exportAge streams the decrypted secret into an age file written to dst
+func exportAge(ws *workspace.Workspace, secretID string, s *secret.Secret, dst io.Writer, recipients []age.Recipient) error {
+	out := dst
+	var armorWriter io.WriteCloser
+	if exportArmor {
+		armorWriter = armor.NewWriter(dst)
+		out = armorWriter
+	}
+
+	w, err := age.Encrypt(out, recipients...)
+	if err != nil {
+		return errors.Wrapf(err, "failed to create age file")
+	}
+
+	if err := ws.DecryptSecretTo(secretID, s, w); err != nil {
+		return errors.Wrapf(err, "failed to decrypt secret")
+	}
+
+	if err := w.Close(); err != nil {
+		return errors.Wrapf(err, "failed to write age file")
+	}
+
+	if armorWriter != nil {
+		if err := armorWriter.Close(); err != nil {
+			return errors.Wrapf(err, "failed to write age file")
+		}
+	}
+
+	return nil
+}
+
+// loadAgeRecipients parses the recipients given as values and in files
+func loadAgeRecipients(values []string, files []string) ([]age.Recipient, error) {
+	var ageRecipients []age.Recipient
+	for _, value := range values {
+		recipient, err := crypto.ParseAgeRecipient(value)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid recipient")
+		}
+		ageRecipients = append(ageRecipients, recipient)
+	}
+
+	for _, path := range files {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to open recipients file")
+		}
+
+		fileRecipients, err := crypto.ParseAgeRecipientsFile(f)
+		f.Close()
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid recipients file %s", path)
+		}
+		ageRecipients = append(ageRecipients, fileRecipients...)
+	}
+
+	if len(ageRecipients) == 0 {
+		return nil, errors.New("no recipient, use --recipient, --recipients-file or --passphrase")
+	}
+
+	return ageRecipients, nil
+}
@@ -0,0 +1,12 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+var expectFingerprints []string
+
+// addExpectFingerprintFlag registers --expect-fingerprint on commands taking recipient public keys
+func addExpectFingerprintFlag(cmd *cobra.Command) {
+	cmd.Flags().StringArrayVar(&expectFingerprints, "expect-fingerprint", nil, "Fingerprint each recipient must match, as printed by 'secm id --fingerprint' (16 hex digits at least), can be repeated")
+}
@@ -21,7 +21,7 @@ var (
 func init() {
 	rootCmd.AddCommand(generateCmd)
 
-	generateCmd.PersistentFlags().StringVarP(&keyType, "type", "t", "rsa", "Key type, supports rsa, p256, p384, p521, ec25519")
+	generateCmd.PersistentFlags().StringVarP(&keyType, "type", "t", "rsa", "Key type, supports rsa, p256, p384, p521, ec25519, ed25519, mlkem768-x25519")
 	generateCmd.PersistentFlags().IntVar(&keySize, "size", 2048, "Key size, take effect for RSA key types only")
 }
 
@@ -5,6 +5,7 @@ import (
 	"os"
 	"strings"
 
+	"github.com/open-zhy/secm/pkg/id"
 	"github.com/open-zhy/secm/pkg/screen"
 	"github.com/open-zhy/secm/pkg/secret"
 	"github.com/open-zhy/secm/pkg/workspace"
@@ -12,16 +13,20 @@ import (
 )
 
 var (
-	outputFile string
-	showMeta   bool
-	quiet      bool
+	outputFile   string
+	showMeta     bool
+	quiet        bool
+	verifySecret bool
+	signerFile   string
+	getVersion   int
 )
 
 var getCmd = &cobra.Command{
 	Use:   "get [secret-id]",
 	Short: "Retrieve a secret by its ID",
 	Long: `Retrieve and decrypt a secret using its ID. The secret can be output to stdout
-or saved to a file using the --output flag.`,
+or saved to a file using the --output flag. The passphrase of secrets encrypted with one is prompted,
+or read from --secret-passphrase-file or ` + SecretPassphraseEnv + `.`,
 	Args: cobra.ExactArgs(1),
 	RunE: runGet,
 }
@@ -30,6 +35,10 @@ func init() {
 	getCmd.Flags().StringVarP(&outputFile, "output", "o", "", "Output file path (optional)")
 	getCmd.Flags().BoolVarP(&showMeta, "meta", "m", false, "Show secret metadata")
 	getCmd.Flags().BoolVarP(&quiet, "quiet", "q", false, "Only output secret value")
+	getCmd.Flags().BoolVar(&verifySecret, "verify", false, "Verify the signature of the secret before decrypting it")
+	getCmd.Flags().IntVar(&getVersion, "version", 0, "Version of the secret to retrieve, see 'secm history', defaults to the current one")
+	getCmd.Flags().StringVar(&signerFile, "signer", "", "Verifying key file of the expected signer, defaults to the workspace signing key")
+	addSecretPassphraseFlag(getCmd)
 	rootCmd.AddCommand(getCmd)
 }
 
@@ -48,11 +57,28 @@ func runGet(cmd *cobra.Command, args []string) error {
 	if err != nil {
 		return fmt.Errorf("failed to load secret: %w", err)
 	}
+	stored := s
+	latest := s.CurrentVersion()
 
-	// Decrypt the data
-	decryptedData, err := ws.DecryptSecret(s)
+	reads, err := ws.Reads(secretID)
 	if err != nil {
-		return fmt.Errorf("failed to decrypt secret: %w", err)
+		return err
+	}
+	if err := s.CheckPolicy(reads); err != nil {
+		return err
+	}
+
+	if getVersion != 0 {
+		s, err = s.AtVersion(getVersion)
+		if err != nil {
+			return err
+		}
+	}
+
+	if verifySecret {
+		if err := verifySigner(ws, secretID, s); err != nil {
+			return err
+		}
 	}
 
 	if showMeta {
@@ -67,23 +93,108 @@ func runGet(cmd *cobra.Command, args []string) error {
 			screen.Printf("Tags: %s\n", strings.Join(s.Tags, ", "))
 		}
 		screen.Printf("Format: %s\n", s.Format)
+		if c, err := ws.SecretCipher(s); err == nil {
+			screen.Printf("Cipher: %s\n", c)
+		}
+		screen.Printf("Version: %d of %d\n", s.CurrentVersion(), latest)
 		screen.Printf("Created: %s\n", s.CreatedAt.Format("2006-01-02 15:04:05"))
+		screen.Printf("Modified: %s\n", s.LastModified().Format("2006-01-02 15:04:05"))
+		if !s.ExpiresAt.IsZero() {
+			screen.Printf("Expires: %s\n", s.ExpiresAt.Format("2006-01-02 15:04:05"))
+		}
+		if n, ok := stored.ReadsLeft(reads); ok {
+			screen.Printf("Reads left: %d of %d\n", n, s.MaxReads)
+		}
 		screen.Println("\nSecret Value:")
 	}
 
-	// Handle output
+	// a secret burnt by this read must not be brought back by a rotation
+	if stored.MaxReads > 0 {
+		lock, err := ws.LockWrites()
+		if err != nil {
+			return err
+		}
+		defer lock.Close()
+	}
+
+	// the read is counted before anything is revealed
+	last, err := ws.RecordRead(secretID, stored)
+	if err != nil {
+		return err
+	}
+
+	// Handle output, the data is decrypted as a stream
 	if outputFile != "" {
-		if err := os.WriteFile(outputFile, decryptedData, 0600); err != nil {
+		f, err := os.OpenFile(outputFile, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+		if err != nil {
+			return fmt.Errorf("failed to write output file: %w", err)
+		}
+
+		if err := ws.DecryptSecretTo(secretID, s, f); err != nil {
+			f.Close()
+			os.Remove(outputFile)
+			return fmt.Errorf("failed to decrypt secret: %w", err)
+		}
+
+		if err := f.Close(); err != nil {
 			return fmt.Errorf("failed to write output file: %w", err)
 		}
 		if !quiet {
 			screen.Printf("Secret written to: %s\n", outputFile)
 		}
-	} else if !quiet {
-		screen.Println(string(decryptedData))
+		return burnGet(ws, secretID, stored, last)
+	}
+
+	if err := ws.DecryptSecretTo(secretID, s, os.Stdout); err != nil {
+		return fmt.Errorf("failed to decrypt secret: %w", err)
+	}
+
+	// In quiet mode, just print the value without newline
+	if !quiet {
+		screen.Println("")
+	}
+
+	return burnGet(ws, secretID, stored, last)
+}
+
+// burnGet deletes the secret when its last read was just made
+func burnGet(ws *workspace.Workspace, secretID string, s *secret.Secret, last bool) error {
+	if !last {
+		return nil
+	}
+	if err := ws.BurnSecret(secretID, s); err != nil {
+		return err
+	}
+	if !quiet {
+		screen.Infof("Last read of the secret, it has been deleted\n")
+	}
+	return nil
+}
+
+// verifySigner checks the secret was signed by the key given with --signer,
+// or by the workspace itself
+func verifySigner(ws *workspace.Workspace, secretID string, s *secret.Secret) error {
+	var trusted id.VerifyingKey
+	if signerFile != "" {
+		key, err := id.LoadVerifyingKeyFile(signerFile)
+		if err != nil {
+			return fmt.Errorf("failed to load signer key: %w", err)
+		}
+		trusted = key
 	} else {
-		// In quiet mode, just print the value without newline
-		screen.Printf(string(decryptedData))
+		key, err := ws.LoadSigningKey()
+		if err != nil {
+			return err
+		}
+		trusted = key.VerifyingKey()
+	}
+
+	if _, err := ws.VerifySecret(secretID, s, trusted); err != nil {
+		return fmt.Errorf("failed to verify secret: %w", err)
+	}
+
+	if !quiet {
+		screen.Successf("Signature verified\n")
 	}
 
 	return nil
@@ -0,0 +1,53 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/open-zhy/secm/pkg/crypto"
+	"github.com/open-zhy/secm/pkg/id"
+	"github.com/open-zhy/secm/pkg/secret"
+)
+
+func TestGetLastReadDeletes(t *testing.T) {
+	ws := newTestWorkspace(t)
+	pub, err := ws.LoadPublicKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := secret.New("token", nil)
+	s.MaxReads = 2
+	open := func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader([]byte("two-time token"))), nil
+	}
+	secretID, secretPath, err := storeSecret(ws, s, open, crypto.DefaultCipher, []id.Encrypter{pub}, false)
+	if err != nil {
+		t.Fatalf("storeSecret: %v", err)
+	}
+
+	outputFile, quiet = filepath.Join(t.TempDir(), "out"), true
+	t.Cleanup(func() { outputFile, quiet = "", false })
+
+	for read := 1; read <= s.MaxReads; read++ {
+		if err := runGet(getCmd, []string{secretID}); err != nil {
+			t.Fatalf("read %d: %v", read, err)
+		}
+		got, err := os.ReadFile(outputFile)
+		if err != nil || string(got) != "two-time token" {
+			t.Fatalf("read %d: output %q, %v", read, got, err)
+		}
+	}
+
+	for _, path := range []string{secretPath, ws.BlobPath(s.Blob)} {
+		if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("%s left after the last read: %v", path, err)
+		}
+	}
+	if err := runGet(getCmd, []string{secretID}); err == nil {
+		t.Fatal("secret read after its last read")
+	}
+}
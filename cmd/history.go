@@ -0,0 +1,109 @@
+package cmd
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/open-zhy/secm/pkg/errors"
+	"github.com/open-zhy/secm/pkg/screen"
+	"github.com/open-zhy/secm/pkg/secret"
+	"github.com/open-zhy/secm/pkg/workspace"
+	"github.com/spf13/cobra"
+)
+
+var historyCmd = &cobra.Command{
+	Use:   "history [secret-id]",
+	Short: "List the versions of a secret",
+	Long: `List the versions of a secret kept by 'secm update', with the time each one was written and
+the size of its content. Any of them can be read with 'secm get --version' or made current again
+with 'secm rollback'.`,
+	Args: cobra.ExactArgs(1),
+	RunE: runHistory,
+}
+
+var rollbackCmd = &cobra.Command{
+	Use:   "rollback [secret-id] [version]",
+	Short: "Make a previous version of a secret current again",
+	Long: `Make a previous version of a secret current again. The content of the version is copied as
+a new version, so the history is kept and the rollback can itself be undone.`,
+	Args: cobra.ExactArgs(2),
+	RunE: runRollback,
+}
+
+func init() {
+	rootCmd.AddCommand(historyCmd)
+	rootCmd.AddCommand(rollbackCmd)
+}
+
+func runHistory(cmd *cobra.Command, args []string) error {
+	secretID := args[0]
+
+	ws, err := workspace.Load(profile)
+	if err != nil {
+		return errors.Wrapf(err, "failed to load workspace")
+	}
+
+	s, err := secret.Load(ws.SecretPath(secretID + ".yml"))
+	if err != nil {
+		return errors.Wrapf(err, "failed to load secret")
+	}
+
+	screen.Printf("History of secret '%s':\n", s.Name)
+	screen.Printf("%-8s  %-20s  %s\n", "Version", "Created At", "Size")
+	screen.Println("--------------------------------------------")
+
+	versions := s.Versions()
+	for i := len(versions) - 1; i >= 0; i-- {
+		v := versions[i]
+
+		size := "-"
+		if v.Size > 0 {
+			size = fmt.Sprintf("%d bytes", v.Size)
+		}
+
+		current := ""
+		if v.Number == s.CurrentVersion() {
+			current = " (current)"
+		}
+
+		screen.Printf("%-8d  %-20s  %s%s\n", v.Number, v.CreatedAt.Format("2006-01-02 15:04:05"), size, current)
+	}
+
+	return nil
+}
+
+func runRollback(cmd *cobra.Command, args []string) error {
+	secretID := args[0]
+	n, err := strconv.Atoi(args[1])
+	if err != nil {
+		return errors.New("invalid version: %s", args[1])
+	}
+
+	ws, err := workspace.Load(profile)
+	if err != nil {
+		return errors.Wrapf(err, "failed to load workspace")
+	}
+
+	lock, err := ws.LockWrites()
+	if err != nil {
+		return err
+	}
+	defer lock.Close()
+
+	s, err := secret.Load(ws.SecretPath(secretID + ".yml"))
+	if err != nil {
+		return errors.Wrapf(err, "failed to load secret")
+	}
+
+	pruned, err := ws.RollbackSecret(secretID, s, n)
+	if err != nil {
+		return errors.Wrapf(err, "failed to roll back secret")
+	}
+
+	if err := saveNewVersion(ws, secretID, s, pruned); err != nil {
+		return err
+	}
+
+	screen.Successf("Rolled back secret '%s' to version %d, now version %d\n", s.Name, n, s.CurrentVersion())
+	return nil
+}
@@ -3,7 +3,9 @@ package cmd
 import (
 	"fmt"
 	"os"
+	"strings"
 
+	"github.com/open-zhy/secm/pkg/crypto"
 	"github.com/open-zhy/secm/pkg/id"
 	"github.com/open-zhy/secm/pkg/workspace"
 	"github.com/spf13/cobra"
@@ -17,7 +19,18 @@ var idCmd = &cobra.Command{
 	RunE: runIdCommand,
 }
 
+var (
+	showSigningKey   bool
+	showAgeRecipient bool
+	showFingerprint  bool
+	showCertificate  bool
+)
+
 func init() {
+	idCmd.Flags().BoolVar(&showSigningKey, "signing", false, "Print the verifying key of the workspace signing key instead")
+	idCmd.Flags().BoolVar(&showFingerprint, "fingerprint", false, "Print the fingerprint of the identity (or signing key with --signing) and its randomart instead")
+	idCmd.Flags().BoolVar(&showCertificate, "cert", false, "Print the certificate of the identity, given to others as recipient, instead")
+	idCmd.Flags().BoolVar(&showAgeRecipient, "age", false, "Print the age recipient (age1...) of an X25519 identity instead")
 	rootCmd.AddCommand(idCmd)
 }
 
@@ -28,10 +41,60 @@ func runIdCommand(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("failed to initialize workspace: %w", err)
 	}
 
-	identity, err := id.LoadKeyFile(ws.KeyPath)
+	if showSigningKey {
+		signingKey, err := ws.LoadSigningKey()
+		if err != nil {
+			return err
+		}
+		if showFingerprint {
+			verifying := signingKey.VerifyingKey()
+			printFingerprint(id.VerifyingKeyFingerprint(verifying), strings.ToUpper(verifying.Algorithm()))
+			return nil
+		}
+		return signingKey.VerifyingKey().Encode(os.Stdout)
+	}
+
+	if showCertificate {
+		cert, err := os.ReadFile(ws.CertPath)
+		if os.IsNotExist(err) {
+			return fmt.Errorf("identity has no certificate, see 'secm init --cert'")
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read identity certificate: %w", err)
+		}
+		_, err = os.Stdout.Write(cert)
+		return err
+	}
+
+	pub, err := ws.LoadPublicKey()
 	if err != nil {
 		return fmt.Errorf("failed to load identity: %w", err)
 	}
 
-	return identity.PublicKey().Encode(os.Stdout)
+	if showFingerprint {
+		fingerprint, err := id.PublicKeyFingerprint(pub)
+		if err != nil {
+			return err
+		}
+		printFingerprint(fingerprint, id.PublicKeyType(pub))
+		return nil
+	}
+
+	if showAgeRecipient {
+		recipient, err := crypto.AgeRecipient(pub)
+		if err != nil {
+			return err
+		}
+		fmt.Println(recipient)
+		return nil
+	}
+
+	return pub.Encode(os.Stdout)
+}
+
+// printFingerprint prints the fingerprint in full, in its short form and as randomart
+func printFingerprint(fingerprint id.Fingerprint, keyType string) {
+	fmt.Println(fingerprint)
+	fmt.Println(fingerprint.Short())
+	fmt.Print(fingerprint.Randomart(keyType))
 }
@@ -0,0 +1,124 @@
+package cmd
+
+import (
+	"bytes"
+	"io"
+	"os"
+
+	"github.com/open-zhy/secm/pkg/errors"
+	"github.com/open-zhy/secm/pkg/id"
+	"github.com/open-zhy/secm/pkg/screen"
+	"github.com/open-zhy/secm/pkg/shamir"
+	"github.com/open-zhy/secm/pkg/workspace"
+	"github.com/spf13/cobra"
+)
+
+var (
+	combinePublicKey string
+	combineForce     bool
+	combineProtect   bool
+)
+
+var idCombineCmd = &cobra.Command{
+	Use:   "combine [share-file...]",
+	Short: "Rebuild the identity key from Shamir shares",
+	Long: `Rebuild the identity key from shares created by 'secm id split', read from the given files
+or from stdin. The rebuilt key must match the public key of the workspace (identity.pub), or the one
+given with --public-key.`,
+	RunE: runIdCombine,
+}
+
+func init() {
+	idCombineCmd.Flags().StringVar(&combinePublicKey, "public-key", "", "Public key file the rebuilt key must match, defaults to the workspace public key")
+	idCombineCmd.Flags().BoolVar(&combineForce, "force", false, "Replace an existing identity key")
+	idCombineCmd.Flags().BoolVar(&combineProtect, "protect", false, "Encrypt the rebuilt identity key with a passphrase")
+	idCmd.AddCommand(idCombineCmd)
+}
+
+func runIdCombine(cmd *cobra.Command, args []string) error {
+	ws, err := workspace.Load(profile)
+	if err != nil {
+		return errors.Wrapf(err, "failed to load workspace")
+	}
+
+	lock, err := ws.LockWrites()
+	if err != nil {
+		return err
+	}
+	defer lock.Close()
+
+	if _, err := os.Stat(ws.KeyPath); err == nil && !combineForce {
+		return errors.New("identity key %s already exists, use --force to replace it", ws.KeyPath)
+	}
+
+	expected, err := loadExpectedPublicKey(ws)
+	if err != nil {
+		return err
+	}
+
+	var data []byte
+	if len(args) == 0 {
+		data, err = io.ReadAll(os.Stdin)
+		if err != nil {
+			return errors.Wrapf(err, "failed to read shares")
+		}
+	}
+	for _, path := range args {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return errors.Wrapf(err, "failed to read share file")
+		}
+		data = append(data, content...)
+		data = append(data, '\n')
+	}
+
+	shares, err := shamir.DecodeShares(data)
+	if err != nil {
+		return err
+	}
+
+	encoded, err := shamir.CombineArmored(shares)
+	if err != nil {
+		return errors.Wrapf(err, "failed to combine shares")
+	}
+	defer clear(encoded)
+
+	identity, err := id.ParseKey(encoded)
+	if err != nil {
+		return errors.Wrapf(err, "shares do not rebuild a valid identity key")
+	}
+
+	if !bytes.Equal(identity.PublicKey().Bytes(), expected.Bytes()) {
+		return errors.New("rebuilt identity key does not match the workspace public key")
+	}
+
+	var passphrase []byte
+	if combineProtect {
+		passphrase, err = readNewPassphrase(passphraseFile, "--passphrase-file", PassphraseEnv)
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := ws.SaveKey(identity, passphrase); err != nil {
+		return err
+	}
+
+	screen.Successf("Identity key rebuilt from %d shares at %s\n", len(shares), ws.KeyPath)
+	return nil
+}
+
+// loadExpectedPublicKey returns the public key the rebuilt identity must match
+func loadExpectedPublicKey(ws *workspace.Workspace) (id.PublicKey, error) {
+	path := combinePublicKey
+	if path == "" {
+		path = ws.PublicKeyPath
+	}
+
+	pub, err := id.LoadPublicKeyFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to load the public key to check the rebuilt key against, use --public-key")
+	}
+
+	return pub, nil
+}
@@ -0,0 +1,67 @@
+package cmd
+
+import (
+	"github.com/open-zhy/secm/pkg/errors"
+	"github.com/open-zhy/secm/pkg/screen"
+	"github.com/open-zhy/secm/pkg/workspace"
+	"github.com/spf13/cobra"
+)
+
+var (
+	newPassphraseFile string
+	removePassphrase  bool
+)
+
+var idPasswdCmd = &cobra.Command{
+	Use:   "passwd",
+	Short: "Change the passphrase of the identity key",
+	Long: `Change the passphrase protecting the identity key, or set one on an unprotected key.
+The current passphrase is read from --passphrase-file, ` + PassphraseEnv + ` or prompted, the new one
+from --new-passphrase-file, ` + NewPassphraseEnv + ` or prompted twice.`,
+	Args: cobra.NoArgs,
+	RunE: runIdPasswd,
+}
+
+func init() {
+	idPasswdCmd.Flags().StringVar(&newPassphraseFile, "new-passphrase-file", "", "File holding the new passphrase")
+	idPasswdCmd.Flags().BoolVar(&removePassphrase, "remove", false, "Remove the passphrase, the identity key is stored unencrypted")
+	idCmd.AddCommand(idPasswdCmd)
+}
+
+func runIdPasswd(cmd *cobra.Command, args []string) error {
+	ws, err := workspace.Load(profile)
+	if err != nil {
+		return errors.Wrapf(err, "failed to load workspace")
+	}
+
+	lock, err := ws.LockWrites()
+	if err != nil {
+		return err
+	}
+	defer lock.Close()
+
+	identity, err := ws.LoadKey()
+	if err != nil {
+		return err
+	}
+
+	var passphrase []byte
+	if !removePassphrase {
+		passphrase, err = readNewPassphrase(newPassphraseFile, "--new-passphrase-file", NewPassphraseEnv)
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := ws.SaveKey(identity, passphrase); err != nil {
+		return err
+	}
+
+	if removePassphrase {
+		screen.Successf("Passphrase removed, %s is stored unencrypted\n", ws.KeyPath)
+	} else {
+		screen.Successf("Passphrase of %s changed\n", ws.KeyPath)
+	}
+
+	return nil
+}
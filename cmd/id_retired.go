@@ -0,0 +1,58 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/open-zhy/secm/pkg/errors"
+	"github.com/open-zhy/secm/pkg/screen"
+	"github.com/open-zhy/secm/pkg/workspace"
+	"github.com/spf13/cobra"
+)
+
+var purgeRetired bool
+
+var idRetiredCmd = &cobra.Command{
+	Use:   "retired",
+	Short: "List or purge the identity keys replaced by 'secm id rotate'",
+	Long: `List the identity keys archived by 'secm id rotate'. They can still decrypt copies of secrets
+made before the rotation, use --purge to delete them once those are no longer needed.`,
+	Args: cobra.NoArgs,
+	RunE: runIdRetired,
+}
+
+func init() {
+	idRetiredCmd.Flags().BoolVar(&purgeRetired, "purge", false, "Delete the retired keys")
+	idCmd.AddCommand(idRetiredCmd)
+}
+
+func runIdRetired(cmd *cobra.Command, args []string) error {
+	ws, err := workspace.Load(profile)
+	if err != nil {
+		return errors.Wrapf(err, "failed to load workspace")
+	}
+
+	keys, err := ws.RetiredKeys()
+	if err != nil {
+		return err
+	}
+
+	if !purgeRetired {
+		for _, key := range keys {
+			fmt.Println(key)
+		}
+		return nil
+	}
+
+	lock, err := ws.LockWrites()
+	if err != nil {
+		return err
+	}
+	defer lock.Close()
+
+	if err := ws.PurgeRetiredKeys(); err != nil {
+		return err
+	}
+
+	screen.Successf("Purged %d retired key(s)\n", len(keys))
+	return nil
+}
@@ -0,0 +1,145 @@
+package cmd
+
+import (
+	"strings"
+
+	"github.com/open-zhy/secm/pkg/errors"
+	"github.com/open-zhy/secm/pkg/id"
+	"github.com/open-zhy/secm/pkg/screen"
+	"github.com/open-zhy/secm/pkg/secret"
+	"github.com/open-zhy/secm/pkg/workspace"
+	"github.com/spf13/cobra"
+)
+
+var (
+	rotateKeyType string
+	rotateKeySize int
+)
+
+var idRotateCmd = &cobra.Command{
+	Use:   "rotate",
+	Short: "Replace the identity key and re-encrypt every secret to the new one",
+	Long: `Generate a new identity key and re-encrypt every secret of the workspace to it with a new
+data key, secrets are signed again with the workspace signing key. The new key is protected by the
+same passphrase as the current one.
+
+Secrets are re-encrypted into a staging directory first, the workspace is only switched to the new
+key once all of them succeeded. An interrupted rotation is completed or discarded by the next command.
+The replaced key is archived in the retired keys directory until 'secm id retired --purge'.
+Recipients a secret was shared with lose access to it and have to be granted it again.`,
+	Args: cobra.NoArgs,
+	RunE: runIdRotate,
+}
+
+func init() {
+	idRotateCmd.Flags().StringVarP(&rotateKeyType, "type", "t", "", "Key type of the new identity, supports rsa, p256, p384, p521, ec25519, ed25519, mlkem768-x25519")
+	idRotateCmd.Flags().IntVar(&rotateKeySize, "size", 3072, "Key size, take effect for RSA key types only")
+	idRotateCmd.MarkFlagRequired("type")
+	idCmd.AddCommand(idRotateCmd)
+}
+
+func runIdRotate(cmd *cobra.Command, args []string) error {
+	ws, err := workspace.Load(profile)
+	if err != nil {
+		return errors.Wrapf(err, "failed to load workspace")
+	}
+
+	current, err := ws.LoadKey()
+	if err != nil {
+		return err
+	}
+
+	var passphrase []byte
+	protected, err := ws.IsKeyProtected()
+	if err != nil {
+		return err
+	}
+	if protected {
+		// already read to load the current key, it protects the new one as well
+		if passphrase, err = readPassphrase(ws.KeyPath); err != nil {
+			return err
+		}
+	}
+
+	identity, err := id.GenerateKey(id.GenerateKeyOpts{Type: rotateKeyType, Size: &rotateKeySize})
+	if err != nil {
+		return errors.Wrapf(err, "failed to generate key")
+	}
+
+	signer, created, err := ws.EnsureSigningKey()
+	if err != nil {
+		return err
+	}
+	if created {
+		screen.Printf("Generated ED25519 signing key at %s\n", ws.SigningKeyPath)
+	}
+
+	secretIDs, err := listSecretIDs(ws)
+	if err != nil {
+		return err
+	}
+
+	rotation, err := ws.BeginRotation()
+	if err != nil {
+		return err
+	}
+
+	rotatedCount, shared, foreign := 0, 0, 0
+	for _, secretID := range secretIDs {
+		s, rotated, err := stageRotatedSecret(ws, rotation, secretID, current, identity.PublicKey(), signer)
+		if err != nil {
+			rotation.Abort()
+			return errors.Wrapf(err, "failed to re-encrypt secret %s, the identity was not rotated", secretID)
+		}
+		if rotated == nil {
+			continue
+		}
+
+		rotatedCount++
+		if rotated.OtherRecipients > 0 {
+			screen.Printf("Secret '%s' (%s) was shared with %d other recipient(s), share it with them again\n", s.Name, secretID, rotated.OtherRecipients)
+			shared++
+		}
+		if rotated.ForeignSigner {
+			foreign++
+		}
+	}
+
+	if err := rotation.StageDedupKey(current, identity.PublicKey()); err != nil {
+		rotation.Abort()
+		return errors.Wrapf(err, "failed to re-encrypt the dedup key, the identity was not rotated")
+	}
+
+	retired, err := rotation.Commit(identity, passphrase)
+	if err != nil {
+		return errors.Wrapf(err, "failed to switch to the new identity, run any secm command to complete the rotation")
+	}
+
+	if foreign > 0 {
+		screen.Printf("%d secret(s) signed by another key are now signed by the workspace signing key\n", foreign)
+	}
+	screen.Successf("Rotated identity to a new %s key, %d secret(s) re-encrypted\n", strings.ToUpper(rotateKeyType), rotatedCount)
+	screen.Printf("Previous identity key archived at %s\n", retired)
+	if shared > 0 {
+		screen.Printf("%d secret(s) have to be shared again\n", shared)
+	}
+
+	return nil
+}
+
+// stageRotatedSecret re-encrypts the secret for the new identity, passphrase
+// secrets do not depend on the identity and are skipped with a nil result
+func stageRotatedSecret(ws *workspace.Workspace, rotation *workspace.Rotation, secretID string, from id.KeyPackageIdentity, to id.PublicKey, signer id.SigningKey) (*secret.Secret, *workspace.RotatedSecret, error) {
+	s, err := secret.Load(ws.SecretPath(secretID + ".yml"))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	protected, err := ws.IsPassphraseSecret(s)
+	if err != nil || protected {
+		return s, nil, err
+	}
+
+	rotated, err := rotation.Stage(secretID, s, from, to, signer)
+	return s, rotated, err
+}
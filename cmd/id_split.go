@@ -0,0 +1,97 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/open-zhy/secm/pkg/errors"
+	"github.com/open-zhy/secm/pkg/screen"
+	"github.com/open-zhy/secm/pkg/shamir"
+	"github.com/open-zhy/secm/pkg/workspace"
+	"github.com/spf13/cobra"
+)
+
+var (
+	splitShares    int
+	splitThreshold int
+	splitOutputDir string
+)
+
+var idSplitCmd = &cobra.Command{
+	Use:   "split",
+	Short: "Split the identity key into Shamir shares for backup",
+	Long: `Split the identity key into shares with Shamir's secret sharing, any --threshold of them
+rebuild the key with 'secm id combine' while fewer reveal nothing about it. Each share is printed
+as a text block with a checksum, to be stored apart from the others.`,
+	Args: cobra.NoArgs,
+	RunE: runIdSplit,
+}
+
+func init() {
+	idSplitCmd.Flags().IntVarP(&splitShares, "shares", "n", 5, "Number of shares to create")
+	idSplitCmd.Flags().IntVarP(&splitThreshold, "threshold", "k", 3, "Number of shares required to rebuild the key")
+	idSplitCmd.Flags().StringVarP(&splitOutputDir, "output-dir", "o", "", "Directory to write one file per share instead of printing them")
+	idCmd.AddCommand(idSplitCmd)
+}
+
+func runIdSplit(cmd *cobra.Command, args []string) error {
+	ws, err := workspace.Load(profile)
+	if err != nil {
+		return errors.Wrapf(err, "failed to load workspace")
+	}
+
+	identity, err := ws.LoadKey()
+	if err != nil {
+		return err
+	}
+
+	// the unencrypted encoding is split, a passphrase would be needed on top of the shares otherwise
+	var encoded bytes.Buffer
+	if err := identity.Encode(&encoded); err != nil {
+		return errors.Wrapf(err, "failed to encode identity key")
+	}
+	defer clear(encoded.Bytes())
+
+	shares, err := shamir.Split(encoded.Bytes(), splitShares, splitThreshold)
+	if err != nil {
+		return errors.Wrapf(err, "failed to split identity key")
+	}
+
+	set, err := shamir.NewSetID()
+	if err != nil {
+		return err
+	}
+
+	for _, share := range shares {
+		armored := &shamir.ArmoredShare{Share: share, Set: set, Threshold: splitThreshold}
+
+		if splitOutputDir == "" {
+			if err := armored.Encode(os.Stdout); err != nil {
+				return errors.Wrapf(err, "failed to write share")
+			}
+			fmt.Println()
+			continue
+		}
+
+		path := filepath.Join(splitOutputDir, fmt.Sprintf("secm-share-%s-%d.txt", set, share.X))
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if err != nil {
+			return errors.Wrapf(err, "failed to create share file")
+		}
+
+		err = armored.Encode(f)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return errors.Wrapf(err, "failed to write share file %s", path)
+		}
+
+		screen.Printf("Share %d written to %s\n", share.X, path)
+	}
+
+	screen.Successf("Identity key split into %d shares, %d of them are required to rebuild it\n", splitShares, splitThreshold)
+	return nil
+}
@@ -0,0 +1,175 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"os"
+	"slices"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+	"github.com/open-zhy/secm/pkg/crypto"
+	"github.com/open-zhy/secm/pkg/errors"
+	"github.com/open-zhy/secm/pkg/screen"
+	"github.com/open-zhy/secm/pkg/workspace"
+	"github.com/spf13/cobra"
+)
+
+var (
+	importFormat       string
+	importSecretFormat string
+)
+
+var importCmd = &cobra.Command{
+	Use:   "import [file]",
+	Short: "Import a secret from a file encrypted outside of secm",
+	Long: `Decrypt an age file encrypted to the workspace identity and store its content as a new secret.
+Only X25519 (ec25519) identities can decrypt age files, their age recipient is printed by 'secm id --age'.
+Files encrypted with a passphrase are detected, the passphrase is prompted or read from
+--secret-passphrase-file or ` + SecretPassphraseEnv + `.`,
+	Args: cobra.ExactArgs(1),
+	RunE: runImport,
+}
+
+func init() {
+	importCmd.Flags().StringVar(&importFormat, "format", FormatAge, "Format of the imported file, supports age")
+	importCmd.Flags().StringVarP(&secretName, "name", "n", "", "Name of the secret (required)")
+	importCmd.Flags().StringVarP(&secretDesc, "description", "d", "", "Description of the secret")
+	importCmd.Flags().StringVarP(&secretType, "type", "t", "", "Type of secret (e.g., api-key, certificate)")
+	importCmd.Flags().StringVar(&secretTags, "tags", "", "Comma-separated list of tags")
+	importCmd.Flags().StringVar(&importSecretFormat, "secret-format", "text", "Format of the secret (text, json, binary)")
+	importCmd.Flags().StringArrayVarP(&recipients, "recipient", "R", nil, "Public key or certificate file of an additional recipient, can be repeated")
+	importCmd.Flags().BoolVar(&secretDedup, "dedup", false, "Reuse the secret holding the same content instead of creating a new one")
+	addSecretPassphraseFlag(importCmd)
+
+	importCmd.MarkFlagRequired("name")
+	importCmd.MarkFlagsMutuallyExclusive("dedup", "recipient")
+	rootCmd.AddCommand(importCmd)
+}
+
+func runImport(cmd *cobra.Command, args []string) error {
+	filePath := args[0]
+
+	if importFormat != FormatAge {
+		return errors.New("unsupported import format: %s", importFormat)
+	}
+
+	ws, err := workspace.Load(profile)
+	if err != nil {
+		return errors.Wrapf(err, "failed to load workspace")
+	}
+
+	lock, err := ws.LockWrites()
+	if err != nil {
+		return err
+	}
+	defer lock.Close()
+
+	self, err := ws.LoadPublicKey()
+	if err != nil {
+		return errors.Wrapf(err, "failed to load identity")
+	}
+
+	encrypters, subjects, err := loadRecipients(ws, self, recipients)
+	if err != nil {
+		return err
+	}
+
+	// the identity key or the passphrase is only asked for when the file needs it
+	identities := []age.Identity{
+		&lazyAgeIdentity{stanzaType: "X25519", load: func() (age.Identity, error) {
+			identity, err := ws.LoadKey()
+			if err != nil {
+				return nil, err
+			}
+			return crypto.NewAgeIdentity(identity)
+		}},
+		&lazyAgeIdentity{stanzaType: "scrypt", load: func() (age.Identity, error) {
+			passphrase, err := readSecretPassphrase(filePath)
+			if err != nil {
+				return nil, err
+			}
+			return age.NewScryptIdentity(string(passphrase))
+		}},
+	}
+
+	// the age file is decrypted as a stream, twice with --dedup, see storeSecret
+	open := func() (io.ReadCloser, error) {
+		f, err := os.Open(filePath)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to read input file")
+		}
+
+		r, err := openAgeFile(f, identities...)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+
+		return struct {
+			io.Reader
+			io.Closer
+		}{r, f}, nil
+	}
+
+	c, err := ws.DefaultCipher()
+	if err != nil {
+		return err
+	}
+
+	s := newSecretFromFlags(importSecretFormat)
+	addRecipientSubjects(s, subjects...)
+	secretId, secretPath, err := storeSecret(ws, s, open, c, encrypters, secretDedup)
+	if err != nil {
+		return err
+	}
+	if secretPath == "" {
+		screen.Infof("Secret with the same content already exists with ID: %s\n", secretId)
+		return nil
+	}
+
+	screen.Successf("Imported secret '%s' with ID: %s\n", secretName, secretId)
+	screen.Successf("Stored at: %s\n", secretPath)
+	return nil
+}
+
+// openAgeFile returns the plaintext of a binary or armored age file
+func openAgeFile(src io.Reader, identities ...age.Identity) (io.Reader, error) {
+	br := bufio.NewReader(src)
+	if prefix, _ := br.Peek(len(armor.Header)); bytes.Equal(prefix, []byte(armor.Header)) {
+		src = armor.NewReader(br)
+	} else {
+		src = br
+	}
+
+	r, err := age.Decrypt(src, identities...)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to decrypt age file")
+	}
+
+	return r, nil
+}
+
+// lazyAgeIdentity loads an identity the first time a file has a stanza of its type
+type lazyAgeIdentity struct {
+	stanzaType string
+	load       func() (age.Identity, error)
+	identity   age.Identity
+}
+
+func (i *lazyAgeIdentity) Unwrap(stanzas []*age.Stanza) ([]byte, error) {
+	if !slices.ContainsFunc(stanzas, func(s *age.Stanza) bool { return s.Type == i.stanzaType }) {
+		return nil, age.ErrIncorrectIdentity
+	}
+
+	if i.identity == nil {
+		identity, err := i.load()
+		if err != nil {
+			return nil, err
+		}
+		i.identity = identity
+	}
+
+	return i.identity.Unwrap(stanzas)
+}
@@ -1,59 +1,240 @@
 package cmd
 
 import (
+	"bytes"
+	"crypto/x509"
 	"fmt"
-	"os"
+	"path/filepath"
 	"strings"
 
+	"github.com/open-zhy/secm/pkg/crypto"
 	"github.com/open-zhy/secm/pkg/id"
 	"github.com/open-zhy/secm/pkg/screen"
 	"github.com/open-zhy/secm/pkg/workspace"
 	"github.com/spf13/cobra"
 )
 
+var (
+	signingKeyType string
+	protectKey     bool
+	profileCipher  string
+	fromSSHKey     string
+	keyProvider    string
+	providerKey    string
+	identityCert   string
+	identityKey    string
+	trustAnchors   string
+)
+
 var initCmd = &cobra.Command{
 	Use:   "init",
 	Short: "Initialize secm workspace and generate identity key",
 	Long: `Initialize the secm workspace in ~/.secm directory and generate an RSA identity key
-for encrypting and decrypting secrets.`,
+for encrypting and decrypting secrets, along with a signing key proving who created them.
+The signing key is never protected by a passphrase, --protect only applies to the identity key:
+secrets are signed without prompting, including by commands such as 'secm meta set' which do not
+need the identity key.
+With --from-ssh, an existing OpenSSH private key (ed25519, rsa or ecdsa) is used as the identity key
+instead, its passphrase if any is prompted or read from --passphrase-file or ` + PassphraseEnv + `.
+With --provider, the identity key is held by the external key provider secm-keyprovider-<name>
+and identity.key only references the key given with --provider-key.
+With --cert, the identity is the key of an X.509 certificate issued by your CA, the private key
+is read from --key (or held by --provider), and the certificate is what others use as recipient.
+With --trust-anchors, recipients given as certificates are validated against this CA bundle.`,
 	RunE: runInit,
 }
 
 func init() {
 	rootCmd.AddCommand(initCmd)
 
-	initCmd.PersistentFlags().StringVarP(&keyType, "type", "t", "rsa", "Key type, supports rsa, p256, p384, p521, ec25519")
+	initCmd.PersistentFlags().StringVarP(&keyType, "type", "t", "rsa", "Key type, supports rsa, p256, p384, p521, ec25519, ed25519, mlkem768-x25519")
 	initCmd.PersistentFlags().IntVar(&keySize, "size", 2048, "Key size, take effect for RSA key types only")
+	initCmd.PersistentFlags().BoolVar(&protectKey, "protect", false, "Encrypt the identity key with a passphrase, prompted or read from --passphrase-file or "+PassphraseEnv+", the signing key is left unencrypted")
+	initCmd.PersistentFlags().StringVar(&signingKeyType, "signing-type", "ed25519", "Signing key type, supports ed25519, p256")
+	initCmd.PersistentFlags().StringVar(&fromSSHKey, "from-ssh", "", "OpenSSH private key file to use as the identity key, e.g. ~/.ssh/id_ed25519")
+	initCmd.PersistentFlags().StringVar(&keyProvider, "provider", "", "Name of the key provider holding the identity key, run as secm-keyprovider-<name>")
+	initCmd.PersistentFlags().StringVar(&providerKey, "provider-key", "", "Reference of the identity key in the key provider, e.g. a KMS key ID")
+	initCmd.PersistentFlags().StringVar(&identityCert, "cert", "", "X.509 certificate (PEM, optionally followed by its intermediates) of the identity key")
+	initCmd.PersistentFlags().StringVar(&identityKey, "key", "", "PEM private key file (PKCS#1, PKCS#8 or SEC1) to use as the identity key")
+	initCmd.PersistentFlags().StringVar(&trustAnchors, "trust-anchors", "", "PEM bundle of the CA certificates recipient certificates must chain up to")
+	initCmd.PersistentFlags().StringVar(&profileCipher, "cipher", "", "Default cipher of the secret data, supports aes-256-gcm (default), chacha20-poly1305, xchacha20-poly1305")
 }
 
 func runInit(cmd *cobra.Command, args []string) error {
+	if profileCipher != "" {
+		if _, err := crypto.ParseCipher(profileCipher); err != nil {
+			return err
+		}
+	}
+
+	// the SSH key is read before anything is written, a wrong passphrase leaves no workspace behind
+	var identity id.KeyPackageIdentity
+	if fromSSHKey != "" {
+		sshIdentity, err := id.LoadSSHKeyFile(fromSSHKey)
+		if err != nil {
+			return fmt.Errorf("failed to load SSH key: %w", err)
+		}
+		identity = sshIdentity
+	}
+
+	if keyProvider != "" {
+		if fromSSHKey != "" {
+			return fmt.Errorf("--provider and --from-ssh cannot be used together")
+		}
+		if protectKey {
+			return fmt.Errorf("keys held by a key provider cannot be protected with a passphrase")
+		}
+		if providerKey == "" {
+			return fmt.Errorf("--provider-key is required with --provider")
+		}
+
+		providerIdentity, err := id.NewProviderIdKey(keyProvider, []byte(providerKey))
+		if err != nil {
+			return fmt.Errorf("failed to load provider key: %w", err)
+		}
+		identity = providerIdentity
+	}
+
+	if identityKey != "" {
+		if identity != nil {
+			return fmt.Errorf("--key cannot be used with --from-ssh or --provider")
+		}
+
+		keyIdentity, err := id.LoadKeyFile(identityKey)
+		if err != nil {
+			return fmt.Errorf("failed to load identity key: %w", err)
+		}
+		identity = keyIdentity
+	}
+
+	var chain []*x509.Certificate
+	if identityCert != "" {
+		if identity == nil {
+			return fmt.Errorf("--cert requires the key of the certificate, given with --key or --provider")
+		}
+
+		var err error
+		chain, err = loadIdentityCertificate(identityCert, identity)
+		if err != nil {
+			return err
+		}
+	}
+
+	if trustAnchors != "" {
+		abs, err := filepath.Abs(trustAnchors)
+		if err != nil {
+			return err
+		}
+		trustAnchors = abs
+
+		roots, err := id.LoadCertPoolFile(trustAnchors)
+		if err != nil {
+			return err
+		}
+		// the certificate of the identity is what others will validate
+		if chain != nil {
+			if _, err := id.VerifyRecipientCertificate(chain, roots); err != nil {
+				return err
+			}
+		}
+	}
+
+	// the keys are generated before anything is written, a wrong key type leaves no
+	// workspace behind
+	if identity == nil {
+		var err error
+		identity, err = id.GenerateKey(
+			id.GenerateKeyOpts{
+				Type: keyType,
+				Size: &keySize,
+			},
+		)
+		if err != nil {
+			return fmt.Errorf("failed to generate key: %w", err)
+		}
+	}
+
+	signingKey, err := id.GenerateSigningKey(id.GenerateSigningKeyOpts{Type: signingKeyType})
+	if err != nil {
+		return fmt.Errorf("failed to generate signing key: %w", err)
+	}
+
+	var passphrase []byte
+	if protectKey {
+		p, err := readNewPassphrase(passphraseFile, "--passphrase-file", PassphraseEnv)
+		if err != nil {
+			return err
+		}
+		passphrase = p
+	}
+
 	// Initialize workspace
 	ws, err := workspace.Initialize(profile)
 	if err != nil {
 		return fmt.Errorf("failed to initialize workspace: %w", err)
 	}
 
-	identity, err := id.GenerateKey(
-		id.GenerateKeyOpts{
-			Type: keyType,
-			Size: &keySize,
-		},
-	)
-	if err != nil {
-		return fmt.Errorf("failed to generate key: %w", err)
+	if err := ws.SaveKey(identity, passphrase); err != nil {
+		return err
 	}
 
-	keyFile, err := os.OpenFile(ws.KeyPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
-	if err != nil {
-		return fmt.Errorf("failed to create key file: %w", err)
+	if err := ws.SaveSigningKey(signingKey); err != nil {
+		return fmt.Errorf("failed to create signing key: %w", err)
 	}
-	defer keyFile.Close()
 
-	if err := identity.Encode(keyFile); err != nil {
-		return fmt.Errorf("failed to write key file: %w", err)
+	if chain != nil {
+		if err := ws.SaveCertificate(chain); err != nil {
+			return err
+		}
+	}
+
+	if profileCipher != "" || trustAnchors != "" {
+		if err := ws.SaveConfig(&workspace.Config{Cipher: profileCipher, TrustAnchors: trustAnchors}); err != nil {
+			return err
+		}
 	}
 
 	screen.Printf("Initialized secm workspace at %s\n", ws.RootDir)
-	screen.Printf("Generated %s identity key at %s\n", strings.ToUpper(keyType), ws.KeyPath)
+	if identityCert != "" {
+		screen.Printf("Identity certificate of %s at %s\n", chain[0].Subject, ws.CertPath)
+	}
+	if identityKey != "" {
+		screen.Printf("Imported identity key %s at %s\n", identityKey, ws.KeyPath)
+	} else if fromSSHKey != "" {
+		screen.Printf("Imported SSH key %s as identity key at %s\n", fromSSHKey, ws.KeyPath)
+	} else if keyProvider != "" {
+		screen.Printf("Identity key held by key provider %s, referenced at %s\n", keyProvider, ws.KeyPath)
+	} else {
+		screen.Printf("Generated %s identity key at %s\n", strings.ToUpper(keyType), ws.KeyPath)
+	}
+	if protectKey {
+		screen.Printf("Identity key is protected by a passphrase\n")
+	}
+	screen.Printf("Generated %s signing key at %s\n", strings.ToUpper(signingKeyType), ws.SigningKeyPath)
+	if profileCipher != "" {
+		screen.Printf("Secrets are encrypted with %s by default\n", profileCipher)
+	}
+	if trustAnchors != "" {
+		screen.Printf("Recipient certificates are validated against %s\n", trustAnchors)
+	}
 	return nil
 }
+
+// loadIdentityCertificate loads the certificate chain of the identity, the leaf
+// certificate must be issued for its key
+func loadIdentityCertificate(path string, identity id.KeyPackageIdentity) ([]*x509.Certificate, error) {
+	chain, err := id.LoadCertificateFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load certificate: %w", err)
+	}
+
+	certPub, err := id.CertificatePublicKey(chain[0])
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(certPub.Bytes(), identity.PublicKey().Bytes()) {
+		return nil, fmt.Errorf("certificate of %s is not issued for the identity key", chain[0].Subject)
+	}
+
+	return chain, nil
+}
@@ -7,12 +7,16 @@ import (
 	"strings"
 
 	"github.com/open-zhy/secm/pkg/errors"
+	"github.com/open-zhy/secm/pkg/id"
 	"github.com/open-zhy/secm/pkg/screen"
 	"github.com/open-zhy/secm/pkg/secret"
 	"github.com/open-zhy/secm/pkg/workspace"
 	"github.com/spf13/cobra"
 )
 
+// expiredMark follows the name of expired secrets
+const expiredMark = " (expired)"
+
 var (
 	showTags bool
 	showDesc bool
@@ -57,7 +61,7 @@ func runList(cmd *cobra.Command, args []string) error {
 	if showTags {
 		headers = append(headers, "Tags")
 	}
-	headers = append(headers, "Created At")
+	headers = append(headers, "Created At", "Modified At")
 
 	// Calculate column widths
 	widths := map[string]int{
@@ -67,6 +71,7 @@ func runList(cmd *cobra.Command, args []string) error {
 		"Description": 30,
 		"Tags":        30,
 		"Created At":  20,
+		"Modified At": 20,
 	}
 
 	// Print headers
@@ -77,7 +82,14 @@ func runList(cmd *cobra.Command, args []string) error {
 	if showTags {
 		format += fmt.Sprintf("  %%-%ds", widths["Tags"])
 	}
-	format += fmt.Sprintf("  %%-%ds\n", widths["Created At"])
+	format += fmt.Sprintf("  %%-%ds  %%-%ds\n", widths["Created At"], widths["Modified At"])
+
+	// tells which identity the secrets are encrypted to
+	if pub, err := ws.LoadPublicKey(); err == nil {
+		if fingerprint, err := id.PublicKeyFingerprint(pub); err == nil {
+			screen.Printf("Identity: %s\n\n", fingerprint)
+		}
+	}
 
 	screen.Println("Available secrets:")
 	headerInterface := make([]interface{}, len(headers))
@@ -101,9 +113,13 @@ func runList(cmd *cobra.Command, args []string) error {
 
 		// Prepare values
 		id := strings.TrimSuffix(entry.Name(), ".yml")
+		name := truncate(s.Name, widths["Name"])
+		if s.IsExpired() {
+			name = truncate(s.Name, widths["Name"]-len(expiredMark)) + expiredMark
+		}
 		values := []interface{}{
 			truncate(id, widths["ID"]),
-			truncate(s.Name, widths["Name"]),
+			name,
 			truncate(s.Type, widths["Type"]),
 		}
 		if showDesc {
@@ -112,7 +128,7 @@ func runList(cmd *cobra.Command, args []string) error {
 		if showTags {
 			values = append(values, truncate(strings.Join(s.Tags, ", "), widths["Tags"]))
 		}
-		values = append(values, s.CreatedAt.Format("2006-01-02 15:04:05"))
+		values = append(values, s.CreatedAt.Format("2006-01-02 15:04:05"), s.LastModified().Format("2006-01-02 15:04:05"))
 
 		screen.Printf(format, values...)
 	}
@@ -121,7 +137,7 @@ func runList(cmd *cobra.Command, args []string) error {
 }
 
 func calculateLineWidth(widths map[string]int, showDesc, showTags bool) int {
-	width := widths["ID"] + widths["Name"] + widths["Type"] + widths["Created At"] + 8 // 8 for spacing
+	width := widths["ID"] + widths["Name"] + widths["Type"] + widths["Created At"] + widths["Modified At"] + 10 // 10 for spacing
 	if showDesc {
 		width += widths["Description"] + 2
 	}
@@ -0,0 +1,137 @@
+package cmd
+
+import (
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/open-zhy/secm/pkg/errors"
+	"github.com/open-zhy/secm/pkg/screen"
+	"github.com/open-zhy/secm/pkg/secret"
+	"github.com/open-zhy/secm/pkg/workspace"
+	"github.com/spf13/cobra"
+)
+
+var (
+	metaName       string
+	metaDesc       string
+	metaType       string
+	metaFormat     string
+	metaAddTags    []string
+	metaRemoveTags []string
+)
+
+var metaCmd = &cobra.Command{
+	Use:   "meta",
+	Short: "Manage the metadata of secrets",
+}
+
+var metaSetCmd = &cobra.Command{
+	Use:   "set [secret-id]",
+	Short: "Change the metadata of a secret",
+	Long: `Change the name, description, type, tags or format of a secret. The encrypted data is not
+touched and the identity key is not needed, the secret is signed again with the workspace signing key.
+The format is bound to the encrypted data of secrets created since bindings exist, it can only be
+changed on older secrets.`,
+	Args: cobra.ExactArgs(1),
+	RunE: runMetaSet,
+}
+
+func init() {
+	metaSetCmd.Flags().StringVarP(&metaName, "name", "n", "", "New name of the secret")
+	metaSetCmd.Flags().StringVarP(&metaDesc, "description", "d", "", "New description of the secret")
+	metaSetCmd.Flags().StringVarP(&metaType, "type", "t", "", "New type of the secret (e.g., api-key, certificate)")
+	metaSetCmd.Flags().StringVarP(&metaFormat, "format", "f", "", "New format of the secret (text, json, binary)")
+	metaSetCmd.Flags().StringArrayVar(&metaAddTags, "add-tag", nil, "Tag to add, can be repeated")
+	metaSetCmd.Flags().StringArrayVar(&metaRemoveTags, "remove-tag", nil, "Tag to remove, can be repeated")
+	metaCmd.AddCommand(metaSetCmd)
+	rootCmd.AddCommand(metaCmd)
+}
+
+func runMetaSet(cmd *cobra.Command, args []string) error {
+	secretID := args[0]
+
+	ws, err := workspace.Load(profile)
+	if err != nil {
+		return errors.Wrapf(err, "failed to load workspace")
+	}
+
+	lock, err := ws.LockWrites()
+	if err != nil {
+		return err
+	}
+	defer lock.Close()
+
+	secretPath := ws.SecretPath(secretID + ".yml")
+	s, err := secret.Load(secretPath)
+	if err != nil {
+		return errors.Wrapf(err, "failed to load secret")
+	}
+
+	flags := cmd.Flags()
+	if !slices.ContainsFunc([]string{"name", "description", "type", "format", "add-tag", "remove-tag"}, flags.Changed) {
+		return errors.New("nothing to change, see 'secm meta set --help'")
+	}
+
+	// the signatures cover the metadata, a signature of another key is replaced
+	signingKey, created, err := ws.EnsureSigningKey()
+	if err != nil {
+		return errors.Wrapf(err, "failed to load signing key")
+	}
+	if created {
+		screen.Infof("Generated signing key at %s\n", ws.SigningKeyPath)
+	}
+	foreign := false
+	if s.Signature != nil {
+		_, err := ws.VerifySecret(secretID, s, signingKey.VerifyingKey())
+		foreign = err != nil
+	}
+
+	if flags.Changed("name") {
+		if strings.TrimSpace(metaName) == "" {
+			return errors.New("the name of a secret cannot be empty")
+		}
+		s.Name = metaName
+	}
+	if flags.Changed("description") {
+		s.Description = metaDesc
+	}
+	if flags.Changed("type") {
+		s.Type = metaType
+	}
+	if flags.Changed("format") && metaFormat != s.Format {
+		// every version is bound with the format, changing it would make them undecryptable
+		for _, v := range s.Versions() {
+			if v.Binding != secret.BindingNone {
+				return errors.New("the format of the secret is bound to its encrypted data and cannot be changed")
+			}
+		}
+		s.Format = metaFormat
+	}
+	for _, tag := range metaRemoveTags {
+		s.Tags = slices.DeleteFunc(s.Tags, func(t string) bool { return t == strings.TrimSpace(tag) })
+	}
+	for _, tag := range metaAddTags {
+		if tag = strings.TrimSpace(tag); tag != "" && !slices.Contains(s.Tags, tag) {
+			s.Tags = append(s.Tags, tag)
+		}
+	}
+	if len(s.Tags) == 0 {
+		s.Tags = nil
+	}
+
+	if err := ws.SignVersions(secretID, s, signingKey); err != nil {
+		return errors.Wrapf(err, "failed to sign secret")
+	}
+
+	s.ModifiedAt = time.Now()
+	if err := s.Save(secretPath); err != nil {
+		return errors.Wrapf(err, "failed to save secret")
+	}
+
+	if foreign {
+		screen.Printf("The secret was signed by another key, it is now signed by the workspace signing key\n")
+	}
+	screen.Successf("Updated metadata of secret '%s'\n", s.Name)
+	return nil
+}
@@ -0,0 +1,143 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"testing"
+
+	"github.com/open-zhy/secm/pkg/crypto"
+	"github.com/open-zhy/secm/pkg/id"
+	"github.com/open-zhy/secm/pkg/secret"
+)
+
+// setMetaFlags sets the flags of `secm meta set`, they are reset at the end of the test
+func setMetaFlags(t *testing.T, values map[string][]string) {
+	t.Helper()
+	flags := metaSetCmd.Flags()
+	for name, vs := range values {
+		for _, v := range vs {
+			if err := flags.Set(name, v); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	t.Cleanup(func() {
+		metaName, metaDesc, metaType, metaFormat = "", "", "", ""
+		metaAddTags, metaRemoveTags = nil, nil
+		for name := range values {
+			flags.Lookup(name).Changed = false
+		}
+	})
+}
+
+func TestMetaSetKeepsCiphertext(t *testing.T) {
+	ws := newTestWorkspace(t)
+	pub, err := ws.LoadPublicKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	content := func(data string) func() (io.ReadCloser, error) {
+		return func() (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader([]byte(data))), nil
+		}
+	}
+
+	s := secret.New("db", nil)
+	s.Tags = []string{"staging"}
+	secretID, secretPath, err := storeSecret(ws, s, content("v1"), crypto.DefaultCipher, []id.Encrypter{pub}, false)
+	if err != nil {
+		t.Fatalf("storeSecret: %v", err)
+	}
+	if err := updateSecret(ws, secretID, s, content("v2")); err != nil {
+		t.Fatalf("updateSecret: %v", err)
+	}
+	blobs := map[string][]byte{}
+	for _, v := range s.Versions() {
+		data, err := os.ReadFile(ws.BlobPath(v.Blob))
+		if err != nil {
+			t.Fatal(err)
+		}
+		blobs[v.Blob] = data
+	}
+
+	// the identity key is not needed
+	hidden := ws.KeyPath + ".hidden"
+	if err := os.Rename(ws.KeyPath, hidden); err != nil {
+		t.Fatal(err)
+	}
+	setMetaFlags(t, map[string][]string{
+		"name":       {"Prod DB"},
+		"type":       {"password"},
+		"add-tag":    {"prod"},
+		"remove-tag": {"staging"},
+	})
+	if err := runMetaSet(metaSetCmd, []string{secretID}); err != nil {
+		t.Fatalf("meta set: %v", err)
+	}
+	if err := os.Rename(hidden, ws.KeyPath); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err = secret.Load(secretPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Name != "Prod DB" || s.Type != "password" || !slices.Equal(s.Tags, []string{"prod"}) {
+		t.Fatalf("metadata not changed: name %q, type %q, tags %v", s.Name, s.Type, s.Tags)
+	}
+	if s.ModifiedAt.IsZero() {
+		t.Fatal("modification time not recorded")
+	}
+
+	signingKey, err := ws.LoadSigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range s.Versions() {
+		data, err := os.ReadFile(ws.BlobPath(v.Blob))
+		if err != nil || !bytes.Equal(data, blobs[v.Blob]) {
+			t.Fatalf("data of version %d changed: %v", v.Number, err)
+		}
+
+		view, err := s.AtVersion(v.Number)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := ws.VerifySecret(secretID, view, signingKey.VerifyingKey()); err != nil {
+			t.Fatalf("VerifySecret of version %d: %v", v.Number, err)
+		}
+		got, err := ws.DecryptSecret(secretID, view)
+		if err != nil {
+			t.Fatalf("DecryptSecret of version %d: %v", v.Number, err)
+		}
+		if want := fmt.Sprintf("v%d", v.Number); string(got.Bytes()) != want {
+			t.Fatalf("version %d holds %q, want %q", v.Number, got.Bytes(), want)
+		}
+		got.Destroy()
+	}
+}
+
+func TestMetaSetBoundFormat(t *testing.T) {
+	ws := newTestWorkspace(t)
+	pub, err := ws.LoadPublicKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	open := func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader([]byte(`{"user":"admin"}`))), nil
+	}
+	s := secret.New("config", nil)
+	s.Format = "json"
+	secretID, _, err := storeSecret(ws, s, open, crypto.DefaultCipher, []id.Encrypter{pub}, false)
+	if err != nil {
+		t.Fatalf("storeSecret: %v", err)
+	}
+
+	setMetaFlags(t, map[string][]string{"format": {"text"}})
+	if err := runMetaSet(metaSetCmd, []string{secretID}); err == nil {
+		t.Fatal("meta set changed the bound format of a secret")
+	}
+}
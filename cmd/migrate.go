@@ -0,0 +1,107 @@
+package cmd
+
+import (
+	"os"
+	"strings"
+
+	"github.com/open-zhy/secm/pkg/errors"
+	"github.com/open-zhy/secm/pkg/screen"
+	"github.com/open-zhy/secm/pkg/secret"
+	"github.com/open-zhy/secm/pkg/workspace"
+	"github.com/spf13/cobra"
+)
+
+var migrateCmd = &cobra.Command{
+	Use:   "migrate [secret-id...]",
+	Short: "Upgrade secrets to the current key wrapping algorithm",
+	Long: `Upgrade secrets whose data key is wrapped with a deprecated algorithm, such as RSA PKCS#1 v1.5
+or ECDH with a truncated shared secret, to the current algorithm of the identity (RSA-OAEP with SHA-256
+for RSA keys, ECDH with HKDF-SHA256 for elliptic curve keys).
+Only the wrapped data key is rewritten, the encrypted payload is left untouched.
+Data keys wrapped with RSA PKCS#1 v1.5 are not unwrapped by any other command, such secrets
+have to be migrated before they can be read.
+All secrets of the workspace are migrated when no ID is given.`,
+	RunE: runMigrate,
+}
+
+func init() {
+	rootCmd.AddCommand(migrateCmd)
+}
+
+func runMigrate(cmd *cobra.Command, args []string) error {
+	// Load workspace
+	ws, err := workspace.Load(profile)
+	if err != nil {
+		return errors.Wrapf(err, "failed to load workspace")
+	}
+
+	lock, err := ws.LockWrites()
+	if err != nil {
+		return err
+	}
+	defer lock.Close()
+
+	secretIDs := args
+	if len(secretIDs) == 0 {
+		secretIDs, err = listSecretIDs(ws)
+		if err != nil {
+			return err
+		}
+	}
+
+	migrated, failed := 0, 0
+	for _, secretID := range secretIDs {
+		secretPath := ws.SecretPath(secretID + ".yml")
+		s, err := secret.Load(secretPath)
+		if err != nil {
+			screen.Errorf("%s: failed to load secret: %s\n", secretID, err)
+			failed++
+			continue
+		}
+
+		changed, err := ws.UpgradeSecret(secretID, s)
+		if err != nil {
+			screen.Errorf("%s: failed to migrate secret: %s\n", secretID, err)
+			failed++
+			continue
+		}
+
+		if !changed {
+			continue
+		}
+
+		if err := s.Save(secretPath); err != nil {
+			screen.Errorf("%s: failed to save secret: %s\n", secretID, err)
+			failed++
+			continue
+		}
+
+		screen.Successf("Migrated secret '%s' (%s)\n", s.Name, secretID)
+		migrated++
+	}
+
+	screen.Printf("%d secret(s) migrated, %d already up to date\n", migrated, len(secretIDs)-migrated-failed)
+	if failed > 0 {
+		return errors.New("%d secret(s) could not be migrated", failed)
+	}
+
+	return nil
+}
+
+// listSecretIDs returns the IDs of all the secrets of the workspace
+func listSecretIDs(ws *workspace.Workspace) ([]string, error) {
+	entries, err := os.ReadDir(ws.SecretsDir)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read secrets directory")
+	}
+
+	var secretIDs []string
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".yml") {
+			continue
+		}
+		secretIDs = append(secretIDs, strings.TrimSuffix(entry.Name(), ".yml"))
+	}
+
+	return secretIDs, nil
+}
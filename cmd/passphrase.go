@@ -0,0 +1,157 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+
+	"github.com/open-zhy/secm/pkg/id"
+	"github.com/open-zhy/secm/pkg/workspace"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+const (
+	// PassphraseEnv holds the passphrase of the identity key
+	PassphraseEnv = "SECM_PASSPHRASE"
+	// NewPassphraseEnv holds the passphrase to set on the identity key
+	NewPassphraseEnv = "SECM_NEW_PASSPHRASE"
+	// SecretPassphraseEnv holds the passphrase of secrets encrypted with a passphrase
+	SecretPassphraseEnv = "SECM_SECRET_PASSPHRASE"
+)
+
+var (
+	passphraseFile       string
+	secretPassphraseFile string
+)
+
+// cachedPassphrases avoids prompting several times for the same key
+var cachedPassphrases = map[string][]byte{}
+
+func init() {
+	rootCmd.PersistentFlags().StringVar(&passphraseFile, "passphrase-file", "", "File holding the passphrase of the identity key, "+PassphraseEnv+" can be used instead")
+	id.SetPassphraseReader(readPassphrase)
+	workspace.SetSecretPassphraseReader(readSecretPassphrase)
+}
+
+// addSecretPassphraseFlag registers --secret-passphrase-file on commands handling passphrase secrets
+func addSecretPassphraseFlag(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&secretPassphraseFile, "secret-passphrase-file", "", "File holding the passphrase of the secret, "+SecretPassphraseEnv+" can be used instead")
+}
+
+// readSecretPassphrase returns the passphrase of a passphrase secret, taken from
+// --secret-passphrase-file, the environment or prompted on the terminal
+func readSecretPassphrase(secretID string) ([]byte, error) {
+	cacheKey := "secret:" + secretID
+	if passphrase, ok := cachedPassphrases[cacheKey]; ok {
+		return passphrase, nil
+	}
+
+	passphrase, err := passphraseFrom(secretPassphraseFile, SecretPassphraseEnv)
+	if err != nil {
+		return nil, err
+	}
+
+	if passphrase == nil {
+		passphrase, err = promptPassphrase(fmt.Sprintf("Enter passphrase for secret %s: ", secretID), "--secret-passphrase-file", SecretPassphraseEnv)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	cachedPassphrases[cacheKey] = passphrase
+	return passphrase, nil
+}
+
+// readPassphrase returns the passphrase of the identity key, taken from
+// --passphrase-file, the environment or prompted on the terminal
+func readPassphrase(keyPath string) ([]byte, error) {
+	if passphrase, ok := cachedPassphrases[keyPath]; ok {
+		return passphrase, nil
+	}
+
+	passphrase, err := passphraseFrom(passphraseFile, PassphraseEnv)
+	if err != nil {
+		return nil, err
+	}
+
+	if passphrase == nil {
+		passphrase, err = promptPassphrase(fmt.Sprintf("Enter passphrase for %s: ", keyPath), "--passphrase-file", PassphraseEnv)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	cachedPassphrases[keyPath] = passphrase
+	return passphrase, nil
+}
+
+// readNewPassphrase returns the passphrase to protect a key with, taken from
+// the file given with flag, the environment or prompted twice on the terminal
+func readNewPassphrase(file string, flag string, env string) ([]byte, error) {
+	passphrase, err := passphraseFrom(file, env)
+	if err != nil || passphrase != nil {
+		return passphrase, err
+	}
+
+	passphrase, err = promptPassphrase("Enter new passphrase: ", flag, env)
+	if err != nil {
+		return nil, err
+	}
+
+	confirm, err := promptPassphrase("Confirm new passphrase: ", flag, env)
+	if err != nil {
+		return nil, err
+	}
+
+	if !bytes.Equal(passphrase, confirm) {
+		return nil, fmt.Errorf("passphrases do not match")
+	}
+
+	return passphrase, nil
+}
+
+// passphraseFrom reads the passphrase from file or the env variable,
+// it returns nil when none of them is set
+func passphraseFrom(file string, env string) ([]byte, error) {
+	if file != "" {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read passphrase file: %w", err)
+		}
+
+		passphrase := bytes.TrimRight(data, "\r\n")
+		if len(passphrase) == 0 {
+			return nil, fmt.Errorf("passphrase file %s is empty", file)
+		}
+		return passphrase, nil
+	}
+
+	if value, ok := os.LookupEnv(env); ok && value != "" {
+		return []byte(value), nil
+	}
+
+	return nil, nil
+}
+
+// promptPassphrase reads a passphrase on the terminal without echo, flag and env
+// are the alternatives suggested when there is no terminal
+func promptPassphrase(prompt string, flag string, env string) ([]byte, error) {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return nil, fmt.Errorf("%w, use %s or %s", id.ErrPassphraseRequired, flag, env)
+	}
+
+	fmt.Fprint(os.Stderr, prompt)
+	passphrase, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read passphrase: %w", err)
+	}
+
+	if len(passphrase) == 0 {
+		return nil, fmt.Errorf("passphrase cannot be empty")
+	}
+
+	return passphrase, nil
+}
@@ -0,0 +1,80 @@
+package cmd
+
+import (
+	"github.com/open-zhy/secm/pkg/errors"
+	"github.com/open-zhy/secm/pkg/screen"
+	"github.com/open-zhy/secm/pkg/secret"
+	"github.com/open-zhy/secm/pkg/workspace"
+	"github.com/spf13/cobra"
+)
+
+var purgeExpired bool
+
+var purgeCmd = &cobra.Command{
+	Use:   "purge",
+	Short: "Delete the secrets which cannot be read anymore",
+	Long: `Delete the secrets of the workspace past their expiry, set with 'secm create --expires',
+or whose reads are used up, set with 'secm create --max-reads', along with the data of all their
+versions. A secret is normally deleted by its last read, unless the command was interrupted.`,
+	Args: cobra.NoArgs,
+	RunE: runPurge,
+}
+
+func init() {
+	purgeCmd.Flags().BoolVar(&purgeExpired, "expired", false, "Delete expired secrets and secrets without reads left")
+	rootCmd.AddCommand(purgeCmd)
+}
+
+func runPurge(cmd *cobra.Command, args []string) error {
+	if !purgeExpired {
+		return errors.New("nothing to purge, use --expired")
+	}
+
+	ws, err := workspace.Load(profile)
+	if err != nil {
+		return errors.Wrapf(err, "failed to load workspace")
+	}
+
+	lock, err := ws.LockWrites()
+	if err != nil {
+		return err
+	}
+	defer lock.Close()
+
+	secretIDs, err := listSecretIDs(ws)
+	if err != nil {
+		return err
+	}
+
+	purged, failed := 0, 0
+	for _, secretID := range secretIDs {
+		secretPath := ws.SecretPath(secretID + ".yml")
+		s, err := secret.Load(secretPath)
+		if err != nil {
+			screen.Errorf("%s: failed to load secret: %s\n", secretID, err)
+			failed++
+			continue
+		}
+
+		reason := ws.CheckPolicy(secretID, s)
+		if reason == nil {
+			continue
+		}
+
+		if err := ws.RemoveSecret(secretPath, s); err != nil {
+			screen.Errorf("%s: %s\n", secretID, err)
+			failed++
+			continue
+		}
+
+		screen.Successf("Deleted secret '%s' (%s): %s\n", s.Name, secretID, reason)
+		purged++
+	}
+
+	screen.Printf("%d secret(s) deleted\n", purged)
+	if failed > 0 {
+		return errors.New("%d secret(s) could not be purged", failed)
+	}
+
+	return nil
+}
@@ -0,0 +1,55 @@
+package cmd
+
+import (
+	"os"
+	"slices"
+
+	"github.com/open-zhy/secm/pkg/errors"
+	"github.com/open-zhy/secm/pkg/id"
+	"github.com/open-zhy/secm/pkg/secret"
+	"github.com/open-zhy/secm/pkg/workspace"
+)
+
+// loadRecipientKey loads the public key of a recipient, checked against --expect-fingerprint.
+// A certificate is validated against the trust anchors of the profile first, its subject
+// is returned along with its key.
+func loadRecipientKey(ws *workspace.Workspace, path string) (id.PublicKey, string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, "", errors.Wrapf(err, "failed to read recipient %s", path)
+	}
+
+	var pub id.PublicKey
+	var subject string
+	if id.IsCertificate(data) {
+		chain, err := id.ParseCertificates(data)
+		if err != nil {
+			return nil, "", errors.Wrapf(err, "failed to load recipient %s", path)
+		}
+
+		pub, subject, err = ws.VerifyRecipient(chain)
+		if err != nil {
+			return nil, "", errors.Wrapf(err, "refusing recipient %s", path)
+		}
+	} else {
+		pub, err = id.ParsePublicKey(data)
+		if err != nil {
+			return nil, "", errors.Wrapf(err, "failed to load recipient %s", path)
+		}
+	}
+
+	if err := id.CheckFingerprint(pub, expectFingerprints...); err != nil {
+		return nil, "", errors.Wrapf(err, "refusing recipient %s", path)
+	}
+
+	return pub, subject, nil
+}
+
+// addRecipientSubjects records the certificate subjects on the secret, once each
+func addRecipientSubjects(s *secret.Secret, subjects ...string) {
+	for _, subject := range subjects {
+		if subject != "" && !slices.Contains(s.Recipients, subject) {
+			s.Recipients = append(s.Recipients, subject)
+		}
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"os"
 	"path/filepath"
 
+	"github.com/open-zhy/secm/pkg/crypto"
 	"github.com/open-zhy/secm/pkg/plugin"
 	"github.com/open-zhy/secm/pkg/screen"
 	"github.com/spf13/cobra"
@@ -31,6 +32,11 @@ func init() {
 }
 
 func Execute() {
+	// Keep decrypted secrets and keys out of core dumps, plugins run in this process too
+	if err := crypto.HardenProcess(); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	}
+
 	// Load plugins before executing any command
 	manager := plugin.NewManager(pluginsDir)
 	if err := manager.LoadAll(rootCmd); err != nil {
@@ -0,0 +1,76 @@
+package cmd
+
+import (
+	"github.com/open-zhy/secm/pkg/errors"
+	"github.com/open-zhy/secm/pkg/id"
+	"github.com/open-zhy/secm/pkg/screen"
+	"github.com/open-zhy/secm/pkg/secret"
+	"github.com/open-zhy/secm/pkg/workspace"
+	"github.com/spf13/cobra"
+)
+
+var shareRecipients []string
+
+var shareCmd = &cobra.Command{
+	Use:   "share [secret-id]",
+	Short: "Share a secret with additional recipients",
+	Long: `Share a secret by wrapping its data key for each public key given with --recipient.
+The encrypted payload is not modified, every recipient is able to decrypt the same secret file.
+Recipients given as X.509 certificates are validated against the trust anchors of the profile
+(chain, validity period, key usage) and their subject is recorded on the secret.`,
+	Args: cobra.ExactArgs(1),
+	RunE: runShare,
+}
+
+func init() {
+	shareCmd.Flags().StringArrayVarP(&shareRecipients, "recipient", "R", nil, "Public key or certificate file of the recipient, can be repeated")
+	shareCmd.MarkFlagRequired("recipient")
+	addExpectFingerprintFlag(shareCmd)
+	rootCmd.AddCommand(shareCmd)
+}
+
+func runShare(cmd *cobra.Command, args []string) error {
+	secretID := args[0]
+
+	// Load workspace
+	ws, err := workspace.Load(profile)
+	if err != nil {
+		return errors.Wrapf(err, "failed to load workspace")
+	}
+
+	lock, err := ws.LockWrites()
+	if err != nil {
+		return err
+	}
+	defer lock.Close()
+
+	// Load the secret
+	secretPath := ws.SecretPath(secretID + ".yml")
+	s, err := secret.Load(secretPath)
+	if err != nil {
+		return errors.Wrapf(err, "failed to load secret")
+	}
+
+	encrypters := make([]id.Encrypter, 0, len(shareRecipients))
+	var subjects []string
+	for _, path := range shareRecipients {
+		pub, subject, err := loadRecipientKey(ws, path)
+		if err != nil {
+			return err
+		}
+		encrypters = append(encrypters, pub)
+		subjects = append(subjects, subject)
+	}
+
+	if _, err := ws.Share(s, encrypters...); err != nil {
+		return errors.Wrapf(err, "failed to share secret")
+	}
+	addRecipientSubjects(s, subjects...)
+
+	if err := s.Save(secretPath); err != nil {
+		return errors.Wrapf(err, "failed to save secret")
+	}
+
+	screen.Successf("Shared secret '%s' with %d recipient(s)\n", s.Name, len(encrypters))
+	return nil
+}
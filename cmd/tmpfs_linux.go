@@ -0,0 +1,14 @@
+package cmd
+
+import "golang.org/x/sys/unix"
+
+// isMemoryFS reports whether the directory is on a file system kept in memory,
+// whose files never reach a disk
+func isMemoryFS(dir string) bool {
+	var st unix.Statfs_t
+	if err := unix.Statfs(dir, &st); err != nil {
+		return false
+	}
+
+	return st.Type == unix.TMPFS_MAGIC || st.Type == unix.RAMFS_MAGIC
+}
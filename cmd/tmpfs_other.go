@@ -0,0 +1,12 @@
+//go:build !linux
+
+package cmd
+
+import "os"
+
+// isMemoryFS cannot tell the file system type outside of Linux, the well-known
+// memory directories are trusted when they exist
+func isMemoryFS(dir string) bool {
+	info, err := os.Stat(dir)
+	return err == nil && info.IsDir()
+}
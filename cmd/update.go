@@ -0,0 +1,166 @@
+package cmd
+
+import (
+	"io"
+	"os"
+	"strconv"
+
+	"github.com/open-zhy/secm/pkg/errors"
+	"github.com/open-zhy/secm/pkg/id"
+	"github.com/open-zhy/secm/pkg/screen"
+	"github.com/open-zhy/secm/pkg/secret"
+	"github.com/open-zhy/secm/pkg/workspace"
+	"github.com/spf13/cobra"
+)
+
+var updateCmd = &cobra.Command{
+	Use:   "update [secret-id] [file]",
+	Short: "Replace the content of a secret, keeping its ID",
+	Long: `Encrypt the contents of a file as the new version of an existing secret. The ID and metadata
+are kept, the previous content is kept in the history of the secret, see 'secm history' and
+'secm rollback'. The profile keeps max_versions versions (` + strconv.Itoa(workspace.DefaultMaxVersions) + ` by default), the oldest are deleted.
+The new version is encrypted with the cipher of the secret for the identity, or with the passphrase
+of passphrase secrets. Recipients the secret was shared with only keep access to the previous versions.`,
+	Args: cobra.ExactArgs(2),
+	RunE: runUpdate,
+}
+
+func init() {
+	addSecretPassphraseFlag(updateCmd)
+	rootCmd.AddCommand(updateCmd)
+}
+
+func runUpdate(cmd *cobra.Command, args []string) error {
+	secretID, filePath := args[0], args[1]
+
+	ws, err := workspace.Load(profile)
+	if err != nil {
+		return errors.Wrapf(err, "failed to load workspace")
+	}
+
+	lock, err := ws.LockWrites()
+	if err != nil {
+		return err
+	}
+	defer lock.Close()
+
+	secretPath := ws.SecretPath(secretID + ".yml")
+	s, err := secret.Load(secretPath)
+	if err != nil {
+		return errors.Wrapf(err, "failed to load secret")
+	}
+
+	open := func() (io.ReadCloser, error) {
+		f, err := os.Open(filePath)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to read input file")
+		}
+		return f, nil
+	}
+
+	return updateSecret(ws, secretID, s, open)
+}
+
+// updateSecret stores the content returned by open as the new version of the secret,
+// open is called twice for deduplicated secrets, whose content MAC is updated as well
+func updateSecret(ws *workspace.Workspace, secretID string, s *secret.Secret, open func() (io.ReadCloser, error)) error {
+	c, err := ws.SecretCipher(s)
+	if err != nil {
+		return err
+	}
+
+	encrypters, others, err := updateRecipients(ws, secretID, s)
+	if err != nil {
+		return err
+	}
+
+	if s.ContentMAC != "" {
+		src, err := open()
+		if err != nil {
+			return err
+		}
+		s.ContentMAC, err = ws.ContentMAC(src)
+		src.Close()
+		if err != nil {
+			return errors.Wrapf(err, "failed to hash content")
+		}
+	}
+
+	src, err := open()
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	pruned, err := ws.UpdateSecret(secretID, s, src, c, encrypters)
+	if err != nil {
+		return errors.Wrapf(err, "failed to update secret")
+	}
+
+	if err := saveNewVersion(ws, secretID, s, pruned); err != nil {
+		return err
+	}
+
+	screen.Successf("Updated secret '%s' to version %d\n", s.Name, s.CurrentVersion())
+	if others > 0 {
+		screen.Printf("The secret was shared with %d other recipient(s), share it with them again\n", others)
+	}
+	return nil
+}
+
+// updateRecipients returns what the new version of the secret is encrypted for, the
+// identity or the passphrase of the secret, and the number of other recipients of
+// the current version, who are not given access to the new one
+func updateRecipients(ws *workspace.Workspace, secretID string, s *secret.Secret) ([]id.Encrypter, int, error) {
+	protected, err := ws.IsPassphraseSecret(s)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if protected {
+		passphrase, err := readSecretPassphrase(secretID)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		recipient, err := id.NewScryptRecipient(passphrase)
+		if err != nil {
+			return nil, 0, err
+		}
+		return []id.Encrypter{recipient}, 0, nil
+	}
+
+	self, err := ws.LoadPublicKey()
+	if err != nil {
+		return nil, 0, errors.Wrapf(err, "failed to load identity")
+	}
+
+	recipients, err := ws.CountRecipients(s)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return []id.Encrypter{self}, recipients - 1, nil
+}
+
+// saveNewVersion signs the new version of the secret with the workspace signing key,
+// saves the secret and deletes the data of the versions dropped from its history
+func saveNewVersion(ws *workspace.Workspace, secretID string, s *secret.Secret, pruned []secret.Version) error {
+	signingKey, created, err := ws.EnsureSigningKey()
+	if err != nil {
+		return errors.Wrapf(err, "failed to load signing key")
+	}
+	if created {
+		screen.Infof("Generated signing key at %s\n", ws.SigningKeyPath)
+	}
+
+	if err := ws.SignSecret(secretID, s, signingKey); err != nil {
+		return errors.Wrapf(err, "failed to sign secret")
+	}
+
+	if err := s.Save(ws.SecretPath(secretID + ".yml")); err != nil {
+		return errors.Wrapf(err, "failed to save secret")
+	}
+
+	return ws.RemoveVersions(pruned)
+}
@@ -0,0 +1,94 @@
+package agent
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/open-zhy/secm/pkg/id"
+)
+
+// dialTimeout bounds connecting to the agent, a request itself can take as long
+// as unlocking a key with scrypt
+const dialTimeout = 5 * time.Second
+
+// Client sends requests to a running agent. It implements id.Decrypter, data keys
+// are unwrapped by the agent.
+type Client struct {
+	socket string
+	pub    id.PublicKey
+}
+
+// Dial connects to the agent listening on socket and fetches its public key
+func Dial(socket string) (*Client, error) {
+	c := &Client{socket: socket}
+
+	resp, err := c.call(&request{Op: opPublicKey})
+	if err != nil {
+		return nil, err
+	}
+
+	pub, err := id.ParsePublicKey(resp.Data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse agent public key: %w", err)
+	}
+	c.pub = pub
+
+	return c, nil
+}
+
+// PublicKey returns the public key of the identity held by the agent
+func (c *Client) PublicKey() id.PublicKey {
+	return c.pub
+}
+
+// Decrypt asks the agent to unwrap the data key
+func (c *Client) Decrypt(alg id.WrapAlgorithm, ciphertext []byte) ([]byte, error) {
+	resp, err := c.call(&request{Op: opUnwrap, Wrap: alg, Data: ciphertext})
+	if err != nil {
+		return nil, err
+	}
+
+	return resp.Data, nil
+}
+
+// Lock makes the agent drop the identity key
+func (c *Client) Lock() error {
+	_, err := c.call(&request{Op: opLock})
+	return err
+}
+
+// Unlock makes the agent load the identity key again, decrypted with the
+// passphrase when it is protected
+func (c *Client) Unlock(passphrase []byte) error {
+	_, err := c.call(&request{Op: opUnlock, Data: passphrase})
+	return err
+}
+
+func (c *Client) call(req *request) (*response, error) {
+	conn, err := net.DialTimeout("unix", c.socket, dialTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to agent: %w", err)
+	}
+	defer conn.Close()
+
+	if err := json.NewEncoder(conn).Encode(req); err != nil {
+		return nil, fmt.Errorf("failed to send agent request: %w", err)
+	}
+
+	var resp response
+	if err := json.NewDecoder(conn).Decode(&resp); err != nil {
+		return nil, fmt.Errorf("failed to read agent response: %w", err)
+	}
+
+	if resp.Locked {
+		return nil, ErrLocked
+	}
+	if resp.Error != "" {
+		return nil, errors.New(resp.Error)
+	}
+
+	return &resp, nil
+}
@@ -0,0 +1,24 @@
+//go:build !unix
+
+package agent
+
+import (
+	"net"
+	"os"
+)
+
+// listenUnix creates the socket and restricts it to the current user, there is no
+// umask to create it restricted
+func listenUnix(socket string) (net.Listener, error) {
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.Chmod(socket, 0600); err != nil {
+		l.Close()
+		return nil, err
+	}
+
+	return l, nil
+}
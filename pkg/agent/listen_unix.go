@@ -0,0 +1,18 @@
+//go:build unix
+
+package agent
+
+import (
+	"net"
+	"syscall"
+)
+
+// listenUnix creates the socket with the permissions 0600 from the start, it is
+// never reachable by other users before being restricted. The umask is process
+// wide, the agent creates no other file meanwhile.
+func listenUnix(socket string) (net.Listener, error) {
+	old := syscall.Umask(0177)
+	defer syscall.Umask(old)
+
+	return net.Listen("unix", socket)
+}
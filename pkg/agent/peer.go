@@ -0,0 +1,38 @@
+//go:build linux || darwin || freebsd
+
+package agent
+
+import (
+	"fmt"
+	"net"
+	"os"
+)
+
+// checkPeer refuses connections from processes of another user, in case the
+// permissions of the socket were changed or its directory is shared
+func checkPeer(conn net.Conn) error {
+	uc, ok := conn.(*net.UnixConn)
+	if !ok {
+		return fmt.Errorf("unexpected connection type %T", conn)
+	}
+	raw, err := uc.SyscallConn()
+	if err != nil {
+		return err
+	}
+
+	var uid int
+	var credErr error
+	if err := raw.Control(func(fd uintptr) {
+		uid, credErr = peerUID(int(fd))
+	}); err != nil {
+		return err
+	}
+	if credErr != nil {
+		return fmt.Errorf("failed to read peer credentials: %w", credErr)
+	}
+
+	if uid != os.Getuid() {
+		return fmt.Errorf("connection from user %d refused", uid)
+	}
+	return nil
+}
@@ -0,0 +1,14 @@
+//go:build linux
+
+package agent
+
+import "golang.org/x/sys/unix"
+
+// peerUID returns the user ID of the process connected to the socket fd
+func peerUID(fd int) (int, error) {
+	cred, err := unix.GetsockoptUcred(fd, unix.SOL_SOCKET, unix.SO_PEERCRED)
+	if err != nil {
+		return 0, err
+	}
+	return int(cred.Uid), nil
+}
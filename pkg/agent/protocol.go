@@ -0,0 +1,43 @@
+// Package agent implements secm-agent, a local daemon holding the unlocked identity
+// key in memory. Clients send it wrapped data keys over a Unix socket and get the
+// unwrapped keys back, the private key never leaves the agent.
+package agent
+
+import (
+	"errors"
+
+	"github.com/open-zhy/secm/pkg/id"
+)
+
+// SockEnv holds the path of the socket of a running agent, commands decrypting
+// secrets use the agent instead of the identity key file when it is set
+const SockEnv = "SECM_AGENT_SOCK"
+
+// DefaultSocketName is the file name of the agent socket in the workspace directory
+const DefaultSocketName = "agent.sock"
+
+// ErrLocked is returned when the agent does not hold the identity key
+var ErrLocked = errors.New("agent is locked")
+
+// Operations, one JSON request and one JSON response per line
+const (
+	opPublicKey = "public-key"
+	opUnwrap    = "unwrap"
+	opLock      = "lock"
+	opUnlock    = "unlock"
+)
+
+type request struct {
+	Op string `json:"op"`
+	// Wrap is the wrap algorithm of Data for unwrap
+	Wrap id.WrapAlgorithm `json:"wrap,omitempty"`
+	// Data is the wrapped key for unwrap, the passphrase for unlock
+	Data []byte `json:"data,omitempty"`
+}
+
+type response struct {
+	Error  string `json:"error,omitempty"`
+	Locked bool   `json:"locked,omitempty"`
+	// Data is the unwrapped key for unwrap, the PEM public key for public-key
+	Data []byte `json:"data,omitempty"`
+}
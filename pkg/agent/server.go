@@ -0,0 +1,195 @@
+package agent
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/open-zhy/secm/pkg/id"
+)
+
+// Server holds the identity key and answers the requests of clients. The key is
+// dropped after ttl without unwrap request, or on lock, it is loaded again from
+// the key file on unlock.
+type Server struct {
+	keyPath string
+	ttl     time.Duration
+	pub     []byte
+
+	mu       sync.Mutex
+	identity id.KeyPackageIdentity
+	idle     *time.Timer
+}
+
+// NewServer returns a server holding the unlocked identity stored at keyPath,
+// a zero ttl keeps it until locked
+func NewServer(keyPath string, identity id.KeyPackageIdentity, ttl time.Duration) (*Server, error) {
+	var pub bytes.Buffer
+	if err := identity.PublicKey().Encode(&pub); err != nil {
+		return nil, fmt.Errorf("failed to encode public key: %w", err)
+	}
+
+	s := &Server{keyPath: keyPath, ttl: ttl, pub: pub.Bytes(), identity: identity}
+	if ttl > 0 {
+		s.idle = time.AfterFunc(ttl, s.lock)
+	}
+
+	return s, nil
+}
+
+// Listen creates the Unix socket, only accessible to the current user. A socket
+// left behind by an agent which is no longer running is replaced.
+func Listen(socket string) (net.Listener, error) {
+	if _, err := os.Stat(socket); err == nil {
+		if conn, err := net.Dial("unix", socket); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("an agent is already listening on %s", socket)
+		}
+		if err := os.Remove(socket); err != nil {
+			return nil, fmt.Errorf("failed to remove stale socket: %w", err)
+		}
+	}
+
+	l, err := listenUnix(socket)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", socket, err)
+	}
+
+	return l, nil
+}
+
+// Serve answers the connections accepted on l until it is closed, connections
+// from other users are closed unanswered
+func (s *Server) Serve(l net.Listener) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+
+		if err := checkPeer(conn); err != nil {
+			conn.Close()
+			continue
+		}
+
+		go s.handle(conn)
+	}
+}
+
+// Close drops the identity key
+func (s *Server) Close() {
+	if s.idle != nil {
+		s.idle.Stop()
+	}
+	s.lock()
+}
+
+func (s *Server) handle(conn net.Conn) {
+	defer conn.Close()
+
+	dec := json.NewDecoder(conn)
+	enc := json.NewEncoder(conn)
+	for {
+		var req request
+		if err := dec.Decode(&req); err != nil {
+			return
+		}
+
+		resp := s.dispatch(&req)
+		clear(req.Data)
+
+		err := enc.Encode(resp)
+		clear(resp.Data)
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (s *Server) dispatch(req *request) *response {
+	var (
+		data []byte
+		err  error
+	)
+
+	switch req.Op {
+	case opPublicKey:
+		data = append([]byte(nil), s.pub...)
+	case opUnwrap:
+		data, err = s.unwrap(req.Wrap, req.Data)
+	case opLock:
+		s.lock()
+	case opUnlock:
+		err = s.unlock(req.Data)
+	default:
+		err = fmt.Errorf("unsupported operation: %s", req.Op)
+	}
+
+	if err != nil {
+		return &response{Error: err.Error(), Locked: errors.Is(err, ErrLocked)}
+	}
+
+	return &response{Data: data}
+}
+
+// unwrap decrypts the data key with the identity, the idle timer is restarted
+func (s *Server) unwrap(alg id.WrapAlgorithm, wrapped []byte) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.identity == nil {
+		return nil, ErrLocked
+	}
+	if s.idle != nil {
+		s.idle.Reset(s.ttl)
+	}
+
+	return s.identity.Decrypt(alg, wrapped)
+}
+
+func (s *Server) lock() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.identity = nil
+}
+
+// unlock loads the identity key again, it must be the one the agent was started with
+func (s *Server) unlock(passphrase []byte) error {
+	data, err := os.ReadFile(s.keyPath)
+	if err != nil {
+		return fmt.Errorf("failed to read identity key: %w", err)
+	}
+	defer clear(data)
+
+	identity, err := id.ParseKeyWithPassphrase(data, passphrase)
+	if err != nil {
+		return fmt.Errorf("failed to load identity key: %w", err)
+	}
+
+	var pub bytes.Buffer
+	if err := identity.PublicKey().Encode(&pub); err != nil {
+		return fmt.Errorf("failed to encode public key: %w", err)
+	}
+	if !bytes.Equal(pub.Bytes(), s.pub) {
+		return fmt.Errorf("identity key has changed since the agent was started")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.identity = identity
+	if s.idle != nil {
+		s.idle.Reset(s.ttl)
+	}
+
+	return nil
+}
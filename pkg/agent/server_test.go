@@ -0,0 +1,65 @@
+package agent
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/open-zhy/secm/pkg/id"
+)
+
+func TestServeCurrentUser(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("socket permissions are not checked on windows")
+	}
+	identity, err := id.GenerateKey(id.GenerateKeyOpts{Type: "ec25519"})
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	server, err := NewServer("", identity, 0)
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	defer server.Close()
+
+	socket := filepath.Join(t.TempDir(), DefaultSocketName)
+	l, err := Listen(socket)
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	defer l.Close()
+	go server.Serve(l)
+
+	// restricted from its creation, not chmod-ed afterwards
+	info, err := os.Stat(socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0600 {
+		t.Fatalf("socket permissions %o, want 600", perm)
+	}
+
+	// the peer check lets the processes of the same user in
+	client, err := Dial(socket)
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	key := bytes.Repeat([]byte{0x42}, 32)
+	wrapped, err := identity.PublicKey().Encrypt(nil, key)
+	if err != nil {
+		t.Fatalf("Encrypt: %v", err)
+	}
+	got, err := client.Decrypt(identity.PublicKey().Algorithm(), wrapped)
+	if err != nil {
+		t.Fatalf("Decrypt through the agent: %v", err)
+	}
+	if !bytes.Equal(got, key) {
+		t.Fatal("unwrapped key mismatch")
+	}
+
+	if _, err := Listen(socket); err == nil {
+		t.Fatal("Listen succeeded on the socket of a running agent")
+	}
+}
@@ -0,0 +1,154 @@
+package crypto
+
+import (
+	"bufio"
+	"crypto/ecdh"
+	"crypto/hkdf"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"filippo.io/age"
+	"filippo.io/age/agessh"
+	"github.com/open-zhy/secm/pkg/id"
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// age (https://age-encryption.org/v1) interoperability: secrets are exported to
+// X25519 or SSH recipients with the age library, and age files addressed to an
+// X25519 workspace identity are unwrapped here, the private key never leaving id.
+const (
+	ageX25519Label   = "age-encryption.org/v1/X25519"
+	ageStanzaX25519  = "X25519"
+	ageFileKeySize   = 16
+	ageRecipientHRP  = "age"
+	ageCommentPrefix = "#"
+)
+
+// ParseAgeRecipient parses an age X25519 recipient (age1...) or an SSH public
+// key in authorized_keys format (ssh-ed25519 or ssh-rsa)
+func ParseAgeRecipient(s string) (age.Recipient, error) {
+	switch {
+	case strings.HasPrefix(s, "age1"):
+		return age.ParseX25519Recipient(s)
+	case strings.HasPrefix(s, "ssh-"):
+		return agessh.ParseRecipient(s)
+	default:
+		return nil, fmt.Errorf("unknown age recipient type: %q", s)
+	}
+}
+
+// ParseAgeRecipientsFile reads one recipient per line, blank lines and lines
+// starting with # are ignored, as in age recipients files
+func ParseAgeRecipientsFile(r io.Reader) ([]age.Recipient, error) {
+	var recipients []age.Recipient
+
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, ageCommentPrefix) {
+			continue
+		}
+
+		recipient, err := ParseAgeRecipient(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+		recipients = append(recipients, recipient)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read recipients: %w", err)
+	}
+
+	return recipients, nil
+}
+
+// AgeRecipient returns the age recipient string (age1...) of an X25519 public key
+func AgeRecipient(pub id.PublicKey) (string, error) {
+	ck, ok := pub.(id.CurveKey)
+	if !ok || ck.Curve() != ecdh.X25519() {
+		return "", fmt.Errorf("only X25519 (ec25519) identities have an age recipient")
+	}
+
+	return bech32Encode(ageRecipientHRP, pub.Bytes())
+}
+
+// ageIdentity unwraps the X25519 stanzas of age files with a workspace identity
+type ageIdentity struct {
+	ka  id.KeyAgreement
+	pub []byte
+}
+
+// NewAgeIdentity adapts an X25519 workspace identity to age.Identity
+func NewAgeIdentity(identity id.KeyPackageIdentity) (age.Identity, error) {
+	ka, ok := identity.(id.KeyAgreement)
+	if !ok || ka.Curve() != ecdh.X25519() {
+		return nil, fmt.Errorf("only X25519 (ec25519) identities can decrypt age files")
+	}
+
+	return &ageIdentity{ka: ka, pub: identity.PublicKey().Bytes()}, nil
+}
+
+func (i *ageIdentity) Unwrap(stanzas []*age.Stanza) ([]byte, error) {
+	for _, s := range stanzas {
+		fileKey, err := i.unwrap(s)
+		if errors.Is(err, age.ErrIncorrectIdentity) {
+			continue
+		}
+		return fileKey, err
+	}
+
+	return nil, age.ErrIncorrectIdentity
+}
+
+func (i *ageIdentity) unwrap(s *age.Stanza) ([]byte, error) {
+	if s.Type != ageStanzaX25519 {
+		return nil, age.ErrIncorrectIdentity
+	}
+	if len(s.Args) != 1 {
+		return nil, errors.New("invalid X25519 recipient block")
+	}
+
+	share, err := base64.RawStdEncoding.Strict().DecodeString(s.Args[0])
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse X25519 recipient: %w", err)
+	}
+
+	ephemeral, err := ecdh.X25519().NewPublicKey(share)
+	if err != nil {
+		return nil, errors.New("invalid X25519 recipient block")
+	}
+
+	sharedSecret, err := i.ka.ECDH(ephemeral)
+	if err != nil {
+		return nil, fmt.Errorf("invalid X25519 recipient: %w", err)
+	}
+
+	salt := make([]byte, 0, len(share)+len(i.pub))
+	salt = append(salt, share...)
+	salt = append(salt, i.pub...)
+	wrappingKey, err := hkdf.Key(sha256.New, sharedSecret, salt, ageX25519Label, chacha20poly1305.KeySize)
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := chacha20poly1305.New(wrappingKey)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(s.Body) != ageFileKeySize+aead.Overhead() {
+		return nil, errors.New("invalid X25519 recipient block: incorrect file key size")
+	}
+
+	fileKey, err := aead.Open(nil, make([]byte, aead.NonceSize()), s.Body, nil)
+	if err != nil {
+		return nil, age.ErrIncorrectIdentity
+	}
+
+	return fileKey, nil
+}
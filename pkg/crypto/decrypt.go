@@ -1,61 +1,130 @@
 package crypto
 
 import (
-	"crypto/aes"
-	"crypto/cipher"
-	"encoding/binary"
+	"bytes"
 	"fmt"
+	"io"
 
 	"github.com/open-zhy/secm/pkg/id"
 )
 
-// DecryptData decrypts data that was encrypted using hybrid encryption
-func DecryptData(decrypter id.Decrypter, encryptedData []byte) ([]byte, error) {
-	if len(encryptedData) < 4 {
-		return nil, fmt.Errorf("invalid encrypted data format")
+// DecryptData decrypts data that was encrypted using hybrid encryption.
+// Blobs carrying a versioned header are dispatched on their format version,
+// blobs without it are read through the legacy path.
+// The associated data must match the one given at encryption, otherwise
+// ErrAuthentication is returned. The plaintext is returned in a secure buffer
+// the caller must destroy.
+func DecryptData(decrypter id.Decrypter, encryptedData []byte, associatedData []byte) (*SecureBuffer, error) {
+	if !HasHeader(encryptedData) {
+		return decryptLegacy(decrypter, encryptedData, associatedData)
 	}
 
-	// Extract the RSA-encrypted AES key length
-	keyLen := int(binary.BigEndian.Uint32(encryptedData[:4]))
-	if len(encryptedData) < 4+keyLen+12 { // 4 bytes length + key + minimum nonce size
-		return nil, fmt.Errorf("invalid encrypted data format")
+	header, payload, err := ParseHeader(encryptedData)
+	if err != nil {
+		return nil, err
 	}
 
-	// Extract the RSA-encrypted AES key
-	encryptedKey := encryptedData[4 : 4+keyLen]
+	dataKey, err := unwrapKey(decrypter, header)
+	if err != nil {
+		return nil, err
+	}
+	defer clear(dataKey)
+
+	if header.Version == FormatV3 {
+		r, err := newChunkReader(bytes.NewReader(payload), header.Cipher, dataKey, associatedData)
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+
+		// the plaintext is shorter than the payload, reading up to EOF authenticates the final chunk
+		plaintext := NewSecureBuffer(len(payload))
+		n, err := io.ReadFull(r, plaintext.Bytes())
+		if err != io.ErrUnexpectedEOF && err != io.EOF {
+			plaintext.Destroy()
+			if err == nil {
+				err = fmt.Errorf("invalid encrypted data format")
+			}
+			return nil, err
+		}
+		plaintext.Truncate(n)
 
-	// Decrypt the AES key using RSA
-	aesKey, err := decrypter.Decrypt(encryptedKey)
+		return plaintext, nil
+	}
+
+	return openPayload(header.Cipher, dataKey, payload, associatedData)
+}
+
+// decryptLegacy decrypts blobs produced before the header was introduced,
+// [4-byte key len][wrapped key][nonce][ciphertext] always in AES-256-GCM
+// with the identity's historical wrap scheme
+func decryptLegacy(decrypter id.Decrypter, encryptedData []byte, associatedData []byte) (*SecureBuffer, error) {
+	r := bytes.NewReader(encryptedData)
+	encryptedKey, err := readWrappedKey(r)
 	if err != nil {
-		return nil, fmt.Errorf("failed to decrypt AES key: %w", err)
+		return nil, err
 	}
+	payload := encryptedData[len(encryptedData)-r.Len():]
 
-	// Create AES cipher
-	block, err := aes.NewCipher(aesKey)
+	dataKey, err := decrypter.Decrypt(id.WrapLegacy, encryptedKey)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create AES cipher: %w", err)
+		return nil, fmt.Errorf("failed to decrypt AES key: %w", err)
 	}
+	defer clear(dataKey)
 
-	// Create GCM mode
-	aesgcm, err := cipher.NewGCM(block)
+	return openPayload(CipherAES256GCM, dataKey, payload, associatedData)
+}
+
+// unwrapKey finds the stanza addressed to the decrypter and unwraps the data key.
+// When the decrypter exposes its public key, only stanzas with a matching (or
+// missing) hint are tried, otherwise every stanza is tried in turn.
+func unwrapKey(decrypter id.Decrypter, header *Header) ([]byte, error) {
+	var hint *[id.KeyHintSize]byte
+	if identity, ok := decrypter.(interface{ PublicKey() id.PublicKey }); ok {
+		h := id.KeyHint(identity.PublicKey())
+		hint = &h
+	}
+
+	var lastErr error
+	for _, s := range header.Stanzas {
+		if hint != nil && s.Hint != *hint && s.Hint != [id.KeyHintSize]byte{} {
+			continue
+		}
+
+		dataKey, err := decrypter.Decrypt(s.Wrap, s.WrappedKey)
+		if err == nil {
+			return dataKey, nil
+		}
+		lastErr = err
+	}
+
+	if lastErr != nil {
+		return nil, fmt.Errorf("failed to decrypt AES key: %w", lastErr)
+	}
+
+	return nil, fmt.Errorf("no recipient stanza matches the identity")
+}
+
+// openPayload decrypts [nonce][ciphertext] with the data key into a secure buffer
+func openPayload(c Cipher, dataKey []byte, payload []byte, associatedData []byte) (*SecureBuffer, error) {
+	aead, err := newAEAD(c, dataKey)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create GCM: %w", err)
+		return nil, err
 	}
 
-	nonceSize := aesgcm.NonceSize()
-	if len(encryptedData) < 4+keyLen+nonceSize {
+	nonceSize := aead.NonceSize()
+	if len(payload) < nonceSize {
 		return nil, fmt.Errorf("invalid encrypted data format")
 	}
 
-	// Extract nonce and ciphertext
-	nonce := encryptedData[4+keyLen : 4+keyLen+nonceSize]
-	ciphertext := encryptedData[4+keyLen+nonceSize:]
-
-	// Decrypt the data
-	plaintext, err := aesgcm.Open(nil, nonce, ciphertext, nil)
+	// Decrypt the data in place of the secure buffer
+	plaintext := NewSecureBuffer(len(payload) - nonceSize)
+	opened, err := aead.Open(plaintext.Bytes()[:0], payload[:nonceSize], payload[nonceSize:], associatedData)
 	if err != nil {
-		return nil, fmt.Errorf("failed to decrypt data: %w", err)
+		plaintext.Destroy()
+		return nil, fmt.Errorf("failed to decrypt data: %w", ErrAuthentication)
 	}
+	plaintext.Truncate(len(opened))
 
 	return plaintext, nil
 }
@@ -1,67 +1,246 @@
 package crypto
 
 import (
-	"crypto/aes"
-	"crypto/cipher"
-	"crypto/rand"
+	"bufio"
+	"bytes"
+	"errors"
 	"fmt"
 	"io"
 
 	"github.com/open-zhy/secm/pkg/id"
 )
 
-// EncryptData encrypts data using hybrid encryption (RSA + AES)
-// It generates a random AES key, encrypts it with RSA, and uses it to encrypt the data
-func EncryptData(publicKeyWrapper id.Encrypter, data []byte) ([]byte, error) {
-	// Generate random AES key
-	aesKey := make([]byte, 32) // 256-bit key
-	if _, err := io.ReadFull(rand.Reader, aesKey); err != nil {
-		return nil, fmt.Errorf("failed to generate AES key: %w", err)
+// EncryptData encrypts data using hybrid encryption (RSA/ECDH + AES)
+// It generates a random AES key, wraps it for the recipient, and uses it to encrypt the data.
+// The result is prefixed with a versioned header recording the algorithms used.
+// The associated data (which may be nil) is authenticated but not encrypted, the
+// same value must be given to DecryptData.
+func EncryptData(publicKeyWrapper id.Encrypter, data []byte, associatedData []byte) ([]byte, error) {
+	return EncryptDataFor([]id.Encrypter{publicKeyWrapper}, data, associatedData)
+}
+
+// EncryptDataFor encrypts data once and wraps the data key for each recipient,
+// any of them is then able to decrypt the resulting envelope
+func EncryptDataFor(recipients []id.Encrypter, data []byte, associatedData []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w, err := NewEncryptWriter(&buf, recipients, associatedData)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// AddRecipients grants additional recipients access to an envelope, the data
+// key is unwrapped with the decrypter and wrapped again for each of them,
+// the payload itself is left untouched
+func AddRecipients(decrypter id.Decrypter, encryptedData []byte, recipients ...id.Encrypter) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := Rewrap(&buf, bytes.NewReader(encryptedData), decrypter, recipients...); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// Rewrap copies the envelope read from src into dst with additional recipient
+// stanzas, the payload is streamed as is
+func Rewrap(dst io.Writer, src io.Reader, decrypter id.Decrypter, recipients ...id.Encrypter) error {
+	br := bufio.NewReader(src)
+	if prefix, _ := br.Peek(len(Magic)); !HasHeader(prefix) {
+		return fmt.Errorf("legacy encrypted data cannot carry several recipients")
+	}
+
+	header, err := ReadHeader(br)
+	if err != nil {
+		return err
+	}
+
+	dataKey, err := unwrapKey(decrypter, header)
+	if err != nil {
+		return err
 	}
+	defer clear(dataKey)
 
-	// Encrypt AES key with RSA
-	encryptedKey, err := publicKeyWrapper.Encrypt(data, aesKey)
+	stanzas, err := wrapKey(recipients, dataKey)
 	if err != nil {
-		return nil, fmt.Errorf("failed to encrypt AES key: %w", err)
+		return err
 	}
 
-	// Create AES cipher
-	block, err := aes.NewCipher(aesKey)
+	// v1 payload is compatible with v2, only the header is rewritten
+	if header.Version == FormatV1 {
+		header.Version = FormatV2
+	}
+	header.Stanzas = append(header.Stanzas, stanzas...)
+
+	headerBytes, err := header.Encode()
 	if err != nil {
-		return nil, fmt.Errorf("failed to create AES cipher: %w", err)
+		return err
+	}
+
+	if _, err := dst.Write(headerBytes); err != nil {
+		return fmt.Errorf("failed to write header: %w", err)
+	}
+
+	if _, err := io.Copy(dst, br); err != nil {
+		return fmt.Errorf("failed to copy payload: %w", err)
+	}
+
+	return nil
+}
+
+// wrapKey creates a stanza per recipient holding the wrapped data key
+func wrapKey(recipients []id.Encrypter, key []byte) ([]*Stanza, error) {
+	if len(recipients) == 0 {
+		return nil, fmt.Errorf("no recipient to encrypt for")
+	}
+
+	stanzas := make([]*Stanza, 0, len(recipients))
+	for _, recipient := range recipients {
+		encryptedKey, err := recipient.Encrypt(nil, key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encrypt AES key: %w", err)
+		}
+
+		s := &Stanza{
+			Wrap:       recipient.Algorithm(),
+			WrappedKey: encryptedKey,
+		}
+		if pub, ok := recipient.(id.PublicKey); ok {
+			s.Hint = id.KeyHint(pub)
+		}
+
+		stanzas = append(stanzas, s)
+	}
+
+	return stanzas, nil
+}
+
+// ErrLegacyWrap is returned by UpgradeWrap when the data key is wrapped with a
+// legacy scheme only a LegacyDecrypter unwraps
+var ErrLegacyWrap = errors.New("data key wrapped with a legacy scheme the decrypter does not unwrap")
+
+// UpgradeWrap copies the envelope read from src into dst with the stanza of the
+// identity, unwrapped by decrypter, wrapped again using the current algorithm of pub when it
+// was wrapped with another one (e.g. RSA PKCS#1 v1.5 instead of OAEP). Legacy data
+// without header is given one. The payload is streamed as is. It reports whether
+// an upgrade was needed, nothing is written to dst otherwise.
+//
+// Data keys wrapped with RSA PKCS#1 v1.5 are only unwrapped here, and only in data
+// written before the stanza layout (without header or FormatV1), through the
+// id.LegacyDecrypter of the identity. The payload is then authenticated with the
+// associated data before anything is written.
+func UpgradeWrap(dst io.Writer, src io.Reader, decrypter id.Decrypter, pub id.PublicKey, associatedData []byte) (bool, error) {
+	br := bufio.NewReader(src)
+
+	var header *Header
+	if prefix, _ := br.Peek(len(Magic)); !HasHeader(prefix) {
+		encryptedKey, err := readWrappedKey(br)
+		if err != nil {
+			return false, err
+		}
+
+		header = &Header{
+			Version: FormatV1,
+			Cipher:  CipherAES256GCM,
+			Stanzas: []*Stanza{{Wrap: id.WrapLegacy, WrappedKey: encryptedKey}},
+		}
+	} else {
+		h, err := ReadHeader(br)
+		if err != nil {
+			return false, err
+		}
+		header = h
 	}
 
-	// Generate random nonce
-	nonce := make([]byte, 12)
-	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
-		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	legacy, _ := decrypter.(id.LegacyDecrypter)
+	hint := id.KeyHint(pub)
+	index := -1
+	var dataKey []byte
+	var unverified, needsLegacy bool
+	for i, s := range header.Stanzas {
+		if s.Hint != hint && s.Hint != [id.KeyHintSize]byte{} {
+			continue
+		}
+
+		legacyWrap := header.Version == FormatV1 && (s.Wrap == id.WrapLegacy || s.Wrap == id.WrapRSAPKCS1v15)
+		if legacyWrap && legacy != nil {
+			key, err := legacy.DecryptLegacy(s.WrappedKey, header.Cipher.KeySize())
+			if err == nil {
+				index, dataKey, unverified = i, key, true
+				break
+			}
+			continue
+		}
+
+		key, err := decrypter.Decrypt(s.Wrap, s.WrappedKey)
+		if err == nil {
+			index, dataKey = i, key
+			break
+		}
+		needsLegacy = needsLegacy || legacyWrap
+	}
+
+	if index < 0 {
+		if needsLegacy {
+			return false, ErrLegacyWrap
+		}
+		return false, fmt.Errorf("no recipient stanza matches the identity")
+	}
+	defer clear(dataKey)
+
+	if header.Stanzas[index].Wrap == pub.Algorithm() && header.Version != FormatV1 {
+		return false, nil
+	}
+
+	// a legacy unwrap yields a random key rather than a padding error, only the
+	// payload tells whether it is the right one
+	var payload io.Reader = br
+	if unverified {
+		data, err := io.ReadAll(br)
+		if err != nil {
+			return false, fmt.Errorf("failed to read payload: %w", err)
+		}
+
+		plaintext, err := openPayload(header.Cipher, dataKey, data, associatedData)
+		if err != nil {
+			return false, err
+		}
+		plaintext.Destroy()
+		payload = bytes.NewReader(data)
 	}
 
-	// Create GCM mode
-	aesgcm, err := cipher.NewGCM(block)
+	stanzas, err := wrapKey([]id.Encrypter{pub}, dataKey)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create GCM: %w", err)
+		return false, err
 	}
+	header.Stanzas[index] = stanzas[0]
 
-	// Encrypt data
-	ciphertext := aesgcm.Seal(nil, nonce, data, nil)
+	// v1 payload is compatible with v2, only the header is rewritten
+	if header.Version == FormatV1 {
+		header.Version = FormatV2
+	}
 
-	// Combine all parts: [RSA-encrypted AES key length (4 bytes)][RSA-encrypted AES key][nonce][ciphertext]
-	keyLen := len(encryptedKey)
-	result := make([]byte, 4+keyLen+len(nonce)+len(ciphertext))
+	headerBytes, err := header.Encode()
+	if err != nil {
+		return false, err
+	}
 
-	// Store key length
-	result[0] = byte(keyLen >> 24)
-	result[1] = byte(keyLen >> 16)
-	result[2] = byte(keyLen >> 8)
-	result[3] = byte(keyLen)
+	if _, err := dst.Write(headerBytes); err != nil {
+		return false, fmt.Errorf("failed to write header: %w", err)
+	}
 
-	// Copy encrypted key
-	copy(result[4:], encryptedKey)
-	// Copy nonce
-	copy(result[4+keyLen:], nonce)
-	// Copy ciphertext
-	copy(result[4+keyLen+len(nonce):], ciphertext)
+	if _, err := io.Copy(dst, payload); err != nil {
+		return false, fmt.Errorf("failed to copy payload: %w", err)
+	}
 
-	return result, nil
+	return true, nil
 }
@@ -0,0 +1,139 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/pem"
+	"errors"
+	"testing"
+
+	"github.com/open-zhy/secm/pkg/id"
+)
+
+// newRSAIdentity returns an RSA identity along with its raw key, to produce
+// data the way older releases did
+func newRSAIdentity(t *testing.T) (id.KeyPackageIdentity, *rsa.PrivateKey) {
+	t.Helper()
+	pk, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	identity, err := id.ParseKey(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(pk)}))
+	if err != nil {
+		t.Fatalf("ParseKey: %v", err)
+	}
+	return identity, pk
+}
+
+// legacyBlob encrypts plaintext as releases without header did:
+// [4-byte key len][PKCS#1 v1.5 wrapped key][nonce][AES-256-GCM ciphertext]
+func legacyBlob(t *testing.T, pub *rsa.PublicKey, plaintext []byte) []byte {
+	t.Helper()
+	key := randomBytes(t, 32)
+	wrapped, err := rsa.EncryptPKCS1v15(rand.Reader, pub, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	aead, err := newAEAD(CipherAES256GCM, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nonce := randomBytes(t, aead.NonceSize())
+
+	blob := binary.BigEndian.AppendUint32(nil, uint32(len(wrapped)))
+	blob = append(blob, wrapped...)
+	blob = append(blob, nonce...)
+	return aead.Seal(blob, nonce, plaintext, nil)
+}
+
+func TestUpgradeWrapLegacyRSA(t *testing.T) {
+	identity, pk := newRSAIdentity(t)
+	plaintext := []byte("written before OAEP")
+	blob := legacyBlob(t, &pk.PublicKey, plaintext)
+
+	// only migrate unwraps PKCS#1 v1.5
+	if _, err := decryptData(t, identity, blob, nil); err == nil {
+		t.Fatal("legacy PKCS#1 v1.5 data decrypted without migration")
+	}
+
+	var upgraded bytes.Buffer
+	changed, err := UpgradeWrap(&upgraded, bytes.NewReader(blob), identity, identity.PublicKey(), nil)
+	if err != nil {
+		t.Fatalf("UpgradeWrap: %v", err)
+	}
+	if !changed {
+		t.Fatal("UpgradeWrap reported no change for legacy data")
+	}
+
+	header, _, err := ParseHeader(upgraded.Bytes())
+	if err != nil {
+		t.Fatalf("ParseHeader: %v", err)
+	}
+	if wrap := header.Stanzas[0].Wrap; wrap != id.WrapRSAOAEPSHA256 {
+		t.Fatalf("upgraded stanza wrapped with %s, want %s", wrap, id.WrapRSAOAEPSHA256)
+	}
+	if got, err := decryptData(t, identity, upgraded.Bytes(), nil); err != nil || !bytes.Equal(got, plaintext) {
+		t.Fatalf("DecryptData of upgraded data: %v", err)
+	}
+
+	// upgraded data is left alone
+	var again bytes.Buffer
+	if changed, err := UpgradeWrap(&again, bytes.NewReader(upgraded.Bytes()), identity, identity.PublicKey(), nil); err != nil || changed {
+		t.Fatalf("UpgradeWrap of upgraded data: changed %v, err %v", changed, err)
+	}
+}
+
+func TestUpgradeWrapLegacyRSAChecked(t *testing.T) {
+	identity, pk := newRSAIdentity(t)
+	blob := legacyBlob(t, &pk.PublicKey, []byte("written before OAEP"))
+
+	// a corrupted wrapped key unwraps to a random key, the payload exposes it
+	corrupted := bytes.Clone(blob)
+	corrupted[10] ^= 0x01
+	var dst bytes.Buffer
+	if _, err := UpgradeWrap(&dst, bytes.NewReader(corrupted), identity, identity.PublicKey(), nil); !errors.Is(err, ErrAuthentication) {
+		t.Fatalf("UpgradeWrap of a corrupted key: got %v, want ErrAuthentication", err)
+	}
+	if dst.Len() != 0 {
+		t.Fatal("UpgradeWrap wrote data for a corrupted key")
+	}
+
+	// a decrypter without legacy support, such as the agent, is told so
+	if _, err := UpgradeWrap(&dst, bytes.NewReader(blob), hintless{identity}, identity.PublicKey(), nil); !errors.Is(err, ErrLegacyWrap) {
+		t.Fatalf("UpgradeWrap through a decrypter without legacy support: got %v, want ErrLegacyWrap", err)
+	}
+}
+
+func TestPKCS1v15StanzaRefused(t *testing.T) {
+	identity, pk := newRSAIdentity(t)
+	data, err := EncryptData(identity.PublicKey(), []byte("current format"), nil)
+	if err != nil {
+		t.Fatalf("EncryptData: %v", err)
+	}
+
+	// a stanza of the current format relabelled to reach PKCS#1 v1.5
+	key := randomBytes(t, 32)
+	wrapped, err := rsa.EncryptPKCS1v15(rand.Reader, &pk.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, wrap := range []id.WrapAlgorithm{id.WrapLegacy, id.WrapRSAPKCS1v15} {
+		crafted := rewriteHeader(t, data, func(h *Header) {
+			h.Stanzas[0].Wrap, h.Stanzas[0].WrappedKey = wrap, wrapped
+		})
+
+		if _, _, err := ParseHeader(crafted); err == nil {
+			t.Fatalf("header with a %s stanza parsed", wrap)
+		}
+		if _, err := decryptData(t, identity, crafted, nil); err == nil {
+			t.Fatalf("envelope with a %s stanza decrypted", wrap)
+		}
+		var dst bytes.Buffer
+		if _, err := UpgradeWrap(&dst, bytes.NewReader(crafted), identity, identity.PublicKey(), nil); err == nil {
+			t.Fatalf("UpgradeWrap accepted a %s stanza", wrap)
+		}
+	}
+}
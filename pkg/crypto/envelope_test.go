@@ -0,0 +1,161 @@
+package crypto
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/open-zhy/secm/pkg/id"
+)
+
+func generateIdentity(t *testing.T, keyType string) id.KeyPackageIdentity {
+	t.Helper()
+	identity, err := id.GenerateKey(id.GenerateKeyOpts{Type: keyType})
+	if err != nil {
+		t.Fatalf("GenerateKey(%s): %v", keyType, err)
+	}
+	return identity
+}
+
+func decryptData(t *testing.T, decrypter id.Decrypter, data, ad []byte) ([]byte, error) {
+	t.Helper()
+	plaintext, err := DecryptData(decrypter, data, ad)
+	if err != nil {
+		return nil, err
+	}
+	defer plaintext.Destroy()
+
+	return bytes.Clone(plaintext.Bytes()), nil
+}
+
+// rewriteHeader applies edit to the header of the envelope
+func rewriteHeader(t *testing.T, data []byte, edit func(*Header)) []byte {
+	t.Helper()
+	header, payload, err := ParseHeader(data)
+	if err != nil {
+		t.Fatalf("ParseHeader: %v", err)
+	}
+	edit(header)
+
+	encoded, err := header.Encode()
+	if err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	return append(encoded, payload...)
+}
+
+// hintless hides the public key of a decrypter, like the agent client, so that
+// every stanza is tried
+type hintless struct{ id.Decrypter }
+
+func TestEnvelopeRecipients(t *testing.T) {
+	alice := generateIdentity(t, "rsa")
+	bob := generateIdentity(t, "ec25519")
+	carol := generateIdentity(t, "p256")
+	plaintext := []byte("shared secret")
+	ad := []byte("secret-id")
+
+	data, err := EncryptDataFor([]id.Encrypter{alice.PublicKey(), bob.PublicKey()}, plaintext, ad)
+	if err != nil {
+		t.Fatalf("EncryptDataFor: %v", err)
+	}
+
+	for name, decrypter := range map[string]id.Decrypter{
+		"alice":          alice,
+		"bob":            bob,
+		"alice hintless": hintless{alice},
+		"bob hintless":   hintless{bob},
+	} {
+		got, err := decryptData(t, decrypter, data, ad)
+		if err != nil {
+			t.Fatalf("%s: DecryptData: %v", name, err)
+		}
+		if !bytes.Equal(got, plaintext) {
+			t.Fatalf("%s: plaintext mismatch", name)
+		}
+	}
+
+	// not a recipient, with or without hints
+	for name, decrypter := range map[string]id.Decrypter{"carol": carol, "carol hintless": hintless{carol}} {
+		if _, err := decryptData(t, decrypter, data, ad); err == nil {
+			t.Fatalf("%s decrypted an envelope she is not a recipient of", name)
+		}
+	}
+}
+
+func TestEnvelopeWrongStanza(t *testing.T) {
+	alice := generateIdentity(t, "ec25519")
+	bob := generateIdentity(t, "ec25519")
+	plaintext := []byte("shared secret")
+
+	data, err := EncryptDataFor([]id.Encrypter{alice.PublicKey(), bob.PublicKey()}, plaintext, nil)
+	if err != nil {
+		t.Fatalf("EncryptDataFor: %v", err)
+	}
+
+	// the stanza hinted for alice holds the key wrapped for bob
+	swapped := rewriteHeader(t, data, func(h *Header) {
+		h.Stanzas[0].WrappedKey, h.Stanzas[1].WrappedKey = h.Stanzas[1].WrappedKey, h.Stanzas[0].WrappedKey
+	})
+	if _, err := decryptData(t, alice, swapped, nil); err == nil {
+		t.Fatal("alice unwrapped the key wrapped for bob")
+	}
+
+	// a corrupted stanza of alice leaves bob unaffected
+	corrupted := rewriteHeader(t, data, func(h *Header) {
+		h.Stanzas[0].WrappedKey[len(h.Stanzas[0].WrappedKey)-1] ^= 0x01
+	})
+	if _, err := decryptData(t, alice, corrupted, nil); err == nil {
+		t.Fatal("alice unwrapped a corrupted stanza")
+	}
+	if got, err := decryptData(t, bob, corrupted, nil); err != nil || !bytes.Equal(got, plaintext) {
+		t.Fatalf("bob: DecryptData: %v", err)
+	}
+
+	// stanzas without hint are tried by everyone
+	unhinted := rewriteHeader(t, data, func(h *Header) {
+		for _, s := range h.Stanzas {
+			s.Hint = [id.KeyHintSize]byte{}
+		}
+	})
+	if got, err := decryptData(t, bob, unhinted, nil); err != nil || !bytes.Equal(got, plaintext) {
+		t.Fatalf("bob without hints: DecryptData: %v", err)
+	}
+}
+
+func TestEnvelopeAddRecipients(t *testing.T) {
+	alice := generateIdentity(t, "ec25519")
+	carol := generateIdentity(t, "mlkem768-x25519")
+	plaintext := []byte("shared later")
+	ad := []byte("secret-id")
+
+	data, err := EncryptData(alice.PublicKey(), plaintext, ad)
+	if err != nil {
+		t.Fatalf("EncryptData: %v", err)
+	}
+	if _, err := decryptData(t, carol, data, ad); err == nil {
+		t.Fatal("carol decrypted before being added")
+	}
+
+	shared, err := AddRecipients(alice, data, carol.PublicKey())
+	if err != nil {
+		t.Fatalf("AddRecipients: %v", err)
+	}
+
+	// only the header changes, the payload is kept as is
+	_, payload, _ := ParseHeader(data)
+	_, sharedPayload, _ := ParseHeader(shared)
+	if !bytes.Equal(payload, sharedPayload) {
+		t.Fatal("AddRecipients changed the payload")
+	}
+
+	for name, identity := range map[string]id.KeyPackageIdentity{"alice": alice, "carol": carol} {
+		if got, err := decryptData(t, identity, shared, ad); err != nil || !bytes.Equal(got, plaintext) {
+			t.Fatalf("%s: DecryptData: %v", name, err)
+		}
+	}
+
+	// a non recipient cannot add others
+	if _, err := AddRecipients(generateIdentity(t, "ec25519"), data, carol.PublicKey()); err == nil {
+		t.Fatal("AddRecipients succeeded with an identity which is not a recipient")
+	}
+}
@@ -0,0 +1,22 @@
+package crypto
+
+import (
+	"fmt"
+
+	"golang.org/x/sys/unix"
+)
+
+// HardenProcess keeps decrypted secrets and keys out of core dumps: the core size
+// limit is set to zero and the process is made non-dumpable, which also prevents
+// other processes of the user from attaching to it with ptrace
+func HardenProcess() error {
+	if err := unix.Setrlimit(unix.RLIMIT_CORE, &unix.Rlimit{Cur: 0, Max: 0}); err != nil {
+		return fmt.Errorf("failed to disable core dumps: %w", err)
+	}
+
+	if err := unix.Prctl(unix.PR_SET_DUMPABLE, 0, 0, 0, 0); err != nil {
+		return fmt.Errorf("failed to make the process non-dumpable: %w", err)
+	}
+
+	return nil
+}
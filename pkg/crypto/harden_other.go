@@ -0,0 +1,8 @@
+//go:build !linux
+
+package crypto
+
+// HardenProcess is only implemented on Linux
+func HardenProcess() error {
+	return nil
+}
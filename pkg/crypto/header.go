@@ -0,0 +1,277 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/open-zhy/secm/pkg/id"
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// Magic prefixes every blob produced by EncryptData. Legacy blobs start with
+// a 4-byte big-endian wrapped key length instead, and "SECM" read as such a
+// length (~1.4GB) can never be a genuine wrapped key, so both layouts can be
+// told apart unambiguously.
+const Magic = "SECM"
+
+const (
+	// FormatV1 is [magic][version][wrap algorithm][cipher][4-byte key len][wrapped key][nonce][ciphertext]
+	FormatV1 uint8 = 0x01
+	// FormatV2 is [magic][version][cipher][2-byte stanza count][stanzas...][nonce][ciphertext]
+	// where each stanza is [wrap algorithm][8-byte key hint][4-byte key len][wrapped key]
+	FormatV2 uint8 = 0x02
+	// FormatV3 has the same header as FormatV2 followed by a chunked STREAM payload,
+	// see NewEncryptWriter
+	FormatV3 uint8 = 0x03
+)
+
+// MaxRecipients is the maximum number of stanzas an envelope can carry
+const MaxRecipients = 0xffff
+
+// maxWrappedKeySize bounds the size of a wrapped key read from untrusted input
+const maxWrappedKeySize = 1 << 16
+
+// Cipher identifies the data encapsulation mechanism (DEM) used on the payload
+type Cipher uint8
+
+const (
+	CipherAES256GCM Cipher = 0x01
+	// CipherChaCha20Poly1305 is the RFC 8439 AEAD, fast without AES hardware support
+	CipherChaCha20Poly1305 Cipher = 0x02
+	// CipherXChaCha20Poly1305 is ChaCha20-Poly1305 with a 24-byte nonce, which leaves
+	// room for a random nonce prefix without collision concerns
+	CipherXChaCha20Poly1305 Cipher = 0x03
+
+	// DefaultCipher is used when no cipher is chosen
+	DefaultCipher = CipherAES256GCM
+)
+
+// Ciphers lists the supported ciphers
+var Ciphers = []Cipher{CipherAES256GCM, CipherChaCha20Poly1305, CipherXChaCha20Poly1305}
+
+func (c Cipher) String() string {
+	switch c {
+	case CipherAES256GCM:
+		return "aes-256-gcm"
+	case CipherChaCha20Poly1305:
+		return "chacha20-poly1305"
+	case CipherXChaCha20Poly1305:
+		return "xchacha20-poly1305"
+	default:
+		return "unknown"
+	}
+}
+
+// ParseCipher returns the cipher with the given name, as returned by String
+func ParseCipher(name string) (Cipher, error) {
+	for _, c := range Ciphers {
+		if c.String() == name {
+			return c, nil
+		}
+	}
+	return 0, fmt.Errorf("unsupported cipher: %s", name)
+}
+
+// KeySize returns the size of the data key required by the cipher
+func (c Cipher) KeySize() int {
+	switch c {
+	case CipherAES256GCM:
+		return 32
+	case CipherChaCha20Poly1305, CipherXChaCha20Poly1305:
+		return chacha20poly1305.KeySize
+	default:
+		return 0
+	}
+}
+
+// newAEAD creates the AEAD matching the cipher identifier
+func newAEAD(c Cipher, key []byte) (cipher.AEAD, error) {
+	switch c {
+	case CipherAES256GCM:
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create AES cipher: %w", err)
+		}
+
+		aesgcm, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create GCM: %w", err)
+		}
+
+		return aesgcm, nil
+	case CipherChaCha20Poly1305:
+		aead, err := chacha20poly1305.New(key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create ChaCha20-Poly1305 cipher: %w", err)
+		}
+
+		return aead, nil
+	case CipherXChaCha20Poly1305:
+		aead, err := chacha20poly1305.NewX(key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create XChaCha20-Poly1305 cipher: %w", err)
+		}
+
+		return aead, nil
+	default:
+		return nil, fmt.Errorf("unsupported cipher: 0x%02x", uint8(c))
+	}
+}
+
+// Stanza carries the data key wrapped for one recipient
+type Stanza struct {
+	Wrap id.WrapAlgorithm
+	// Hint is the id.KeyHint of the recipient, all zeros when unknown
+	Hint       [id.KeyHintSize]byte
+	WrappedKey []byte
+}
+
+// Header describes how an encrypted blob was produced and
+// holds the data key for each of its recipients
+type Header struct {
+	Version uint8
+	Cipher  Cipher
+	Stanzas []*Stanza
+}
+
+// Encode serializes the header, only the formats sharing the stanza layout
+// (FormatV2 and FormatV3) can be written
+func (h *Header) Encode() ([]byte, error) {
+	if h.Version != FormatV2 && h.Version != FormatV3 {
+		return nil, fmt.Errorf("cannot encode format version: %d", h.Version)
+	}
+	if len(h.Stanzas) == 0 {
+		return nil, fmt.Errorf("envelope has no recipient")
+	}
+	if len(h.Stanzas) > MaxRecipients {
+		return nil, fmt.Errorf("too many recipients: %d", len(h.Stanzas))
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(Magic)
+	buf.WriteByte(h.Version)
+	buf.WriteByte(byte(h.Cipher))
+	binary.Write(&buf, binary.BigEndian, uint16(len(h.Stanzas)))
+
+	for _, s := range h.Stanzas {
+		buf.WriteByte(byte(s.Wrap))
+		buf.Write(s.Hint[:])
+		binary.Write(&buf, binary.BigEndian, uint32(len(s.WrappedKey)))
+		buf.Write(s.WrappedKey)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// HasHeader reports whether the blob starts with a versioned header
+func HasHeader(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(Magic))
+}
+
+// ParseHeader decodes the header at the beginning of data and returns
+// the remaining payload bytes
+func ParseHeader(data []byte) (*Header, []byte, error) {
+	if !HasHeader(data) {
+		return nil, nil, fmt.Errorf("missing header")
+	}
+
+	r := bytes.NewReader(data)
+	h, err := ReadHeader(r)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return h, data[len(data)-r.Len():], nil
+}
+
+// ReadHeader decodes the header from r, leaving r positioned at the payload
+func ReadHeader(r io.Reader) (*Header, error) {
+	magic := make([]byte, len(Magic)+1)
+	if _, err := io.ReadFull(r, magic); err != nil {
+		return nil, fmt.Errorf("invalid header: %w", err)
+	}
+
+	if string(magic[:len(Magic)]) != Magic {
+		return nil, fmt.Errorf("missing header")
+	}
+
+	h := &Header{Version: magic[len(Magic)]}
+
+	switch h.Version {
+	case FormatV1:
+		// a v1 header is a single stanza without hint
+		var fields [2]byte
+		if _, err := io.ReadFull(r, fields[:]); err != nil {
+			return nil, fmt.Errorf("invalid header: %w", err)
+		}
+
+		s := &Stanza{Wrap: id.WrapAlgorithm(fields[0])}
+		h.Cipher = Cipher(fields[1])
+
+		wrapped, err := readWrappedKey(r)
+		if err != nil {
+			return nil, err
+		}
+		s.WrappedKey = wrapped
+		h.Stanzas = []*Stanza{s}
+
+		return h, nil
+	case FormatV2, FormatV3:
+		var fields [3]byte
+		if _, err := io.ReadFull(r, fields[:]); err != nil {
+			return nil, fmt.Errorf("invalid header: %w", err)
+		}
+		h.Cipher = Cipher(fields[0])
+		count := int(binary.BigEndian.Uint16(fields[1:3]))
+
+		for i := 0; i < count; i++ {
+			var prefix [1 + id.KeyHintSize]byte
+			if _, err := io.ReadFull(r, prefix[:]); err != nil {
+				return nil, fmt.Errorf("invalid header: truncated stanza")
+			}
+
+			s := &Stanza{Wrap: id.WrapAlgorithm(prefix[0])}
+			copy(s.Hint[:], prefix[1:])
+
+			// PKCS#1 v1.5 predates the stanza layout, accepting it here would let
+			// anyone reach its padding oracle with a crafted envelope
+			if s.Wrap == id.WrapLegacy || s.Wrap == id.WrapRSAPKCS1v15 {
+				return nil, fmt.Errorf("invalid header: wrap algorithm %s in format version %d", s.Wrap, h.Version)
+			}
+
+			wrapped, err := readWrappedKey(r)
+			if err != nil {
+				return nil, err
+			}
+			s.WrappedKey = wrapped
+			h.Stanzas = append(h.Stanzas, s)
+		}
+
+		return h, nil
+	default:
+		return nil, fmt.Errorf("unsupported format version: %d", h.Version)
+	}
+}
+
+// readWrappedKey reads a [4-byte key len][wrapped key] field
+func readWrappedKey(r io.Reader) ([]byte, error) {
+	var keyLen uint32
+	if err := binary.Read(r, binary.BigEndian, &keyLen); err != nil {
+		return nil, fmt.Errorf("invalid encrypted data format")
+	}
+
+	if keyLen > maxWrappedKeySize {
+		return nil, fmt.Errorf("invalid encrypted data format")
+	}
+
+	wrapped := make([]byte, keyLen)
+	if _, err := io.ReadFull(r, wrapped); err != nil {
+		return nil, fmt.Errorf("invalid encrypted data format")
+	}
+
+	return wrapped, nil
+}
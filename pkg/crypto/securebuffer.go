@@ -0,0 +1,123 @@
+package crypto
+
+import (
+	"io"
+)
+
+// SecureBuffer holds sensitive data, such as decrypted secrets, out of the Go heap.
+// Where supported the memory is locked so that it is never written to swap, and
+// Destroy wipes it. Locking is best effort, it fails beyond RLIMIT_MEMLOCK and the
+// buffer is then only wiped. A buffer must be destroyed, its memory is not
+// garbage collected.
+type SecureBuffer struct {
+	mem    []byte
+	n      int
+	mapped bool
+	locked bool
+}
+
+// NewSecureBuffer allocates a zeroed buffer of the given size
+func NewSecureBuffer(size int) *SecureBuffer {
+	mem, mapped, locked := allocSecure(size)
+	return &SecureBuffer{mem: mem, n: size, mapped: mapped, locked: locked}
+}
+
+// SecureBufferFrom moves data into a new secure buffer, data is wiped
+func SecureBufferFrom(data []byte) *SecureBuffer {
+	b := NewSecureBuffer(len(data))
+	copy(b.mem, data)
+	clear(data)
+	return b
+}
+
+// Bytes returns the content of the buffer, valid until Destroy
+func (b *SecureBuffer) Bytes() []byte {
+	return b.mem[:b.n]
+}
+
+// Len returns the size of the content
+func (b *SecureBuffer) Len() int {
+	return b.n
+}
+
+// Truncate shrinks the content to its first n bytes, the rest is wiped
+func (b *SecureBuffer) Truncate(n int) {
+	if n < 0 || n > b.n {
+		panic("crypto: SecureBuffer truncation out of range")
+	}
+	clear(b.mem[n:b.n])
+	b.n = n
+}
+
+// Write appends p to the content, growing the buffer into new secure memory
+func (b *SecureBuffer) Write(p []byte) (int, error) {
+	if b.n+len(p) > len(b.mem) {
+		b.grow(b.n + len(p))
+	}
+
+	copy(b.mem[b.n:], p)
+	b.n += len(p)
+	return len(p), nil
+}
+
+// grow moves the content into a secure allocation of at least size bytes, the
+// previous one is wiped
+func (b *SecureBuffer) grow(size int) {
+	size = max(size, 2*len(b.mem), 512)
+	mem, mapped, locked := allocSecure(size)
+	copy(mem, b.mem[:b.n])
+
+	clear(b.mem)
+	freeSecure(b.mem, b.mapped, b.locked)
+	b.mem, b.mapped, b.locked = mem, mapped, locked
+}
+
+// Locked reports whether the memory is locked out of swap
+func (b *SecureBuffer) Locked() bool {
+	return b.locked
+}
+
+// Destroy wipes and releases the buffer, it must not be used afterwards
+func (b *SecureBuffer) Destroy() {
+	if b.mem == nil {
+		return
+	}
+
+	clear(b.mem)
+	freeSecure(b.mem, b.mapped, b.locked)
+	b.mem, b.n, b.mapped, b.locked = nil, 0, false, false
+}
+
+// secureCopyBufferSize is the size of the buffer used by SecureCopy
+const secureCopyBufferSize = 32 * 1024
+
+// SecureCopy copies src to dst like io.Copy, through a secure buffer which is
+// wiped once done. Unlike io.Copy it never lets dst or src use buffers of
+// their own (io.ReaderFrom, io.WriterTo) which would not be wiped.
+func SecureCopy(dst io.Writer, src io.Reader) (int64, error) {
+	buf := NewSecureBuffer(secureCopyBufferSize)
+	defer buf.Destroy()
+
+	return io.CopyBuffer(struct{ io.Writer }{dst}, struct{ io.Reader }{src}, buf.Bytes())
+}
+
+// secureReader reads the content of a secure buffer, destroyed on Close
+type secureReader struct {
+	buf *SecureBuffer
+	off int
+}
+
+func (r *secureReader) Read(p []byte) (int, error) {
+	if r.buf.mem == nil || r.off >= r.buf.n {
+		return 0, io.EOF
+	}
+
+	n := copy(p, r.buf.Bytes()[r.off:])
+	r.off += n
+	return n, nil
+}
+
+func (r *secureReader) Close() error {
+	r.buf.Destroy()
+	return nil
+}
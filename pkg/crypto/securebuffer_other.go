@@ -0,0 +1,10 @@
+//go:build !unix
+
+package crypto
+
+// allocSecure allocates on the heap, memory locking is not supported
+func allocSecure(size int) (mem []byte, mapped bool, locked bool) {
+	return make([]byte, size), false, false
+}
+
+func freeSecure(mem []byte, mapped bool, locked bool) {}
@@ -0,0 +1,91 @@
+package crypto
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+// wiped reports whether every byte of data is zero
+func wiped(data []byte) bool {
+	return bytes.Count(data, []byte{0}) == len(data)
+}
+
+func TestSecureBufferFromWipesSource(t *testing.T) {
+	data := []byte("plaintext")
+	b := SecureBufferFrom(data)
+	defer b.Destroy()
+
+	if !wiped(data) {
+		t.Fatal("source of SecureBufferFrom not wiped")
+	}
+	if string(b.Bytes()) != "plaintext" {
+		t.Fatalf("buffer holds %q", b.Bytes())
+	}
+}
+
+func TestSecureBufferTruncateWipes(t *testing.T) {
+	b := SecureBufferFrom([]byte("keep|drop"))
+	defer b.Destroy()
+
+	mem := b.mem
+	b.Truncate(4)
+	if string(b.Bytes()) != "keep" || b.Len() != 4 {
+		t.Fatalf("truncated buffer holds %q", b.Bytes())
+	}
+	if !wiped(mem[4:9]) {
+		t.Fatal("truncated content not wiped")
+	}
+}
+
+func TestSecureBufferDestroyWipes(t *testing.T) {
+	// heap memory as allocSecure falls back to, still readable after Destroy
+	mem := []byte("plaintext")
+	b := &SecureBuffer{mem: mem, n: len(mem)}
+
+	b.Destroy()
+	if !wiped(mem) {
+		t.Fatal("memory not wiped by Destroy")
+	}
+	if b.Len() != 0 || len(b.Bytes()) != 0 {
+		t.Fatal("destroyed buffer still has content")
+	}
+	b.Destroy()
+}
+
+func TestSecureBufferGrowWipes(t *testing.T) {
+	mem := make([]byte, 4)
+	b := &SecureBuffer{mem: mem}
+	defer b.Destroy()
+
+	b.Write([]byte("abcd"))
+	// outgrows the first allocation, the content moves to a new one
+	b.Write(bytes.Repeat([]byte("e"), 1000))
+	if !wiped(mem) {
+		t.Fatal("previous allocation not wiped when growing")
+	}
+	if want := "abcd" + string(bytes.Repeat([]byte("e"), 1000)); string(b.Bytes()) != want {
+		t.Fatal("content lost when growing")
+	}
+}
+
+func TestSecureReaderCloseDestroys(t *testing.T) {
+	mem := []byte("plaintext")
+	r := &secureReader{buf: &SecureBuffer{mem: mem, n: len(mem)}}
+
+	var out bytes.Buffer
+	if _, err := SecureCopy(&out, r); err != nil {
+		t.Fatalf("SecureCopy: %v", err)
+	}
+	if out.String() != "plaintext" {
+		t.Fatalf("copied %q", out.String())
+	}
+
+	r.Close()
+	if !wiped(mem) {
+		t.Fatal("content not wiped on Close")
+	}
+	if n, err := r.Read(make([]byte, 8)); n != 0 || err != io.EOF {
+		t.Fatalf("Read after Close: %d, %v", n, err)
+	}
+}
@@ -0,0 +1,33 @@
+//go:build unix
+
+package crypto
+
+import (
+	"golang.org/x/sys/unix"
+)
+
+// allocSecure maps anonymous memory of its own, so that locking and unlocking it
+// does not affect pages shared with other Go objects. The heap is used when the
+// mapping fails.
+func allocSecure(size int) (mem []byte, mapped bool, locked bool) {
+	if size == 0 {
+		return []byte{}, false, false
+	}
+
+	mem, err := unix.Mmap(-1, 0, size, unix.PROT_READ|unix.PROT_WRITE, unix.MAP_ANON|unix.MAP_PRIVATE)
+	if err != nil {
+		return make([]byte, size), false, false
+	}
+
+	return mem, true, unix.Mlock(mem) == nil
+}
+
+// freeSecure releases memory returned by allocSecure, it is already wiped
+func freeSecure(mem []byte, mapped bool, locked bool) {
+	if locked {
+		unix.Munlock(mem)
+	}
+	if mapped {
+		unix.Munmap(mem)
+	}
+}
@@ -0,0 +1,335 @@
+package crypto
+
+import (
+	"bufio"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/open-zhy/secm/pkg/id"
+)
+
+// The FormatV3 payload is a STREAM construction (Hoang, Reyhanitabar, Rogaway, Vizár):
+// the plaintext is cut into chunks of ChunkSize bytes, each sealed independently with
+// the nonce [random prefix][4-byte chunk counter][last chunk flag]. The prefix is written
+// once right after the header. The counter prevents chunks from being reordered or
+// dropped, and the flag set on the final chunk only reveals truncations at chunk boundary.
+const (
+	// ChunkSize is the size of the plaintext sealed in each chunk
+	ChunkSize = 64 * 1024
+
+	// streamNonceSuffix is the counter and flag part of the chunk nonce
+	streamNonceSuffix = 5
+
+	lastChunkFlag = 0x01
+)
+
+var (
+	ErrTruncated = errors.New("encrypted stream is truncated")
+	// ErrAuthentication is returned when the ciphertext or its associated data was modified
+	ErrAuthentication = errors.New("message authentication failed")
+)
+
+// streamNonce maintains the nonce of the current chunk
+type streamNonce struct {
+	nonce   []byte
+	counter uint32
+}
+
+func (n *streamNonce) next(last bool) ([]byte, error) {
+	if n.counter == math.MaxUint32 {
+		return nil, fmt.Errorf("encrypted stream is too large")
+	}
+
+	prefixLen := len(n.nonce) - streamNonceSuffix
+	binary.BigEndian.PutUint32(n.nonce[prefixLen:], n.counter)
+	n.nonce[len(n.nonce)-1] = 0
+	if last {
+		n.nonce[len(n.nonce)-1] = lastChunkFlag
+	}
+	n.counter++
+
+	return n.nonce, nil
+}
+
+type encryptWriter struct {
+	dst    io.Writer
+	aead   cipher.AEAD
+	ad     []byte
+	nonce  *streamNonce
+	plain  *SecureBuffer
+	buf    []byte
+	sealed []byte
+	closed bool
+}
+
+// NewEncryptWriter returns a writer encrypting everything written to it into dst
+// for the given recipients. The header is written immediately, chunks are written
+// as soon as they are full, and Close must be called to seal the final chunk.
+// Close does not close dst. The associated data is authenticated with every chunk.
+func NewEncryptWriter(dst io.Writer, recipients []id.Encrypter, associatedData []byte) (io.WriteCloser, error) {
+	return NewCipherEncryptWriter(dst, DefaultCipher, recipients, associatedData)
+}
+
+// NewCipherEncryptWriter is NewEncryptWriter with the given payload cipher
+func NewCipherEncryptWriter(dst io.Writer, c Cipher, recipients []id.Encrypter, associatedData []byte) (io.WriteCloser, error) {
+	if c.KeySize() == 0 {
+		return nil, fmt.Errorf("unsupported cipher: 0x%02x", uint8(c))
+	}
+
+	header := &Header{
+		Version: FormatV3,
+		Cipher:  c,
+	}
+
+	// Generate random data key
+	dataKey := make([]byte, header.Cipher.KeySize())
+	defer clear(dataKey)
+	if _, err := io.ReadFull(rand.Reader, dataKey); err != nil {
+		return nil, fmt.Errorf("failed to generate data key: %w", err)
+	}
+
+	// Wrap the data key for every recipient
+	stanzas, err := wrapKey(recipients, dataKey)
+	if err != nil {
+		return nil, err
+	}
+	header.Stanzas = stanzas
+
+	aead, err := newAEAD(header.Cipher, dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	headerBytes, err := header.Encode()
+	if err != nil {
+		return nil, err
+	}
+
+	// Generate the random nonce prefix
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce[:len(nonce)-streamNonceSuffix]); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	if _, err := dst.Write(headerBytes); err != nil {
+		return nil, fmt.Errorf("failed to write header: %w", err)
+	}
+	if _, err := dst.Write(nonce[:len(nonce)-streamNonceSuffix]); err != nil {
+		return nil, fmt.Errorf("failed to write nonce: %w", err)
+	}
+
+	plain := NewSecureBuffer(ChunkSize)
+	return &encryptWriter{
+		dst:    dst,
+		aead:   aead,
+		ad:     associatedData,
+		nonce:  &streamNonce{nonce: nonce},
+		plain:  plain,
+		buf:    plain.Bytes()[:0],
+		sealed: make([]byte, 0, ChunkSize+aead.Overhead()),
+	}, nil
+}
+
+func (w *encryptWriter) Write(p []byte) (int, error) {
+	if w.closed {
+		return 0, fmt.Errorf("write on closed encrypted stream")
+	}
+
+	written := 0
+	for len(p) > 0 {
+		// a full chunk is only flushed once more data comes in,
+		// as it might otherwise be the final one
+		if len(w.buf) == ChunkSize {
+			if err := w.flush(false); err != nil {
+				return written, err
+			}
+		}
+
+		n := copy(w.buf[len(w.buf):ChunkSize], p)
+		w.buf = w.buf[:len(w.buf)+n]
+		p = p[n:]
+		written += n
+	}
+
+	return written, nil
+}
+
+// Close seals the final chunk and wipes the plaintext buffer
+func (w *encryptWriter) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	defer w.plain.Destroy()
+
+	return w.flush(true)
+}
+
+func (w *encryptWriter) flush(last bool) error {
+	nonce, err := w.nonce.next(last)
+	if err != nil {
+		return err
+	}
+
+	w.sealed = w.aead.Seal(w.sealed[:0], nonce, w.buf, w.ad)
+	if _, err := w.dst.Write(w.sealed); err != nil {
+		return fmt.Errorf("failed to write encrypted chunk: %w", err)
+	}
+	w.buf = w.buf[:0]
+
+	return nil
+}
+
+type decryptReader struct {
+	src    *bufio.Reader
+	aead   cipher.AEAD
+	ad     []byte
+	nonce  *streamNonce
+	secure *SecureBuffer
+	chunk  []byte
+	plain  []byte
+	done   bool
+	err    error
+}
+
+// NewDecryptReader returns a reader yielding the plaintext of the data read from src.
+// Chunked (FormatV3) payloads are decrypted incrementally, each chunk being authenticated
+// before it is released; older formats are decrypted in memory. A stream cut short is
+// reported as ErrTruncated, a modified one or a mismatching associated data as ErrAuthentication.
+// The plaintext is held in secure buffers, Close wipes them.
+func NewDecryptReader(src io.Reader, decrypter id.Decrypter, associatedData []byte) (io.ReadCloser, error) {
+	br := bufio.NewReader(src)
+
+	prefix, _ := br.Peek(len(Magic) + 1)
+	if !HasHeader(prefix) || len(prefix) <= len(Magic) || prefix[len(Magic)] != FormatV3 {
+		data, err := io.ReadAll(br)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read encrypted data: %w", err)
+		}
+
+		plaintext, err := DecryptData(decrypter, data, associatedData)
+		if err != nil {
+			return nil, err
+		}
+
+		return &secureReader{buf: plaintext}, nil
+	}
+
+	header, err := ReadHeader(br)
+	if err != nil {
+		return nil, err
+	}
+
+	dataKey, err := unwrapKey(decrypter, header)
+	if err != nil {
+		return nil, err
+	}
+	defer clear(dataKey)
+
+	return newChunkReader(br, header.Cipher, dataKey, associatedData)
+}
+
+// newChunkReader reads the nonce prefix and returns a reader over the chunks
+func newChunkReader(src io.Reader, c Cipher, dataKey []byte, associatedData []byte) (*decryptReader, error) {
+	aead, err := newAEAD(c, dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(src, nonce[:len(nonce)-streamNonceSuffix]); err != nil {
+		return nil, ErrTruncated
+	}
+
+	br, ok := src.(*bufio.Reader)
+	if !ok {
+		br = bufio.NewReader(src)
+	}
+
+	// chunks are opened in place, the buffer holds the plaintext
+	secure := NewSecureBuffer(ChunkSize + aead.Overhead())
+	return &decryptReader{
+		src:    br,
+		aead:   aead,
+		ad:     associatedData,
+		nonce:  &streamNonce{nonce: nonce},
+		secure: secure,
+		chunk:  secure.Bytes(),
+	}, nil
+}
+
+func (r *decryptReader) Read(p []byte) (int, error) {
+	if len(r.plain) == 0 && r.err == nil && !r.done {
+		r.err = r.next()
+	}
+
+	if len(r.plain) > 0 {
+		n := copy(p, r.plain)
+		r.plain = r.plain[n:]
+		return n, nil
+	}
+
+	// nothing is left to read, the plaintext is wiped without waiting for Close
+	r.Close()
+
+	if r.err != nil {
+		return 0, r.err
+	}
+
+	return 0, io.EOF
+}
+
+// Close wipes the plaintext buffer
+func (r *decryptReader) Close() error {
+	r.secure.Destroy()
+	r.chunk, r.plain = nil, nil
+	if r.err == nil && !r.done {
+		r.err = fmt.Errorf("read on closed encrypted stream")
+	}
+	return nil
+}
+
+// next reads and opens the following chunk
+func (r *decryptReader) next() error {
+	n, err := io.ReadFull(r.src, r.chunk)
+	switch {
+	case err == io.EOF:
+		// the final chunk is never empty, it holds at least the AEAD tag
+		return ErrTruncated
+	case err == io.ErrUnexpectedEOF:
+		r.done = true
+	case err != nil:
+		return fmt.Errorf("failed to read encrypted chunk: %w", err)
+	default:
+		// a full chunk is the final one only if nothing follows
+		if _, err := r.src.Peek(1); err == io.EOF {
+			r.done = true
+		}
+	}
+
+	if n < r.aead.Overhead() {
+		return ErrTruncated
+	}
+
+	nonce, err := r.nonce.next(r.done)
+	if err != nil {
+		return err
+	}
+
+	plain, err := r.aead.Open(r.chunk[:0], nonce, r.chunk[:n], r.ad)
+	if err != nil {
+		if r.done && r.nonce.counter > 1 {
+			// either tampered or cut right after a chunk that was not the final one
+			return fmt.Errorf("failed to decrypt final chunk, data is corrupted or %w", ErrTruncated)
+		}
+		return fmt.Errorf("failed to decrypt chunk: %w", ErrAuthentication)
+	}
+	r.plain = plain
+
+	return nil
+}
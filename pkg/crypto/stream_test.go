@@ -0,0 +1,200 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/open-zhy/secm/pkg/id"
+)
+
+func newTestIdentity(t *testing.T) id.KeyPackageIdentity {
+	t.Helper()
+	identity, err := id.GenerateKey(id.GenerateKeyOpts{Type: "ec25519"})
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	return identity
+}
+
+func randomBytes(t *testing.T, n int) []byte {
+	t.Helper()
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// encryptStream encrypts plaintext in a FormatV3 envelope and returns it along
+// with the offset of the first chunk
+func encryptStream(t *testing.T, c Cipher, identity id.KeyPackageIdentity, plaintext, ad []byte) ([]byte, int) {
+	t.Helper()
+	var buf bytes.Buffer
+	w, err := NewCipherEncryptWriter(&buf, c, []id.Encrypter{identity.PublicKey()}, ad)
+	if err != nil {
+		t.Fatalf("NewCipherEncryptWriter: %v", err)
+	}
+	if _, err := w.Write(plaintext); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	r := bytes.NewReader(buf.Bytes())
+	if _, err := ReadHeader(r); err != nil {
+		t.Fatalf("ReadHeader: %v", err)
+	}
+	aead, err := newAEAD(c, make([]byte, c.KeySize()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	offset := buf.Len() - r.Len() + aead.NonceSize() - streamNonceSuffix
+
+	return buf.Bytes(), offset
+}
+
+func decryptStream(identity id.Decrypter, data, ad []byte) ([]byte, error) {
+	r, err := NewDecryptReader(bytes.NewReader(data), identity, ad)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	return io.ReadAll(r)
+}
+
+func TestStreamRoundTrip(t *testing.T) {
+	identity := newTestIdentity(t)
+	ad := []byte("associated data")
+
+	for _, c := range Ciphers {
+		for _, size := range []int{0, 1, ChunkSize - 1, ChunkSize, ChunkSize + 1, 2*ChunkSize + 100} {
+			plaintext := randomBytes(t, size)
+			data, _ := encryptStream(t, c, identity, plaintext, ad)
+
+			got, err := decryptStream(identity, data, ad)
+			if err != nil {
+				t.Fatalf("%s, %d bytes: decrypt: %v", c, size, err)
+			}
+			if !bytes.Equal(got, plaintext) {
+				t.Fatalf("%s, %d bytes: plaintext mismatch", c, size)
+			}
+		}
+	}
+}
+
+func TestStreamWrongAssociatedData(t *testing.T) {
+	identity := newTestIdentity(t)
+	data, _ := encryptStream(t, DefaultCipher, identity, randomBytes(t, 100), []byte("id-1"))
+
+	if _, err := decryptStream(identity, data, []byte("id-2")); !errors.Is(err, ErrAuthentication) {
+		t.Fatalf("decrypt with another associated data: got %v, want ErrAuthentication", err)
+	}
+}
+
+func TestStreamTruncated(t *testing.T) {
+	identity := newTestIdentity(t)
+	plaintext := randomBytes(t, 2*ChunkSize+100)
+	data, offset := encryptStream(t, DefaultCipher, identity, plaintext, nil)
+	sealedChunk := ChunkSize + 16
+
+	for name, end := range map[string]int{
+		"at chunk boundary": offset + 2*sealedChunk,
+		"inside a chunk":    offset + sealedChunk + 10,
+		"after the nonce":   offset,
+		"inside the nonce":  offset - 2,
+	} {
+		_, err := decryptStream(identity, data[:end], nil)
+		if err == nil {
+			t.Fatalf("%s: truncated stream decrypted", name)
+		}
+	}
+
+	// dropping whole final chunks is detected as a truncation
+	if _, err := decryptStream(identity, data[:offset+2*sealedChunk], nil); !errors.Is(err, ErrTruncated) {
+		t.Fatalf("stream cut at chunk boundary: got %v, want ErrTruncated", err)
+	}
+}
+
+func TestStreamChunksReordered(t *testing.T) {
+	identity := newTestIdentity(t)
+	data, offset := encryptStream(t, DefaultCipher, identity, randomBytes(t, 3*ChunkSize), nil)
+	sealedChunk := ChunkSize + 16
+
+	swapped := append([]byte(nil), data...)
+	first := data[offset : offset+sealedChunk]
+	second := data[offset+sealedChunk : offset+2*sealedChunk]
+	copy(swapped[offset:], second)
+	copy(swapped[offset+sealedChunk:], first)
+
+	if _, err := decryptStream(identity, swapped, nil); !errors.Is(err, ErrAuthentication) {
+		t.Fatalf("reordered chunks: got %v, want ErrAuthentication", err)
+	}
+}
+
+// sealChunks builds a chunked payload sealing every chunk with the given final flag
+func sealChunks(t *testing.T, key []byte, chunks [][]byte, last []bool) []byte {
+	t.Helper()
+	aead, err := newAEAD(DefaultCipher, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	copy(nonce, randomBytes(t, len(nonce)-streamNonceSuffix))
+	out := append([]byte(nil), nonce[:len(nonce)-streamNonceSuffix]...)
+
+	n := &streamNonce{nonce: nonce}
+	for i, chunk := range chunks {
+		chunkNonce, err := n.next(last[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		out = aead.Seal(out, chunkNonce, chunk, nil)
+	}
+
+	return out
+}
+
+func readChunks(key, payload []byte) ([]byte, error) {
+	r, err := newChunkReader(bytes.NewReader(payload), DefaultCipher, key, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	return io.ReadAll(r)
+}
+
+func TestStreamFinalFlag(t *testing.T) {
+	key := randomBytes(t, DefaultCipher.KeySize())
+	full := randomBytes(t, ChunkSize)
+	tail := randomBytes(t, 10)
+
+	payload := sealChunks(t, key, [][]byte{full, tail}, []bool{false, true})
+	if got, err := readChunks(key, payload); err != nil || !bytes.Equal(got, append(full, tail...)) {
+		t.Fatalf("well-formed payload: err %v", err)
+	}
+
+	// a final chunk followed by more data
+	payload = sealChunks(t, key, [][]byte{full, tail}, []bool{true, true})
+	if _, err := readChunks(key, payload); !errors.Is(err, ErrAuthentication) {
+		t.Fatalf("final flag on an intermediate chunk: got %v, want ErrAuthentication", err)
+	}
+
+	// the last chunk is not flagged as final, the stream was cut
+	payload = sealChunks(t, key, [][]byte{full, tail}, []bool{false, false})
+	if _, err := readChunks(key, payload); !errors.Is(err, ErrTruncated) {
+		t.Fatalf("missing final flag: got %v, want ErrTruncated", err)
+	}
+
+	// a single chunk must be final as well
+	payload = sealChunks(t, key, [][]byte{tail}, []bool{false})
+	if _, err := readChunks(key, payload); err == nil {
+		t.Fatal("single chunk without final flag decrypted")
+	}
+}
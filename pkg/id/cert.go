@@ -0,0 +1,132 @@
+package id
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+)
+
+// CertificateType is the PEM block type of X.509 certificates
+const CertificateType = "CERTIFICATE"
+
+// IsCertificate reports whether the PEM data holds a certificate
+func IsCertificate(data []byte) bool {
+	block, _ := pem.Decode(data)
+	return block != nil && block.Type == CertificateType
+}
+
+// ParseCertificates parses the PEM certificates of data, the leaf certificate
+// first, optionally followed by the intermediates up to the trust anchor
+func ParseCertificates(data []byte) ([]*x509.Certificate, error) {
+	var chain []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != CertificateType {
+			continue
+		}
+
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse certificate: %w", err)
+		}
+		chain = append(chain, cert)
+	}
+
+	if len(chain) == 0 {
+		return nil, fmt.Errorf("no certificate found")
+	}
+
+	return chain, nil
+}
+
+// LoadCertificateFile loads the certificates of a PEM file, see ParseCertificates
+func LoadCertificateFile(path string) ([]*x509.Certificate, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read certificate file: %w", err)
+	}
+
+	return ParseCertificates(data)
+}
+
+// LoadCertPoolFile loads a bundle of PEM trust anchors
+func LoadCertPoolFile(path string) (*x509.CertPool, error) {
+	certs, err := LoadCertificateFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load trust anchors: %w", err)
+	}
+
+	pool := x509.NewCertPool()
+	for _, cert := range certs {
+		pool.AddCert(cert)
+	}
+
+	return pool, nil
+}
+
+// CertificatePublicKey returns the recipient public key of the certificate
+func CertificatePublicKey(cert *x509.Certificate) (PublicKey, error) {
+	return publicKeyFromCrypto(cert.PublicKey)
+}
+
+// VerifyRecipientCertificate checks that the leaf certificate of chain chains up
+// to one of the trust anchors, is within its validity period, and that its key
+// usage allows to wrap keys for it. It returns the public key of the leaf.
+func VerifyRecipientCertificate(chain []*x509.Certificate, roots *x509.CertPool) (PublicKey, error) {
+	if len(chain) == 0 {
+		return nil, fmt.Errorf("no certificate found")
+	}
+	leaf := chain[0]
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range chain[1:] {
+		intermediates.AddCert(cert)
+	}
+
+	_, err := leaf.Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("certificate of %s is not trusted: %w", leaf.Subject, err)
+	}
+
+	if err := checkWrapKeyUsage(leaf); err != nil {
+		return nil, err
+	}
+
+	return CertificatePublicKey(leaf)
+}
+
+// checkWrapKeyUsage requires keyEncipherment for RSA keys and keyAgreement for
+// elliptic curve keys, a certificate without key usage extension is unrestricted
+func checkWrapKeyUsage(cert *x509.Certificate) error {
+	if cert.KeyUsage == 0 {
+		return nil
+	}
+
+	var required x509.KeyUsage
+	switch cert.PublicKey.(type) {
+	case *rsa.PublicKey:
+		required = x509.KeyUsageKeyEncipherment
+	case *ecdsa.PublicKey, ed25519.PublicKey:
+		required = x509.KeyUsageKeyAgreement
+	default:
+		return fmt.Errorf("unsupported certificate key type %T", cert.PublicKey)
+	}
+
+	if cert.KeyUsage&required == 0 {
+		return fmt.Errorf("certificate of %s does not allow key encipherment or agreement", cert.Subject)
+	}
+
+	return nil
+}
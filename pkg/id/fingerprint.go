@@ -0,0 +1,214 @@
+package id
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"strings"
+)
+
+// FingerprintPrefix is prepended to the hex encoding of fingerprints
+const FingerprintPrefix = "SHA256:"
+
+// minFingerprintPrefix is the number of hex digits an expected fingerprint must
+// at least have, 64 bits
+const minFingerprintPrefix = 16
+
+// Fingerprint identifies a public key: the SHA-256 of its SubjectPublicKeyInfo
+// (SPKI) encoding, whatever format the key was read from
+type Fingerprint [sha256.Size]byte
+
+// PublicKeyFingerprint returns the fingerprint of a recipient public key
+func PublicKeyFingerprint(pub PublicKey) (Fingerprint, error) {
+	spki, err := marshalSPKI(pub)
+	if err != nil {
+		return Fingerprint{}, fmt.Errorf("failed to marshal public key: %w", err)
+	}
+
+	return sha256.Sum256(spki), nil
+}
+
+// VerifyingKeyFingerprint returns the fingerprint of a signing key
+func VerifyingKeyFingerprint(key VerifyingKey) Fingerprint {
+	return sha256.Sum256(key.Bytes())
+}
+
+// marshalSPKI returns the DER SPKI of the key. RSA public keys are written as
+// PKCS#1 by Encode, keys unknown to crypto/x509 already write their SPKI, and
+// provider recipients their opaque block.
+func marshalSPKI(pub PublicKey) ([]byte, error) {
+	switch k := pub.(type) {
+	case *RSAPublicKey:
+		return x509.MarshalPKIXPublicKey(k.pub)
+	case *ECPublicKey:
+		return x509.MarshalPKIXPublicKey(k.pub)
+	case *Ed25519PublicKey:
+		return x509.MarshalPKIXPublicKey(k.ed)
+	}
+
+	var buf bytes.Buffer
+	if err := pub.Encode(&buf); err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(buf.Bytes())
+	if block == nil {
+		return nil, fmt.Errorf("failed to decode PEM block")
+	}
+
+	return block.Bytes, nil
+}
+
+// PublicKeyType returns a short name of the key type, e.g. RSA-2048 or X25519
+func PublicKeyType(pub PublicKey) string {
+	switch k := pub.(type) {
+	case *RSAPublicKey:
+		return fmt.Sprintf("RSA-%d", k.pub.N.BitLen())
+	case *ECPublicKey:
+		return fmt.Sprint(k.Curve())
+	case *Ed25519PublicKey:
+		return "ED25519"
+	case *MLKEMPublicKey:
+		return "MLKEM768-X25519"
+	case *ProviderPublicKey:
+		return strings.ToUpper(k.provider)
+	default:
+		return ""
+	}
+}
+
+// String returns the prefixed hex encoding, SHA256:<64 hex digits>
+func (f Fingerprint) String() string {
+	return FingerprintPrefix + hex.EncodeToString(f[:])
+}
+
+// Short returns the first 64 bits in groups of 4 hex digits, meant to be read
+// aloud and compared, e.g. over the phone
+func (f Fingerprint) Short() string {
+	digits := hex.EncodeToString(f[:minFingerprintPrefix/2])
+
+	groups := make([]string, 0, len(digits)/4)
+	for i := 0; i < len(digits); i += 4 {
+		groups = append(groups, digits[i:i+4])
+	}
+
+	return strings.Join(groups, " ")
+}
+
+// Matches reports whether expected designates the fingerprint. Expected is the
+// hex encoding, with or without prefix, spaces or colons, and may be shortened
+// down to 16 hex digits.
+func (f Fingerprint) Matches(expected string) (bool, error) {
+	expected = strings.TrimPrefix(strings.TrimSpace(expected), FingerprintPrefix)
+	expected = strings.ToLower(strings.NewReplacer(" ", "", ":", "").Replace(expected))
+
+	if strings.Trim(expected, "0123456789abcdef") != "" {
+		return false, fmt.Errorf("invalid fingerprint %q: not hex encoded", expected)
+	}
+	if len(expected) < minFingerprintPrefix || len(expected) > 2*sha256.Size {
+		return false, fmt.Errorf("invalid fingerprint %q: between %d and %d hex digits expected", expected, minFingerprintPrefix, 2*sha256.Size)
+	}
+
+	return strings.HasPrefix(hex.EncodeToString(f[:]), expected), nil
+}
+
+// CheckFingerprint fails unless the fingerprint of the public key matches one of the
+// expected ones, see Matches. Any key is accepted when none is expected.
+func CheckFingerprint(pub PublicKey, expected ...string) error {
+	if len(expected) == 0 {
+		return nil
+	}
+
+	fingerprint, err := PublicKeyFingerprint(pub)
+	if err != nil {
+		return err
+	}
+
+	for _, e := range expected {
+		ok, err := fingerprint.Matches(e)
+		if err != nil {
+			return err
+		}
+		if ok {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("public key fingerprint %s does not match the expected one", fingerprint)
+}
+
+// randomart board, as drawn by OpenSSH
+const (
+	randomartWidth   = 17
+	randomartHeight  = 9
+	randomartSymbols = " .o+=*BOX@%&#/^SE"
+)
+
+// Randomart draws the fingerprint with the "drunken bishop" algorithm of OpenSSH,
+// a picture being easier to compare at a glance than hex digits
+func (f Fingerprint) Randomart(title string) string {
+	var board [randomartWidth][randomartHeight]int
+	x, y := randomartWidth/2, randomartHeight/2
+	startX, startY := x, y
+
+	// each byte moves the bishop four times, two bits per move, least significant first
+	for _, b := range f {
+		for i := 0; i < 4; i++ {
+			if b&0x1 != 0 {
+				x++
+			} else {
+				x--
+			}
+			if b&0x2 != 0 {
+				y++
+			} else {
+				y--
+			}
+			x = max(0, min(x, randomartWidth-1))
+			y = max(0, min(y, randomartHeight-1))
+
+			if board[x][y] < len(randomartSymbols)-3 {
+				board[x][y]++
+			}
+			b >>= 2
+		}
+	}
+
+	var sb strings.Builder
+	sb.WriteString(randomartBorder(title))
+	for row := 0; row < randomartHeight; row++ {
+		sb.WriteByte('|')
+		for col := 0; col < randomartWidth; col++ {
+			switch {
+			case col == startX && row == startY:
+				sb.WriteByte('S')
+			case col == x && row == y:
+				sb.WriteByte('E')
+			default:
+				sb.WriteByte(randomartSymbols[board[col][row]])
+			}
+		}
+		sb.WriteString("|\n")
+	}
+	sb.WriteString(randomartBorder("SHA256"))
+
+	return sb.String()
+}
+
+// randomartBorder returns the top or bottom border with the label centered in it
+func randomartBorder(label string) string {
+	if label != "" {
+		label = "[" + label + "]"
+	}
+	if len(label) > randomartWidth {
+		label = label[:randomartWidth]
+	}
+
+	left := (randomartWidth - len(label)) / 2
+	right := randomartWidth - len(label) - left
+
+	return "+" + strings.Repeat("-", left) + label + strings.Repeat("-", right) + "+\n"
+}
@@ -33,6 +33,11 @@ func GenerateKey(opt GenerateKeyOpts) (identity KeyPackageIdentity, err error) {
 			return nil, err
 		}
 		identity = createECDHIdKey(pk.(*ecdh.PrivateKey))
+	case "ed25519":
+		identity, err = generateEd25519IdKey()
+		if err != nil {
+			return nil, err
+		}
 	case "p256":
 		pk, err = ecdh.P256().GenerateKey(rand.Reader)
 		if err != nil {
@@ -51,6 +56,11 @@ func GenerateKey(opt GenerateKeyOpts) (identity KeyPackageIdentity, err error) {
 			return nil, err
 		}
 		identity = createECDHIdKey(pk.(*ecdh.PrivateKey))
+	case "mlkem768-x25519":
+		identity, err = generateMLKEMIdKey()
+		if err != nil {
+			return nil, err
+		}
 	default:
 		return nil, errors.New("unsupported key type: %s", opt.Type)
 	}
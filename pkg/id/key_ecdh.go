@@ -5,7 +5,9 @@ import (
 	"crypto/cipher"
 	"crypto/ecdh"
 	"crypto/ecdsa"
+	"crypto/hkdf"
 	"crypto/rand"
+	"crypto/sha256"
 	"crypto/x509"
 	"encoding/pem"
 	"fmt"
@@ -50,6 +52,18 @@ func cutKeyLength(pubKey []byte) []byte {
 	return pubKey[:16]
 }
 
+// eciesInfo is the HKDF context of WrapECIESHKDFSHA256
+const eciesInfo = "secm ecies-hkdf-sha256 v1"
+
+// eciesKey derives the wrapping key from the ECDH shared secret, the salt binds
+// the ephemeral and recipient public keys so the key is specific to this exchange
+func eciesKey(sharedSecret []byte, ephemeral, recipient *ecdh.PublicKey) ([]byte, error) {
+	salt := append(ephemeral.Bytes(), recipient.Bytes()...)
+	return hkdf.Key(sha256.New, sharedSecret, salt, eciesInfo, 32)
+}
+
+// Encrypt wraps the key in an ECIES-style construction:
+// [ephemeral public key][AES-256-GCM sealed key]
 func (kp *ECPublicKey) Encrypt(plaintext []byte, key []byte) ([]byte, error) {
 	// Generate ephemeral key pair
 	curve := kp.pub.Curve()
@@ -63,58 +77,37 @@ func (kp *ECPublicKey) Encrypt(plaintext []byte, key []byte) ([]byte, error) {
 	if err != nil {
 		return nil, fmt.Errorf("failed to perform ECDH: %w", err)
 	}
+	defer clear(sharedSecret)
 
-	// Create AES cipher from shared secret
-	block, err := aes.NewCipher(cutKeyLength(sharedSecret))
-	if err != nil {
-		return nil, fmt.Errorf("failed to create AES cipher: %w", err)
-	}
-
-	// Generate random nonce
-	nonce := make([]byte, 12)
-	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
-		return nil, fmt.Errorf("failed to generate nonce: %w", err)
-	}
-
-	// Create GCM mode
-	aesgcm, err := cipher.NewGCM(block)
+	wrapKey, err := eciesKey(sharedSecret, ephemeral.PublicKey(), kp.pub)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create GCM: %w", err)
+		return nil, fmt.Errorf("failed to derive wrapping key: %w", err)
 	}
+	defer clear(wrapKey)
 
-	// Encrypt the AES key
-	ciphertext := aesgcm.Seal(nil, nonce, key, nil)
-
-	// Marshal ephemeral public key
-	ephemeralPubBytes, err := x509.MarshalPKIXPublicKey(ephemeral.PublicKey())
+	aesgcm, err := newGCM(wrapKey)
 	if err != nil {
-		return nil, fmt.Errorf("failed to marshal ephemeral public key: %w", err)
+		return nil, err
 	}
 
-	// Format: [ephemeral pubkey length (4 bytes)][ephemeral pubkey][nonce][encrypted key]
-	pubLen := len(ephemeralPubBytes)
-	result := make([]byte, 4+pubLen+len(nonce)+len(ciphertext))
-
-	// Store pubkey length
-	result[0] = byte(pubLen >> 24)
-	result[1] = byte(pubLen >> 16)
-	result[2] = byte(pubLen >> 8)
-	result[3] = byte(pubLen)
+	// the wrapping key is never reused, a zero nonce is safe
+	nonce := make([]byte, aesgcm.NonceSize())
 
-	// Copy ephemeral public key
-	copy(result[4:], ephemeralPubBytes)
-	// Copy nonce
-	copy(result[4+pubLen:], nonce)
-	// Copy encrypted key
-	copy(result[4+pubLen+len(nonce):], ciphertext)
+	return aesgcm.Seal(ephemeral.PublicKey().Bytes(), nonce, key, nil), nil
+}
 
-	return result, nil
+func (kp *ECPublicKey) Algorithm() WrapAlgorithm {
+	return WrapECIESHKDFSHA256
 }
 
 func (kp *ECPublicKey) Bytes() []byte {
 	return kp.pub.Bytes()
 }
 
+func (kp *ECPublicKey) Curve() ecdh.Curve {
+	return kp.pub.Curve()
+}
+
 type ECDHIdKey struct {
 	pk *ecdh.PrivateKey
 }
@@ -125,6 +118,15 @@ func (k *ECDHIdKey) PublicKey() PublicKey {
 	}
 }
 
+func (k *ECDHIdKey) Curve() ecdh.Curve {
+	return k.pk.Curve()
+}
+
+// ECDH computes the shared secret with the remote public key
+func (k *ECDHIdKey) ECDH(remote *ecdh.PublicKey) ([]byte, error) {
+	return k.pk.ECDH(remote)
+}
+
 func (k *ECDHIdKey) Encode(dst io.Writer) error {
 	pemBytes, err := x509.MarshalPKCS8PrivateKey(k.pk)
 	if err != nil {
@@ -138,7 +140,59 @@ func (k *ECDHIdKey) Encode(dst io.Writer) error {
 	return pem.Encode(dst, pemBlock)
 }
 
-func (k *ECDHIdKey) Decrypt(ciphertext []byte) ([]byte, error) {
+func (k *ECDHIdKey) Decrypt(alg WrapAlgorithm, ciphertext []byte) ([]byte, error) {
+	switch alg {
+	case WrapECIESHKDFSHA256:
+		return k.decryptECIES(ciphertext)
+	case WrapLegacy, WrapECDHAESGCM:
+		// only found on secrets written before HKDF, see `secm migrate`
+		return k.decryptTruncated(ciphertext)
+	default:
+		return nil, fmt.Errorf("unsupported wrap algorithm for ECDH key: %s", alg)
+	}
+}
+
+// decryptECIES unwraps [ephemeral public key][AES-256-GCM sealed key]
+func (k *ECDHIdKey) decryptECIES(ciphertext []byte) ([]byte, error) {
+	pubLen := len(k.pk.PublicKey().Bytes())
+	if len(ciphertext) < pubLen {
+		return nil, fmt.Errorf("invalid ciphertext format: too short")
+	}
+
+	ephemeral, err := k.pk.Curve().NewPublicKey(ciphertext[:pubLen])
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse ephemeral public key: %w", err)
+	}
+
+	sharedSecret, err := k.pk.ECDH(ephemeral)
+	if err != nil {
+		return nil, fmt.Errorf("failed to perform ECDH: %w", err)
+	}
+	defer clear(sharedSecret)
+
+	wrapKey, err := eciesKey(sharedSecret, ephemeral, k.pk.PublicKey())
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive wrapping key: %w", err)
+	}
+	defer clear(wrapKey)
+
+	aesgcm, err := newGCM(wrapKey)
+	if err != nil {
+		return nil, err
+	}
+
+	plaintext, err := aesgcm.Open(nil, make([]byte, aesgcm.NonceSize()), ciphertext[pubLen:], nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt key: %w", err)
+	}
+
+	return plaintext, nil
+}
+
+// decryptTruncated unwraps the historical format:
+// [ephemeral pubkey length (4 bytes)][ephemeral pubkey][nonce][encrypted key]
+// where the raw shared secret is truncated into an AES key
+func (k *ECDHIdKey) decryptTruncated(ciphertext []byte) ([]byte, error) {
 	if len(ciphertext) < 4 {
 		return nil, fmt.Errorf("invalid ciphertext format: too short")
 	}
@@ -183,6 +237,7 @@ func (k *ECDHIdKey) Decrypt(ciphertext []byte) ([]byte, error) {
 	if err != nil {
 		return nil, fmt.Errorf("failed to perform ECDH: %w", err)
 	}
+	defer clear(sharedSecret)
 
 	// Create AES cipher from shared secret
 	block, err := aes.NewCipher(cutKeyLength(sharedSecret))
@@ -214,6 +269,20 @@ func (k *ECDHIdKey) Decrypt(ciphertext []byte) ([]byte, error) {
 	return plaintext, nil
 }
 
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create AES cipher: %w", err)
+	}
+
+	aesgcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create GCM: %w", err)
+	}
+
+	return aesgcm, nil
+}
+
 func createECDHIdKey(pk *ecdh.PrivateKey) *ECDHIdKey {
 	return &ECDHIdKey{pk: pk}
 }
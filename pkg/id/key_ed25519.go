@@ -0,0 +1,139 @@
+package id
+
+import (
+	"crypto/ecdh"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha512"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io"
+
+	"filippo.io/edwards25519"
+)
+
+// Ed25519 keys cannot do Diffie-Hellman themselves, data keys are wrapped to the
+// birationally equivalent X25519 key instead (the Montgomery form of the same
+// curve), with the same ECIES construction as ec25519 identities. This is what
+// lets ssh-ed25519 keys be used as identities and recipients.
+
+type Ed25519PublicKey struct {
+	ed ed25519.PublicKey
+	x  *ECPublicKey
+}
+
+func newEd25519PublicKey(pub ed25519.PublicKey) (*Ed25519PublicKey, error) {
+	x, err := ed25519PublicKeyToX25519(pub)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Ed25519PublicKey{ed: pub, x: &ECPublicKey{pub: x}}, nil
+}
+
+func (kp *Ed25519PublicKey) Encode(dst io.Writer) error {
+	pubBytes, err := x509.MarshalPKIXPublicKey(kp.ed)
+	if err != nil {
+		return fmt.Errorf("failed to marshal public key: %w", err)
+	}
+
+	if err := pem.Encode(dst, &pem.Block{Type: "PUBLIC KEY", Bytes: pubBytes}); err != nil {
+		return fmt.Errorf("failed to write public key: %w", err)
+	}
+
+	return nil
+}
+
+// Encrypt wraps the key to the X25519 form of the public key
+func (kp *Ed25519PublicKey) Encrypt(plaintext []byte, key []byte) ([]byte, error) {
+	return kp.x.Encrypt(plaintext, key)
+}
+
+func (kp *Ed25519PublicKey) Algorithm() WrapAlgorithm {
+	return kp.x.Algorithm()
+}
+
+// Bytes returns the Edwards encoding of the public key
+func (kp *Ed25519PublicKey) Bytes() []byte {
+	return kp.ed
+}
+
+type Ed25519IdKey struct {
+	pk ed25519.PrivateKey
+	x  *ECDHIdKey
+}
+
+func createEd25519IdKey(pk ed25519.PrivateKey) (*Ed25519IdKey, error) {
+	x, err := ed25519PrivateKeyToX25519(pk)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Ed25519IdKey{pk: pk, x: createECDHIdKey(x)}, nil
+}
+
+func generateEd25519IdKey() (*Ed25519IdKey, error) {
+	_, pk, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	return createEd25519IdKey(pk)
+}
+
+func (k *Ed25519IdKey) PublicKey() PublicKey {
+	return &Ed25519PublicKey{
+		ed: k.pk.Public().(ed25519.PublicKey),
+		x:  k.x.PublicKey().(*ECPublicKey),
+	}
+}
+
+func (k *Ed25519IdKey) Encode(dst io.Writer) error {
+	pemBytes, err := x509.MarshalPKCS8PrivateKey(k.pk)
+	if err != nil {
+		return fmt.Errorf("failed to marshal private key: %s", err)
+	}
+	pemBlock := &pem.Block{
+		Type:  "PRIVATE KEY",
+		Bytes: pemBytes,
+	}
+
+	return pem.Encode(dst, pemBlock)
+}
+
+// Decrypt unwraps the key with the X25519 form of the private key
+func (k *Ed25519IdKey) Decrypt(alg WrapAlgorithm, ciphertext []byte) ([]byte, error) {
+	return k.x.Decrypt(alg, ciphertext)
+}
+
+// ed25519PublicKeyToX25519 maps the Edwards point to its Montgomery u-coordinate,
+// u = (1 + y) / (1 - y) (RFC 7748, section 4.1)
+func ed25519PublicKeyToX25519(pub ed25519.PublicKey) (*ecdh.PublicKey, error) {
+	p, err := new(edwards25519.Point).SetBytes(pub)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Ed25519 public key: %w", err)
+	}
+
+	x, err := ecdh.X25519().NewPublicKey(p.BytesMontgomery())
+	if err != nil {
+		return nil, fmt.Errorf("failed to create X25519 public key: %w", err)
+	}
+
+	return x, nil
+}
+
+// ed25519PrivateKeyToX25519 derives the X25519 scalar the way Ed25519 derives its
+// own from the seed, the first half of SHA-512(seed), clamped by X25519. The
+// resulting public key is the Montgomery form of the Ed25519 one.
+func ed25519PrivateKeyToX25519(pk ed25519.PrivateKey) (*ecdh.PrivateKey, error) {
+	h := sha512.Sum512(pk.Seed())
+	defer clear(h[:])
+
+	x, err := ecdh.X25519().NewPrivateKey(h[:32])
+	if err != nil {
+		return nil, fmt.Errorf("failed to create X25519 private key: %w", err)
+	}
+
+	return x, nil
+}
@@ -0,0 +1,292 @@
+package id
+
+import (
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/hkdf"
+	"crypto/mlkem"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha3"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"fmt"
+	"io"
+)
+
+// The mlkem768-x25519 key type is the X-Wing hybrid KEM (draft-connolly-cfrg-xwing-kem):
+// ML-KEM-768 and X25519 shared secrets are combined with SHA3-256, so that a wrapped data
+// key stays confidential as long as either of them is unbroken, including against a
+// future quantum computer recording ciphertexts today.
+const (
+	// xwingSeedSize is the size of the private key, both key pairs are expanded from it
+	xwingSeedSize = 32
+	// xwingPublicKeySize is [ML-KEM-768 encapsulation key][X25519 public key]
+	xwingPublicKeySize = mlkem.EncapsulationKeySize768 + 32
+	// xwingCiphertextSize is [ML-KEM-768 ciphertext][X25519 ephemeral public key]
+	xwingCiphertextSize = mlkem.CiphertextSize768 + 32
+
+	// xwingLabel is the X-Wing combiner label, \./ over /^\
+	xwingLabel = `\./` + `/^\`
+
+	// xwingWrapInfo is the HKDF context deriving the key wrapping the data key
+	xwingWrapInfo = "secm mlkem768-x25519 v1"
+)
+
+// oidXWing is the algorithm identifier of X-Wing keys in PKCS#8 and SPKI structures
+var oidXWing = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 62253, 25722}
+
+// pkcs8 mirrors the PrivateKeyInfo structure of RFC 5208
+type pkcs8 struct {
+	Version    int
+	Algo       pkix.AlgorithmIdentifier
+	PrivateKey []byte
+}
+
+// subjectPublicKeyInfo mirrors the structure of RFC 5280
+type subjectPublicKeyInfo struct {
+	Algorithm pkix.AlgorithmIdentifier
+	PublicKey asn1.BitString
+}
+
+type MLKEMPublicKey struct {
+	pq *mlkem.EncapsulationKey768
+	t  *ecdh.PublicKey
+}
+
+func (kp *MLKEMPublicKey) Encode(dst io.Writer) error {
+	der, err := asn1.Marshal(subjectPublicKeyInfo{
+		Algorithm: pkix.AlgorithmIdentifier{Algorithm: oidXWing},
+		PublicKey: asn1.BitString{Bytes: kp.Bytes(), BitLength: 8 * xwingPublicKeySize},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal public key: %w", err)
+	}
+
+	if err := pem.Encode(dst, &pem.Block{Type: "PUBLIC KEY", Bytes: der}); err != nil {
+		return fmt.Errorf("failed to write public key: %w", err)
+	}
+
+	return nil
+}
+
+// Encrypt encapsulates a shared secret to both keys and wraps the data key with it:
+// [ML-KEM-768 ciphertext][X25519 ephemeral public key][AES-256-GCM sealed key]
+func (kp *MLKEMPublicKey) Encrypt(plaintext []byte, key []byte) ([]byte, error) {
+	ssPQ, ctPQ := kp.pq.Encapsulate()
+	defer clear(ssPQ)
+
+	ephemeral, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate ephemeral key: %w", err)
+	}
+
+	ssT, err := ephemeral.ECDH(kp.t)
+	if err != nil {
+		return nil, fmt.Errorf("failed to perform ECDH: %w", err)
+	}
+	defer clear(ssT)
+
+	ctT := ephemeral.PublicKey().Bytes()
+	aesgcm, err := xwingWrapCipher(xwingCombiner(ssPQ, ssT, ctT, kp.t.Bytes()))
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]byte, 0, xwingCiphertextSize+len(key)+aesgcm.Overhead())
+	out = append(out, ctPQ...)
+	out = append(out, ctT...)
+
+	// the wrapping key is never reused, a zero nonce is safe
+	return aesgcm.Seal(out, make([]byte, aesgcm.NonceSize()), key, nil), nil
+}
+
+func (kp *MLKEMPublicKey) Algorithm() WrapAlgorithm {
+	return WrapMLKEM768X25519
+}
+
+func (kp *MLKEMPublicKey) Bytes() []byte {
+	return append(kp.pq.Bytes(), kp.t.Bytes()...)
+}
+
+type MLKEMIdKey struct {
+	seed []byte
+	pq   *mlkem.DecapsulationKey768
+	t    *ecdh.PrivateKey
+}
+
+func (k *MLKEMIdKey) PublicKey() PublicKey {
+	return &MLKEMPublicKey{
+		pq: k.pq.EncapsulationKey(),
+		t:  k.t.PublicKey(),
+	}
+}
+
+func (k *MLKEMIdKey) Encode(dst io.Writer) error {
+	seed, err := asn1.Marshal(k.seed)
+	if err != nil {
+		return fmt.Errorf("failed to marshal private key: %w", err)
+	}
+
+	der, err := asn1.Marshal(pkcs8{
+		Algo:       pkix.AlgorithmIdentifier{Algorithm: oidXWing},
+		PrivateKey: seed,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal private key: %w", err)
+	}
+
+	return pem.Encode(dst, &pem.Block{
+		Type:  "PRIVATE KEY",
+		Bytes: der,
+	})
+}
+
+func (k *MLKEMIdKey) Decrypt(alg WrapAlgorithm, ciphertext []byte) ([]byte, error) {
+	if alg != WrapMLKEM768X25519 {
+		return nil, fmt.Errorf("unsupported wrap algorithm for ML-KEM key: %s", alg)
+	}
+
+	if len(ciphertext) < xwingCiphertextSize {
+		return nil, fmt.Errorf("invalid ciphertext format: too short")
+	}
+
+	ctPQ := ciphertext[:mlkem.CiphertextSize768]
+	ctT := ciphertext[mlkem.CiphertextSize768:xwingCiphertextSize]
+
+	ssPQ, err := k.pq.Decapsulate(ctPQ)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decapsulate: %w", err)
+	}
+	defer clear(ssPQ)
+
+	ephemeral, err := ecdh.X25519().NewPublicKey(ctT)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse ephemeral public key: %w", err)
+	}
+
+	ssT, err := k.t.ECDH(ephemeral)
+	if err != nil {
+		return nil, fmt.Errorf("failed to perform ECDH: %w", err)
+	}
+	defer clear(ssT)
+
+	aesgcm, err := xwingWrapCipher(xwingCombiner(ssPQ, ssT, ctT, k.t.PublicKey().Bytes()))
+	if err != nil {
+		return nil, err
+	}
+
+	plaintext, err := aesgcm.Open(nil, make([]byte, aesgcm.NonceSize()), ciphertext[xwingCiphertextSize:], nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt key: %w", err)
+	}
+
+	return plaintext, nil
+}
+
+// xwingCombiner derives the X-Wing shared secret
+func xwingCombiner(ssPQ, ssT, ctT, pkT []byte) []byte {
+	h := sha3.New256()
+	h.Write(ssPQ)
+	h.Write(ssT)
+	h.Write(ctT)
+	h.Write(pkT)
+	h.Write([]byte(xwingLabel))
+	return h.Sum(nil)
+}
+
+// xwingWrapCipher returns the AEAD wrapping the data key under the shared secret
+func xwingWrapCipher(sharedSecret []byte) (cipher.AEAD, error) {
+	defer clear(sharedSecret)
+
+	wrapKey, err := hkdf.Key(sha256.New, sharedSecret, nil, xwingWrapInfo, 32)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive wrapping key: %w", err)
+	}
+	defer clear(wrapKey)
+
+	return newGCM(wrapKey)
+}
+
+// newMLKEMIdKey expands the X-Wing seed into both key pairs
+func newMLKEMIdKey(seed []byte) (*MLKEMIdKey, error) {
+	if len(seed) != xwingSeedSize {
+		return nil, fmt.Errorf("invalid ML-KEM-768+X25519 private key size: %d", len(seed))
+	}
+
+	s := sha3.NewSHAKE256()
+	s.Write(seed)
+	expanded := make([]byte, mlkem.SeedSize+32)
+	s.Read(expanded)
+	defer clear(expanded)
+
+	pq, err := mlkem.NewDecapsulationKey768(expanded[:mlkem.SeedSize])
+	if err != nil {
+		return nil, fmt.Errorf("failed to create ML-KEM-768 key: %w", err)
+	}
+
+	t, err := ecdh.X25519().NewPrivateKey(expanded[mlkem.SeedSize:])
+	if err != nil {
+		return nil, fmt.Errorf("failed to create X25519 key: %w", err)
+	}
+
+	return &MLKEMIdKey{seed: append([]byte(nil), seed...), pq: pq, t: t}, nil
+}
+
+func generateMLKEMIdKey() (*MLKEMIdKey, error) {
+	seed := make([]byte, xwingSeedSize)
+	if _, err := io.ReadFull(rand.Reader, seed); err != nil {
+		return nil, err
+	}
+	defer clear(seed)
+
+	return newMLKEMIdKey(seed)
+}
+
+// parseMLKEMPrivateKey parses a PKCS#8 X-Wing private key
+func parseMLKEMPrivateKey(der []byte) (*MLKEMIdKey, error) {
+	var info pkcs8
+	if rest, err := asn1.Unmarshal(der, &info); err != nil || len(rest) != 0 {
+		return nil, fmt.Errorf("invalid PKCS#8 structure")
+	}
+	if !info.Algo.Algorithm.Equal(oidXWing) {
+		return nil, fmt.Errorf("not an ML-KEM-768+X25519 key")
+	}
+
+	var seed []byte
+	if rest, err := asn1.Unmarshal(info.PrivateKey, &seed); err != nil || len(rest) != 0 {
+		return nil, fmt.Errorf("invalid ML-KEM-768+X25519 private key")
+	}
+	defer clear(seed)
+
+	return newMLKEMIdKey(seed)
+}
+
+// parseMLKEMPublicKey parses an SPKI X-Wing public key
+func parseMLKEMPublicKey(der []byte) (*MLKEMPublicKey, error) {
+	var spki subjectPublicKeyInfo
+	if rest, err := asn1.Unmarshal(der, &spki); err != nil || len(rest) != 0 {
+		return nil, fmt.Errorf("invalid SPKI structure")
+	}
+	if !spki.Algorithm.Algorithm.Equal(oidXWing) {
+		return nil, fmt.Errorf("not an ML-KEM-768+X25519 key")
+	}
+
+	raw := spki.PublicKey.RightAlign()
+	if len(raw) != xwingPublicKeySize {
+		return nil, fmt.Errorf("invalid ML-KEM-768+X25519 public key size: %d", len(raw))
+	}
+
+	pq, err := mlkem.NewEncapsulationKey768(raw[:mlkem.EncapsulationKeySize768])
+	if err != nil {
+		return nil, fmt.Errorf("invalid ML-KEM-768 public key: %w", err)
+	}
+
+	t, err := ecdh.X25519().NewPublicKey(raw[mlkem.EncapsulationKeySize768:])
+	if err != nil {
+		return nil, fmt.Errorf("invalid X25519 public key: %w", err)
+	}
+
+	return &MLKEMPublicKey{pq: pq, t: t}, nil
+}
@@ -3,6 +3,7 @@ package id
 import (
 	"crypto/rand"
 	"crypto/rsa"
+	"crypto/sha256"
 	"crypto/x509"
 	"encoding/pem"
 	"io"
@@ -28,8 +29,13 @@ func (kp *RSAPublicKey) Encode(dst io.Writer) error {
 	return nil
 }
 
+// Encrypt wraps the key with RSA-OAEP (SHA-256), PKCS#1 v1.5 is only kept for decryption
 func (kp *RSAPublicKey) Encrypt(plaintext []byte, key []byte) ([]byte, error) {
-	return rsa.EncryptPKCS1v15(rand.Reader, kp.pub, key)
+	return rsa.EncryptOAEP(sha256.New(), rand.Reader, kp.pub, key, nil)
+}
+
+func (kp *RSAPublicKey) Algorithm() WrapAlgorithm {
+	return WrapRSAOAEPSHA256
 }
 
 func (kp *RSAPublicKey) Bytes() []byte {
@@ -56,8 +62,33 @@ func (k *RSAIdKey) Encode(dst io.Writer) error {
 	return pem.Encode(dst, pemBlock)
 }
 
-func (k *RSAIdKey) Decrypt(ciphertext []byte) ([]byte, error) {
-	return rsa.DecryptPKCS1v15(rand.Reader, k.pk, ciphertext)
+func (k *RSAIdKey) Decrypt(alg WrapAlgorithm, ciphertext []byte) ([]byte, error) {
+	switch alg {
+	case WrapRSAOAEPSHA256:
+		return rsa.DecryptOAEP(sha256.New(), nil, k.pk, ciphertext, nil)
+	case WrapLegacy, WrapRSAPKCS1v15:
+		// the wrap algorithm comes from the envelope, honouring it here would
+		// expose a padding oracle to whoever can submit one
+		return nil, errors.New("data key wrapped with RSA PKCS#1 v1.5, run 'secm migrate' to upgrade the secret")
+	default:
+		return nil, errors.New("unsupported wrap algorithm for RSA key: %s", alg)
+	}
+}
+
+// DecryptLegacy unwraps a data key of keySize bytes wrapped with PKCS#1 v1.5.
+// A padding error yields a random key instead of an error, in constant time,
+// the caller detects it when the payload fails to authenticate.
+func (k *RSAIdKey) DecryptLegacy(ciphertext []byte, keySize int) ([]byte, error) {
+	key := make([]byte, keySize)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return nil, errors.Wrapf(err, "failed to generate key")
+	}
+
+	if err := rsa.DecryptPKCS1v15SessionKey(nil, k.pk, ciphertext, key); err != nil {
+		return nil, errors.Wrapf(err, "failed to decrypt data key")
+	}
+
+	return key, nil
 }
 
 func createRSAIdKey(pk *rsa.PrivateKey) *RSAIdKey {
@@ -1,15 +1,80 @@
 package id
 
 import (
+	"crypto/ecdh"
+	"crypto/sha256"
 	"io"
 )
 
+// WrapAlgorithm identifies the scheme used to wrap (encrypt) a data key
+// for a recipient. It is recorded next to the ciphertext so that the
+// matching identity knows how to unwrap it.
+type WrapAlgorithm uint8
+
+const (
+	// WrapLegacy is used for data keys wrapped before the algorithm was
+	// recorded; the identity falls back to the scheme it historically used
+	WrapLegacy WrapAlgorithm = 0x00
+	// WrapRSAPKCS1v15 is RSA encryption with PKCS#1 v1.5 padding
+	WrapRSAPKCS1v15 WrapAlgorithm = 0x01
+	// WrapECDHAESGCM is ephemeral ECDH with the shared secret truncated
+	// into an AES-GCM key
+	WrapECDHAESGCM WrapAlgorithm = 0x02
+	// WrapRSAOAEPSHA256 is RSA-OAEP with SHA-256 as hash and MGF1 hash
+	WrapRSAOAEPSHA256 WrapAlgorithm = 0x03
+	// WrapECIESHKDFSHA256 is ephemeral ECDH with the shared secret derived
+	// through HKDF-SHA256, bound to both public keys, into an AES-256-GCM key
+	WrapECIESHKDFSHA256 WrapAlgorithm = 0x04
+	// WrapMLKEM768X25519 is the X-Wing hybrid KEM (ML-KEM-768 and X25519),
+	// the shared secret derived through HKDF-SHA256 into an AES-256-GCM key
+	WrapMLKEM768X25519 WrapAlgorithm = 0x05
+	// WrapScrypt wraps the data key with AES-256-GCM under a key derived
+	// from a passphrase with scrypt, the stanza records the KDF parameters
+	WrapScrypt WrapAlgorithm = 0x06
+	// WrapProvider is a data key wrapped by an external key provider, in a
+	// format only known to it
+	WrapProvider WrapAlgorithm = 0x07
+)
+
+func (a WrapAlgorithm) String() string {
+	switch a {
+	case WrapLegacy:
+		return "legacy"
+	case WrapRSAPKCS1v15:
+		return "rsa-pkcs1v15"
+	case WrapECDHAESGCM:
+		return "ecdh-aes-gcm"
+	case WrapRSAOAEPSHA256:
+		return "rsa-oaep-sha256"
+	case WrapECIESHKDFSHA256:
+		return "ecies-hkdf-sha256"
+	case WrapMLKEM768X25519:
+		return "mlkem768-x25519"
+	case WrapScrypt:
+		return "scrypt"
+	case WrapProvider:
+		return "provider"
+	default:
+		return "unknown"
+	}
+}
+
 type Encrypter interface {
 	Encrypt(plaintext []byte, key []byte) ([]byte, error)
+	// Algorithm returns the wrap algorithm used by Encrypt
+	Algorithm() WrapAlgorithm
 }
 
 type Decrypter interface {
-	Decrypt(ciphertext []byte) ([]byte, error)
+	// Decrypt unwraps a ciphertext produced with the given wrap algorithm
+	Decrypt(alg WrapAlgorithm, ciphertext []byte) ([]byte, error)
+}
+
+// LegacyDecrypter unwraps data keys of secrets written before the wrap
+// algorithm was recorded, with a scheme no longer accepted by Decrypt. It is
+// only meant for `secm migrate`.
+type LegacyDecrypter interface {
+	DecryptLegacy(ciphertext []byte, keySize int) ([]byte, error)
 }
 
 type EncodableKey interface {
@@ -27,3 +92,27 @@ type KeyPackageIdentity interface {
 	Decrypter
 	PublicKey() PublicKey
 }
+
+// CurveKey is implemented by elliptic curve public keys and identities
+type CurveKey interface {
+	Curve() ecdh.Curve
+}
+
+// KeyAgreement is implemented by elliptic curve identities, it exposes the raw
+// Diffie-Hellman operation needed to interoperate with other formats
+type KeyAgreement interface {
+	CurveKey
+	ECDH(remote *ecdh.PublicKey) ([]byte, error)
+}
+
+// KeyHintSize is the size of the hint identifying the recipient of a wrapped key
+const KeyHintSize = 8
+
+// KeyHint returns a short identifier of the public key, used to find
+// the recipient stanza of an envelope without trial decryption
+func KeyHint(pub PublicKey) [KeyHintSize]byte {
+	var hint [KeyHintSize]byte
+	sum := sha256.Sum256(pub.Bytes())
+	copy(hint[:], sum[:KeyHintSize])
+	return hint
+}
@@ -0,0 +1,160 @@
+package id
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"testing"
+)
+
+var keyTypes = []string{"rsa", "ec25519", "ed25519", "p256", "p384", "p521", "mlkem768-x25519"}
+
+func encodeKey(t *testing.T, key EncodableKey) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := key.Encode(&buf); err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func fingerprint(t *testing.T, pub PublicKey) Fingerprint {
+	t.Helper()
+	f, err := PublicKeyFingerprint(pub)
+	if err != nil {
+		t.Fatalf("PublicKeyFingerprint: %v", err)
+	}
+	return f
+}
+
+// checkUnwrap wraps a random key to pub and unwraps it with identity
+func checkUnwrap(t *testing.T, pub PublicKey, identity Decrypter) {
+	t.Helper()
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatal(err)
+	}
+
+	wrapped, err := pub.Encrypt(nil, key)
+	if err != nil {
+		t.Fatalf("Encrypt: %v", err)
+	}
+	got, err := identity.Decrypt(pub.Algorithm(), wrapped)
+	if err != nil {
+		t.Fatalf("Decrypt: %v", err)
+	}
+	if !bytes.Equal(got, key) {
+		t.Fatal("unwrapped key mismatch")
+	}
+}
+
+func TestKeyRoundTrip(t *testing.T) {
+	for _, keyType := range keyTypes {
+		t.Run(keyType, func(t *testing.T) {
+			identity, err := GenerateKey(GenerateKeyOpts{Type: keyType})
+			if err != nil {
+				t.Fatalf("GenerateKey: %v", err)
+			}
+			want := fingerprint(t, identity.PublicKey())
+
+			// the public key as shared with others
+			pub, err := ParsePublicKey(encodeKey(t, identity.PublicKey()))
+			if err != nil {
+				t.Fatalf("ParsePublicKey: %v", err)
+			}
+			if got := fingerprint(t, pub); got != want {
+				t.Fatalf("parsed public key fingerprint %s, want %s", got, want)
+			}
+			checkUnwrap(t, pub, identity)
+
+			// the identity as stored on disk
+			loaded, err := ParseKey(encodeKey(t, identity))
+			if err != nil {
+				t.Fatalf("ParseKey: %v", err)
+			}
+			if got := fingerprint(t, loaded.PublicKey()); got != want {
+				t.Fatalf("parsed identity fingerprint %s, want %s", got, want)
+			}
+			checkUnwrap(t, identity.PublicKey(), loaded)
+			checkUnwrap(t, pub, loaded)
+		})
+	}
+}
+
+func TestKeyRoundTripPassphrase(t *testing.T) {
+	identity, err := GenerateKey(GenerateKeyOpts{Type: "ec25519"})
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := EncodeKey(&buf, identity, []byte("passphrase")); err != nil {
+		t.Fatalf("EncodeKey: %v", err)
+	}
+
+	if _, err := ParseKey(buf.Bytes()); err != ErrPassphraseRequired {
+		t.Fatalf("ParseKey without passphrase: got %v, want ErrPassphraseRequired", err)
+	}
+	if _, err := ParseKeyWithPassphrase(buf.Bytes(), []byte("wrong")); err == nil {
+		t.Fatal("ParseKeyWithPassphrase succeeded with a wrong passphrase")
+	}
+
+	loaded, err := ParseKeyWithPassphrase(buf.Bytes(), []byte("passphrase"))
+	if err != nil {
+		t.Fatalf("ParseKeyWithPassphrase: %v", err)
+	}
+	checkUnwrap(t, identity.PublicKey(), loaded)
+}
+
+func TestRawPublicKeyRefused(t *testing.T) {
+	for _, keyType := range []string{"ec25519", "ed25519", "p256", "p384", "p521"} {
+		identity, err := GenerateKey(GenerateKeyOpts{Type: keyType})
+		if err != nil {
+			t.Fatalf("GenerateKey: %v", err)
+		}
+
+		// the raw point of an Ed25519 key would read as an unrelated X25519 key,
+		// only encoded keys say which curve they are on
+		if _, err := ParsePublicKey(identity.PublicKey().Bytes()); err == nil {
+			t.Errorf("%s: ParsePublicKey accepted raw key bytes", keyType)
+		}
+	}
+}
+
+func TestRSALegacyWrap(t *testing.T) {
+	identity, err := GenerateKey(GenerateKeyOpts{Type: "rsa"})
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	rsaKey := identity.(*RSAIdKey)
+	key := bytes.Repeat([]byte{0x42}, 32)
+
+	wrapped, err := rsa.EncryptPKCS1v15(rand.Reader, &rsaKey.pk.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the wrap algorithm of an envelope never selects PKCS#1 v1.5
+	for _, alg := range []WrapAlgorithm{WrapLegacy, WrapRSAPKCS1v15} {
+		if _, err := identity.Decrypt(alg, wrapped); err == nil {
+			t.Fatalf("Decrypt(%s) unwrapped a PKCS#1 v1.5 key", alg)
+		}
+	}
+
+	got, err := rsaKey.DecryptLegacy(wrapped, len(key))
+	if err != nil {
+		t.Fatalf("DecryptLegacy: %v", err)
+	}
+	if !bytes.Equal(got, key) {
+		t.Fatal("unwrapped key mismatch")
+	}
+
+	// a padding error is not reported, a random key is returned instead
+	wrapped[len(wrapped)-1] ^= 0x01
+	got, err = rsaKey.DecryptLegacy(wrapped, len(key))
+	if err != nil {
+		t.Fatalf("DecryptLegacy of a corrupted key: %v", err)
+	}
+	if len(got) != len(key) || bytes.Equal(got, key) {
+		t.Fatal("DecryptLegacy of a corrupted key returned the original key")
+	}
+}
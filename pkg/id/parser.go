@@ -12,6 +12,8 @@ import (
 	"errors"
 	"fmt"
 	"os"
+
+	"golang.org/x/crypto/ssh"
 )
 
 // LoadPrivateKey loads the private key from the provided file path
@@ -20,12 +22,27 @@ func LoadPrivateKey(keyPath string) (crypto.PrivateKey, string, error) {
 	if err != nil {
 		return nil, "", fmt.Errorf("failed to read key file: %w", err)
 	}
+	defer clear(keyData)
 
 	block, _ := pem.Decode(keyData)
 	if block == nil {
 		return nil, "", fmt.Errorf("failed to decode PEM block")
 	}
 
+	if block.Type == EncryptedKeyType {
+		passphrase, err := passphraseReader(keyPath)
+		if err != nil {
+			return nil, "", err
+		}
+
+		block, err = DecryptPEMBlock(block, passphrase)
+		if err != nil {
+			return nil, "", err
+		}
+	}
+	// the parsed key holds copies, the DER is wiped once done
+	defer clear(block.Bytes)
+
 	pk, format, err := parsePrivateKeyBytes(block.Bytes)
 	if err != nil {
 		return nil, "", fmt.Errorf("failed to parse private key: %w", err)
@@ -36,15 +53,78 @@ func LoadPrivateKey(keyPath string) (crypto.PrivateKey, string, error) {
 
 // LoadKeyFile loads the identity key from the provided file path
 func LoadKeyFile(keyPath string) (KeyPackageIdentity, error) {
-	var identity KeyPackageIdentity
+	// no key material to decrypt, the file only references the provider
+	if data, err := os.ReadFile(keyPath); err == nil && IsProviderKey(data) {
+		return ParseKey(data)
+	}
+
 	pk, format, err := LoadPrivateKey(keyPath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to load private key: %w", err)
 	}
 
+	return identityFromPrivateKey(pk, format)
+}
+
+// ParseKey parses an identity key from its unencrypted PEM encoding
+func ParseKey(data []byte) (KeyPackageIdentity, error) {
+	return ParseKeyWithPassphrase(data, nil)
+}
+
+// ParseKeyWithPassphrase parses an identity key from its PEM encoding, a protected
+// key is decrypted with the passphrase
+func ParseKeyWithPassphrase(data []byte, passphrase []byte) (KeyPackageIdentity, error) {
+	block, rest := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("failed to decode PEM block")
+	}
+
+	if block.Type == ProviderKeyType {
+		identity, err := parseProviderKey(block, rest)
+		if err != nil {
+			return nil, err
+		}
+		return identity, nil
+	}
+
+	if block.Type == EncryptedKeyType {
+		if len(passphrase) == 0 {
+			return nil, ErrPassphraseRequired
+		}
+
+		decrypted, err := DecryptPEMBlock(block, passphrase)
+		if err != nil {
+			return nil, err
+		}
+		defer clear(decrypted.Bytes)
+		block = decrypted
+	}
+
+	pk, format, err := parsePrivateKeyBytes(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse private key: %w", err)
+	}
+
+	return identityFromPrivateKey(pk, format)
+}
+
+// identityFromPrivateKey wraps the parsed private key into an identity
+func identityFromPrivateKey(pk crypto.PrivateKey, format string) (KeyPackageIdentity, error) {
+	if mlkemPk, ok := pk.(*MLKEMIdKey); ok {
+		return mlkemPk, nil
+	}
+
+	var identity KeyPackageIdentity
 	if format == "PKCS1" {
 		identity = createRSAIdKey(pk.(*rsa.PrivateKey))
-	} else if format == "PKCS8" {
+	} else if format == "PKCS8" || format == "SEC1" {
+		if edPk, ok := pk.(ed25519.PrivateKey); ok {
+			edIdentity, err := createEd25519IdKey(edPk)
+			if err != nil {
+				return nil, err
+			}
+			return edIdentity, nil
+		}
 		if dhPk, ok := pk.(*ecdh.PrivateKey); ok {
 			identity = createECDHIdKey(dhPk)
 		} else {
@@ -66,7 +146,7 @@ func LoadKeyFile(keyPath string) (KeyPackageIdentity, error) {
 	return identity, nil
 }
 
-// ParsePrivateKeyBytes attempts to parse a private key in either PKCS1 or PKCS8 format
+// ParsePrivateKeyBytes attempts to parse a private key in PKCS1, PKCS8 or SEC1 format
 func parsePrivateKeyBytes(der []byte) (crypto.PrivateKey, string, error) {
 	// Try PKCS1 first
 	if key, err := x509.ParsePKCS1PrivateKey(der); err == nil {
@@ -78,41 +158,43 @@ func parsePrivateKeyBytes(der []byte) (crypto.PrivateKey, string, error) {
 		return key, "PKCS8", nil
 	}
 
-	return nil, "", fmt.Errorf("failed to parse private key in either PKCS1 or PKCS8 format")
+	// EC PRIVATE KEY, as written by openssl ecparam -genkey
+	if key, err := x509.ParseECPrivateKey(der); err == nil {
+		return key, "SEC1", nil
+	}
+
+	// PKCS8 with an algorithm unknown to crypto/x509
+	if key, err := parseMLKEMPrivateKey(der); err == nil {
+		return key, "PKCS8", nil
+	}
+
+	return nil, "", fmt.Errorf("failed to parse private key in PKCS1, PKCS8 or SEC1 format")
 }
 
 func ParsePublicKey(data []byte) (PublicKey, error) {
+	// OpenSSH authorized_keys line, e.g. ssh-ed25519 AAAA... comment
+	if sshKey, _, _, _, err := ssh.ParseAuthorizedKey(data); err == nil {
+		return parseSSHPublicKey(sshKey)
+	}
+
 	// First, try to parse as DER/PEM encoded data
 	block, _ := pem.Decode(data)
 	if block != nil {
+		if block.Type == ProviderRecipientType {
+			return parseProviderRecipient(block)
+		}
 		data = block.Bytes
 	}
 
+	// PKIX with an algorithm unknown to crypto/x509
+	if mlkemKey, err := parseMLKEMPublicKey(data); err == nil {
+		return mlkemKey, nil
+	}
+
 	// Try PKIX format first (standard format)
 	pubKey, err := x509.ParsePKIXPublicKey(data)
 	if err == nil {
-		switch key := pubKey.(type) {
-		case *rsa.PublicKey:
-			return &RSAPublicKey{key}, nil
-		case *ecdh.PublicKey:
-			return &ECPublicKey{key}, nil
-		case *ecdsa.PublicKey:
-			ecKey, err := convertECDSAPublicKeyToECDH(key)
-			if err != nil {
-				return nil, fmt.Errorf("failed to convert ECDSA public key to ECDH: %w", err)
-			}
-			return &ECPublicKey{pub: ecKey}, nil
-		case ed25519.PublicKey:
-			edKey, err := ecdh.X25519().NewPublicKey(key)
-			if err != nil {
-				return nil, fmt.Errorf("failed to create X25519 public")
-			}
-			return &ECPublicKey{
-				pub: edKey,
-			}, nil
-		default:
-			return nil, fmt.Errorf("unknown public key type %T", key)
-		}
+		return publicKeyFromCrypto(pubKey)
 	}
 
 	// If PKIX fails, try PKCS1 format for RSA keys
@@ -120,22 +202,39 @@ func ParsePublicKey(data []byte) (PublicKey, error) {
 		return &RSAPublicKey{rsaKey}, nil
 	}
 
-	// If both DER formats fail, try to parse as raw key bytes
-	// Try different ECDH curves for raw bytes
-	curves := []ecdh.Curve{
-		ecdh.X25519(),
-		ecdh.P256(),
-		ecdh.P384(),
-		ecdh.P521(),
-	}
+	// raw key bytes are refused, the curve they belong to cannot be told: the
+	// point of an Ed25519 key reads as an unrelated X25519 key
+	return nil, fmt.Errorf("failed to parse public key: unable to parse as PEM, DER or OpenSSH encoded key")
+}
 
-	for _, curve := range curves {
-		if pubKey, err := curve.NewPublicKey(data); err == nil {
-			return &ECPublicKey{pub: pubKey}, nil
+// publicKeyFromCrypto wraps a parsed public key into a recipient
+func publicKeyFromCrypto(pubKey crypto.PublicKey) (PublicKey, error) {
+	switch key := pubKey.(type) {
+	case *rsa.PublicKey:
+		return &RSAPublicKey{key}, nil
+	case *ecdh.PublicKey:
+		return &ECPublicKey{key}, nil
+	case *ecdsa.PublicKey:
+		ecKey, err := convertECDSAPublicKeyToECDH(key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to convert ECDSA public key to ECDH: %w", err)
 		}
+		return &ECPublicKey{pub: ecKey}, nil
+	case ed25519.PublicKey:
+		return newEd25519PublicKey(key)
+	default:
+		return nil, fmt.Errorf("unknown public key type %T", key)
+	}
+}
+
+// LoadPublicKeyFile loads a public key from the provided file path
+func LoadPublicKeyFile(keyPath string) (PublicKey, error) {
+	data, err := os.ReadFile(keyPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read public key file: %w", err)
 	}
 
-	return nil, fmt.Errorf("failed to parse public key: unable to parse as DER-encoded or raw key bytes")
+	return ParsePublicKey(data)
 }
 
 func convertECDSAPublicKeyToECDH(ecdsaPub *ecdsa.PublicKey) (*ecdh.PublicKey, error) {
@@ -0,0 +1,217 @@
+package id
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// EncryptedKeyType is the PEM block type of keys protected with a passphrase.
+// The block headers record the KDF and its parameters, the block bytes are the
+// DER of the original key sealed with AES-256-GCM under the derived key.
+const EncryptedKeyType = "SECM ENCRYPTED PRIVATE KEY"
+
+const (
+	kdfScrypt    = "scrypt"
+	keyCipherGCM = "aes-256-gcm"
+
+	// scrypt parameters of new keys, N=2^15 r=8 p=1 takes ~100ms
+	scryptLogN = 15
+	scryptR    = 8
+	scryptP    = 1
+
+	// maxScryptLogN bounds the work requested by a key file or an envelope, no
+	// file written by secm asks for more
+	maxScryptLogN = secretScryptLogN
+)
+
+var (
+	// ErrPassphraseRequired is returned when a key is protected and no passphrase is available
+	ErrPassphraseRequired = errors.New("passphrase required")
+	// ErrIncorrectPassphrase is returned when the passphrase does not open the key
+	ErrIncorrectPassphrase = errors.New("incorrect passphrase")
+)
+
+// PassphraseReader returns the passphrase protecting the key stored at keyPath
+type PassphraseReader func(keyPath string) ([]byte, error)
+
+var passphraseReader PassphraseReader = func(string) ([]byte, error) {
+	return nil, ErrPassphraseRequired
+}
+
+// SetPassphraseReader sets how the passphrase of protected keys is obtained
+func SetPassphraseReader(r PassphraseReader) {
+	passphraseReader = r
+}
+
+// EncodeKey writes the PEM encoding of the key to dst, encrypted with the
+// passphrase unless it is empty
+func EncodeKey(dst io.Writer, key EncodableKey, passphrase []byte) error {
+	if len(passphrase) == 0 {
+		return key.Encode(dst)
+	}
+
+	if _, ok := key.(*ProviderIdKey); ok {
+		return fmt.Errorf("keys held by a key provider cannot be protected with a passphrase")
+	}
+
+	var buf bytes.Buffer
+	if err := key.Encode(&buf); err != nil {
+		return err
+	}
+
+	block, _ := pem.Decode(buf.Bytes())
+	if block == nil {
+		return fmt.Errorf("failed to decode PEM block")
+	}
+
+	encrypted, err := EncryptPEMBlock(block, passphrase)
+	if err != nil {
+		return err
+	}
+
+	return pem.Encode(dst, encrypted)
+}
+
+// EncryptPEMBlock protects the block with a key derived from the passphrase
+func EncryptPEMBlock(block *pem.Block, passphrase []byte) (*pem.Block, error) {
+	salt := make([]byte, 16)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return nil, fmt.Errorf("failed to generate salt: %w", err)
+	}
+
+	params := fmt.Sprintf("N=%d,r=%d,p=%d", 1<<scryptLogN, scryptR, scryptP)
+	aead, err := passphraseAEAD(passphrase, salt, params)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	return &pem.Block{
+		Type: EncryptedKeyType,
+		Headers: map[string]string{
+			"Key-Type":   block.Type,
+			"KDF":        kdfScrypt,
+			"KDF-Params": params,
+			"Salt":       base64.StdEncoding.EncodeToString(salt),
+			"Cipher":     keyCipherGCM,
+			"Nonce":      base64.StdEncoding.EncodeToString(nonce),
+		},
+		// the original block type is authenticated along with the key
+		Bytes: aead.Seal(nil, nonce, block.Bytes, []byte(block.Type)),
+	}, nil
+}
+
+// DecryptPEMBlock opens a block produced by EncryptPEMBlock
+func DecryptPEMBlock(block *pem.Block, passphrase []byte) (*pem.Block, error) {
+	if block.Type != EncryptedKeyType {
+		return nil, fmt.Errorf("unexpected PEM block type: %s", block.Type)
+	}
+	if kdf := block.Headers["KDF"]; kdf != kdfScrypt {
+		return nil, fmt.Errorf("unsupported key derivation function: %s", kdf)
+	}
+	if c := block.Headers["Cipher"]; c != keyCipherGCM {
+		return nil, fmt.Errorf("unsupported key cipher: %s", c)
+	}
+
+	salt, err := base64.StdEncoding.DecodeString(block.Headers["Salt"])
+	if err != nil {
+		return nil, fmt.Errorf("invalid salt: %w", err)
+	}
+	nonce, err := base64.StdEncoding.DecodeString(block.Headers["Nonce"])
+	if err != nil {
+		return nil, fmt.Errorf("invalid nonce: %w", err)
+	}
+
+	aead, err := passphraseAEAD(passphrase, salt, block.Headers["KDF-Params"])
+	if err != nil {
+		return nil, err
+	}
+	if len(nonce) != aead.NonceSize() {
+		return nil, fmt.Errorf("invalid nonce size: %d", len(nonce))
+	}
+
+	keyType := block.Headers["Key-Type"]
+	der, err := aead.Open(nil, nonce, block.Bytes, []byte(keyType))
+	if err != nil {
+		return nil, ErrIncorrectPassphrase
+	}
+
+	return &pem.Block{Type: keyType, Bytes: der}, nil
+}
+
+// IsEncryptedKey reports whether the PEM data holds a passphrase protected key
+func IsEncryptedKey(data []byte) bool {
+	block, _ := pem.Decode(data)
+	return block != nil && block.Type == EncryptedKeyType
+}
+
+// passphraseAEAD derives the key encryption key from the passphrase
+func passphraseAEAD(passphrase, salt []byte, params string) (cipher.AEAD, error) {
+	if len(passphrase) == 0 {
+		return nil, ErrPassphraseRequired
+	}
+
+	n, r, p, err := parseScryptParams(params)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := scrypt.Key(passphrase, salt, n, r, p, 32)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive key: %w", err)
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create AES cipher: %w", err)
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// parseScryptParams parses "N=<n>,r=<r>,p=<p>"
+func parseScryptParams(params string) (n, r, p int, err error) {
+	for _, field := range strings.Split(params, ",") {
+		name, value, ok := strings.Cut(field, "=")
+		if !ok {
+			return 0, 0, 0, fmt.Errorf("invalid KDF parameters: %s", params)
+		}
+
+		v, err := strconv.Atoi(value)
+		if err != nil || v <= 0 {
+			return 0, 0, 0, fmt.Errorf("invalid KDF parameters: %s", params)
+		}
+
+		switch name {
+		case "N":
+			n = v
+		case "r":
+			r = v
+		case "p":
+			p = v
+		}
+	}
+
+	// r and p scale the memory and the time of the derivation, only the values
+	// secm writes are accepted
+	if n < 2 || n > 1<<maxScryptLogN || n&(n-1) != 0 || r != scryptR || p != scryptP {
+		return 0, 0, 0, fmt.Errorf("invalid KDF parameters: %s", params)
+	}
+
+	return n, r, p, nil
+}
@@ -0,0 +1,240 @@
+package id
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"regexp"
+)
+
+// Key providers hold identity keys outside of secm: a KMS, a hardware token, a
+// vault. A provider named <name> is an executable secm-keyprovider-<name> found in
+// PATH. It is run once per operation, reads one JSON request on stdin and writes
+// one JSON response on stdout; stderr is left to the provider, e.g. to ask for a PIN
+// on the terminal. Binary fields are base64 encoded strings.
+//
+//	{"version": 1, "op": "recipient", "key": <key>}
+//	  -> {"public_key": "<PEM public key>"} or {"recipient": <recipient>}
+//	{"version": 1, "op": "wrap", "recipient": <recipient>, "data": <data key>}
+//	  -> {"data": <wrapped key>}
+//	{"version": 1, "op": "unwrap", "key": <key>, "algorithm": "<wrap algorithm>", "data": <wrapped key>}
+//	  -> {"data": <data key>}
+//
+// Any failure is reported as {"error": "<message>"}. The key is the opaque reference
+// stored in the identity file, e.g. a KMS key ID. A provider either exposes a regular
+// public key, data keys are then wrapped by secm and only unwrapped by the provider,
+// or an opaque recipient for which it also wraps the data keys (algorithm "provider").
+
+const (
+	// ProviderKeyType is the PEM block type of identity files referencing a key
+	// provider, the Provider header names it and the block bytes are the key. The
+	// public key of the identity follows in its own block.
+	ProviderKeyType = "SECM PROVIDER KEY"
+	// ProviderRecipientType is the PEM block type of opaque provider recipients
+	ProviderRecipientType = "SECM PROVIDER RECIPIENT"
+	// ProviderCommandPrefix is prepended to the provider name to find its executable
+	ProviderCommandPrefix = "secm-keyprovider-"
+
+	providerVersion = 1
+)
+
+var providerName = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+type providerRequest struct {
+	Version   int    `json:"version"`
+	Op        string `json:"op"`
+	Key       []byte `json:"key,omitempty"`
+	Recipient []byte `json:"recipient,omitempty"`
+	Algorithm string `json:"algorithm,omitempty"`
+	Data      []byte `json:"data,omitempty"`
+}
+
+type providerResponse struct {
+	Error     string `json:"error,omitempty"`
+	PublicKey string `json:"public_key,omitempty"`
+	Recipient []byte `json:"recipient,omitempty"`
+	Data      []byte `json:"data,omitempty"`
+}
+
+// callProvider runs the provider executable with the request
+func callProvider(name string, req *providerRequest) (*providerResponse, error) {
+	if !providerName.MatchString(name) {
+		return nil, fmt.Errorf("invalid key provider name: %q", name)
+	}
+
+	path, err := exec.LookPath(ProviderCommandPrefix + name)
+	if err != nil {
+		return nil, fmt.Errorf("key provider %s not found: %w", name, err)
+	}
+
+	req.Version = providerVersion
+	input, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode key provider request: %w", err)
+	}
+	defer clear(input)
+
+	var output bytes.Buffer
+	cmd := exec.Command(path)
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Stdout = &output
+	cmd.Stderr = os.Stderr
+	runErr := cmd.Run()
+	defer clear(output.Bytes())
+
+	var resp providerResponse
+	if err := json.Unmarshal(output.Bytes(), &resp); err != nil {
+		if runErr != nil {
+			return nil, fmt.Errorf("key provider %s failed: %w", name, runErr)
+		}
+		return nil, fmt.Errorf("invalid key provider %s response: %w", name, err)
+	}
+	if resp.Error != "" {
+		return nil, fmt.Errorf("key provider %s: %s", name, resp.Error)
+	}
+	if runErr != nil {
+		return nil, fmt.Errorf("key provider %s failed: %w", name, runErr)
+	}
+
+	return &resp, nil
+}
+
+// ProviderPublicKey is an opaque recipient, data keys are wrapped by its provider
+type ProviderPublicKey struct {
+	provider  string
+	recipient []byte
+}
+
+func (kp *ProviderPublicKey) Encode(dst io.Writer) error {
+	pemBlock := &pem.Block{
+		Type:    ProviderRecipientType,
+		Headers: map[string]string{"Provider": kp.provider},
+		Bytes:   kp.recipient,
+	}
+
+	if err := pem.Encode(dst, pemBlock); err != nil {
+		return fmt.Errorf("failed to write public key: %w", err)
+	}
+
+	return nil
+}
+
+// Encrypt asks the provider to wrap the key
+func (kp *ProviderPublicKey) Encrypt(plaintext []byte, key []byte) ([]byte, error) {
+	resp, err := callProvider(kp.provider, &providerRequest{Op: "wrap", Recipient: kp.recipient, Data: key})
+	if err != nil {
+		return nil, err
+	}
+
+	return resp.Data, nil
+}
+
+func (kp *ProviderPublicKey) Algorithm() WrapAlgorithm {
+	return WrapProvider
+}
+
+// Bytes returns the provider name and the recipient
+func (kp *ProviderPublicKey) Bytes() []byte {
+	return append([]byte(kp.provider+"\x00"), kp.recipient...)
+}
+
+// ProviderIdKey is an identity whose key is held by a provider, only a reference
+// to it is stored
+type ProviderIdKey struct {
+	provider string
+	key      []byte
+	pub      PublicKey
+}
+
+// NewProviderIdKey returns the identity of the key referenced by key in the
+// provider, its public key is asked to the provider
+func NewProviderIdKey(provider string, key []byte) (*ProviderIdKey, error) {
+	resp, err := callProvider(provider, &providerRequest{Op: "recipient", Key: key})
+	if err != nil {
+		return nil, err
+	}
+
+	var pub PublicKey
+	switch {
+	case resp.PublicKey != "":
+		pub, err = ParsePublicKey([]byte(resp.PublicKey))
+		if err != nil {
+			return nil, fmt.Errorf("invalid key provider %s public key: %w", provider, err)
+		}
+	case len(resp.Recipient) > 0:
+		pub = &ProviderPublicKey{provider: provider, recipient: resp.Recipient}
+	default:
+		return nil, fmt.Errorf("key provider %s returned no public key", provider)
+	}
+
+	return &ProviderIdKey{provider: provider, key: key, pub: pub}, nil
+}
+
+func (k *ProviderIdKey) PublicKey() PublicKey {
+	return k.pub
+}
+
+// Provider returns the name of the key provider
+func (k *ProviderIdKey) Provider() string {
+	return k.provider
+}
+
+// Encode writes the provider reference followed by the public key
+func (k *ProviderIdKey) Encode(dst io.Writer) error {
+	pemBlock := &pem.Block{
+		Type:    ProviderKeyType,
+		Headers: map[string]string{"Provider": k.provider},
+		Bytes:   k.key,
+	}
+
+	if err := pem.Encode(dst, pemBlock); err != nil {
+		return err
+	}
+
+	return k.pub.Encode(dst)
+}
+
+// Decrypt asks the provider to unwrap the key
+func (k *ProviderIdKey) Decrypt(alg WrapAlgorithm, ciphertext []byte) ([]byte, error) {
+	resp, err := callProvider(k.provider, &providerRequest{Op: "unwrap", Key: k.key, Algorithm: alg.String(), Data: ciphertext})
+	if err != nil {
+		return nil, err
+	}
+
+	return resp.Data, nil
+}
+
+// IsProviderKey reports whether the PEM data references a key provider
+func IsProviderKey(data []byte) bool {
+	block, _ := pem.Decode(data)
+	return block != nil && block.Type == ProviderKeyType
+}
+
+// parseProviderKey parses the provider reference block, rest holds the public key
+func parseProviderKey(block *pem.Block, rest []byte) (*ProviderIdKey, error) {
+	provider := block.Headers["Provider"]
+	if !providerName.MatchString(provider) {
+		return nil, fmt.Errorf("invalid key provider name: %q", provider)
+	}
+
+	pub, err := ParsePublicKey(rest)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse provider public key: %w", err)
+	}
+
+	return &ProviderIdKey{provider: provider, key: block.Bytes, pub: pub}, nil
+}
+
+// parseProviderRecipient parses an opaque provider recipient block
+func parseProviderRecipient(block *pem.Block) (*ProviderPublicKey, error) {
+	provider := block.Headers["Provider"]
+	if !providerName.MatchString(provider) {
+		return nil, fmt.Errorf("invalid key provider name: %q", provider)
+	}
+
+	return &ProviderPublicKey{provider: provider, recipient: block.Bytes}, nil
+}
@@ -0,0 +1,103 @@
+package id
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const testProvider = "test"
+
+// TestMain runs the test binary as a key provider when invoked under its name
+func TestMain(m *testing.M) {
+	if filepath.Base(os.Args[0]) == ProviderCommandPrefix+testProvider {
+		os.Exit(runTestProvider())
+	}
+	os.Exit(m.Run())
+}
+
+// runTestProvider serves one request for an opaque recipient, keys are wrapped
+// by flipping their bits
+func runTestProvider() int {
+	var req providerRequest
+	var resp providerResponse
+	if err := json.NewDecoder(os.Stdin).Decode(&req); err != nil {
+		return 1
+	}
+
+	flip := func(data []byte) []byte {
+		out := make([]byte, len(data))
+		for i, b := range data {
+			out[i] = ^b
+		}
+		return out
+	}
+
+	switch req.Op {
+	case "recipient":
+		resp.Recipient = append([]byte("recipient:"), req.Key...)
+	case "wrap":
+		resp.Data = flip(req.Data)
+	case "unwrap":
+		if req.Algorithm != WrapProvider.String() {
+			resp.Error = "unexpected algorithm " + req.Algorithm
+		}
+		resp.Data = flip(req.Data)
+	default:
+		resp.Error = "unknown op " + req.Op
+	}
+
+	if err := json.NewEncoder(os.Stdout).Encode(&resp); err != nil {
+		return 1
+	}
+	return 0
+}
+
+// installTestProvider makes the test binary the only provider found in PATH
+func installTestProvider(t *testing.T) {
+	t.Helper()
+	self, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	if err := os.Symlink(self, filepath.Join(dir, ProviderCommandPrefix+testProvider)); err != nil {
+		t.Skipf("cannot link the test provider: %v", err)
+	}
+	t.Setenv("PATH", dir)
+}
+
+func TestProviderKeyRoundTrip(t *testing.T) {
+	installTestProvider(t)
+
+	identity, err := NewProviderIdKey(testProvider, []byte("key-1"))
+	if err != nil {
+		t.Fatalf("NewProviderIdKey: %v", err)
+	}
+	checkUnwrap(t, identity.PublicKey(), identity)
+
+	// the opaque recipient as shared with others
+	pub, err := ParsePublicKey(encodeKey(t, identity.PublicKey()))
+	if err != nil {
+		t.Fatalf("ParsePublicKey: %v", err)
+	}
+	if _, ok := pub.(*ProviderPublicKey); !ok {
+		t.Fatalf("ParsePublicKey returned %T, want *ProviderPublicKey", pub)
+	}
+	if fingerprint(t, pub) != fingerprint(t, identity.PublicKey()) {
+		t.Fatal("parsed recipient fingerprint mismatch")
+	}
+	checkUnwrap(t, pub, identity)
+
+	// the identity file only references the key
+	loaded, err := ParseKey(encodeKey(t, identity))
+	if err != nil {
+		t.Fatalf("ParseKey: %v", err)
+	}
+	if _, ok := loaded.(*ProviderIdKey); !ok {
+		t.Fatalf("ParseKey returned %T, want *ProviderIdKey", loaded)
+	}
+	checkUnwrap(t, pub, loaded)
+}
@@ -0,0 +1,110 @@
+package id
+
+import (
+	"crypto/cipher"
+	"crypto/rand"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	// secretScryptLogN is the scrypt work factor of passphrase secrets, N=2^18 takes ~1s,
+	// they are meant to leave the workspace and face offline guessing
+	secretScryptLogN = 18
+
+	scryptSaltSize = 16
+	// scryptParamsSize is the size of the [logN][r][p] prefix of a scrypt stanza
+	scryptParamsSize = 3
+)
+
+// ScryptRecipient wraps data keys under a key derived from a passphrase, the
+// stanza carries the KDF parameters: [logN][r][p][16-byte salt][sealed key]
+type ScryptRecipient struct {
+	passphrase []byte
+	logN       int
+}
+
+// NewScryptRecipient returns a recipient for the passphrase
+func NewScryptRecipient(passphrase []byte) (*ScryptRecipient, error) {
+	if len(passphrase) == 0 {
+		return nil, ErrPassphraseRequired
+	}
+	return &ScryptRecipient{passphrase: passphrase, logN: secretScryptLogN}, nil
+}
+
+func (r *ScryptRecipient) Encrypt(plaintext []byte, key []byte) ([]byte, error) {
+	out := make([]byte, scryptParamsSize+scryptSaltSize)
+	out[0], out[1], out[2] = byte(r.logN), scryptR, scryptP
+	salt := out[scryptParamsSize:]
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return nil, fmt.Errorf("failed to generate salt: %w", err)
+	}
+
+	aead, err := scryptWrapCipher(r.passphrase, salt, r.logN, scryptR, scryptP)
+	if err != nil {
+		return nil, err
+	}
+
+	// the wrapping key is derived with a fresh salt, a zero nonce is safe
+	return aead.Seal(out, make([]byte, aead.NonceSize()), key, nil), nil
+}
+
+func (r *ScryptRecipient) Algorithm() WrapAlgorithm {
+	return WrapScrypt
+}
+
+// ScryptIdentity unwraps data keys wrapped by a ScryptRecipient
+type ScryptIdentity struct {
+	passphrase []byte
+}
+
+// NewScryptIdentity returns an identity for the passphrase
+func NewScryptIdentity(passphrase []byte) (*ScryptIdentity, error) {
+	if len(passphrase) == 0 {
+		return nil, ErrPassphraseRequired
+	}
+	return &ScryptIdentity{passphrase: passphrase}, nil
+}
+
+func (i *ScryptIdentity) Decrypt(alg WrapAlgorithm, ciphertext []byte) ([]byte, error) {
+	if alg != WrapScrypt {
+		return nil, fmt.Errorf("unsupported wrap algorithm for passphrase: %s", alg)
+	}
+
+	if len(ciphertext) < scryptParamsSize+scryptSaltSize {
+		return nil, fmt.Errorf("invalid ciphertext format: too short")
+	}
+
+	logN, r, p := int(ciphertext[0]), int(ciphertext[1]), int(ciphertext[2])
+	// the parameters come from the envelope, a crafted stanza must not make the
+	// derivation allocate or compute more than secm ever asks for
+	if logN < 1 || logN > maxScryptLogN || r != scryptR || p != scryptP {
+		return nil, fmt.Errorf("invalid scrypt parameters: logN=%d r=%d p=%d", logN, r, p)
+	}
+
+	salt := ciphertext[scryptParamsSize : scryptParamsSize+scryptSaltSize]
+	aead, err := scryptWrapCipher(i.passphrase, salt, logN, r, p)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := aead.Open(nil, make([]byte, aead.NonceSize()), ciphertext[scryptParamsSize+scryptSaltSize:], nil)
+	if err != nil {
+		return nil, ErrIncorrectPassphrase
+	}
+
+	return key, nil
+}
+
+// scryptWrapCipher derives the AEAD wrapping the data key from the passphrase
+func scryptWrapCipher(passphrase, salt []byte, logN, r, p int) (cipher.AEAD, error) {
+	key, err := scrypt.Key(passphrase, salt, 1<<logN, r, p, 32)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive key: %w", err)
+	}
+	defer clear(key)
+
+	return newGCM(key)
+}
@@ -0,0 +1,93 @@
+package id
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+// testScryptLogN keeps the derivations of the tests fast
+const testScryptLogN = 10
+
+func TestScryptRoundTrip(t *testing.T) {
+	recipient := &ScryptRecipient{passphrase: []byte("correct horse"), logN: testScryptLogN}
+	key := bytes.Repeat([]byte{0x42}, 32)
+
+	wrapped, err := recipient.Encrypt(nil, key)
+	if err != nil {
+		t.Fatalf("Encrypt: %v", err)
+	}
+
+	identity, err := NewScryptIdentity([]byte("correct horse"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := identity.Decrypt(WrapScrypt, wrapped)
+	if err != nil {
+		t.Fatalf("Decrypt: %v", err)
+	}
+	if !bytes.Equal(got, key) {
+		t.Fatal("unwrapped key mismatch")
+	}
+
+	wrong, err := NewScryptIdentity([]byte("battery staple"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := wrong.Decrypt(WrapScrypt, wrapped); !errors.Is(err, ErrIncorrectPassphrase) {
+		t.Fatalf("wrong passphrase: got %v, want ErrIncorrectPassphrase", err)
+	}
+
+	if _, err := NewScryptIdentity(nil); !errors.Is(err, ErrPassphraseRequired) {
+		t.Fatalf("empty passphrase: got %v, want ErrPassphraseRequired", err)
+	}
+}
+
+func TestScryptParamsRefused(t *testing.T) {
+	recipient := &ScryptRecipient{passphrase: []byte("passphrase"), logN: testScryptLogN}
+	wrapped, err := recipient.Encrypt(nil, make([]byte, 32))
+	if err != nil {
+		t.Fatalf("Encrypt: %v", err)
+	}
+	identity, err := NewScryptIdentity([]byte("passphrase"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// deriving any of these would take gigabytes or minutes, the stanza must be
+	// refused before scrypt runs, not fail to open
+	for name, params := range map[string][scryptParamsSize]byte{
+		"r=255":    {22, 255, scryptP},
+		"p=255":    {22, scryptR, 255},
+		"logN=23":  {maxScryptLogN + 1, scryptR, scryptP},
+		"logN=0":   {0, scryptR, scryptP},
+		"r=0, p=0": {testScryptLogN, 0, 0},
+	} {
+		crafted := bytes.Clone(wrapped)
+		copy(crafted, params[:])
+
+		_, err := identity.Decrypt(WrapScrypt, crafted)
+		if err == nil || errors.Is(err, ErrIncorrectPassphrase) {
+			t.Errorf("%s: got %v, want the parameters refused", name, err)
+		}
+	}
+}
+
+func TestParseScryptParams(t *testing.T) {
+	if _, _, _, err := parseScryptParams("N=32768,r=8,p=1"); err != nil {
+		t.Fatalf("parseScryptParams of the written parameters: %v", err)
+	}
+
+	for _, params := range []string{
+		"N=262144,r=255,p=1",
+		"N=32768,r=8,p=64",
+		"N=8388608,r=8,p=1",
+		"N=1000,r=8,p=1",
+		"N=32768,r=8",
+		"N=32768;r=8;p=1",
+	} {
+		if _, _, _, err := parseScryptParams(params); err == nil {
+			t.Errorf("parseScryptParams(%q) succeeded", params)
+		}
+	}
+}
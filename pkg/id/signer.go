@@ -0,0 +1,216 @@
+package id
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"os"
+)
+
+const (
+	SignatureEd25519         = "ed25519"
+	SignatureECDSAP256SHA256 = "ecdsa-p256-sha256"
+)
+
+// VerifyingKey is the public half of a signing key
+type VerifyingKey interface {
+	EncodableKey
+	// Verify checks the signature of the digest
+	Verify(digest []byte, signature []byte) error
+	// Algorithm returns the signature algorithm of the key
+	Algorithm() string
+	// Bytes returns the PKIX (SPKI) encoding of the key
+	Bytes() []byte
+}
+
+// SigningKey signs the digest of secrets to prove who created them
+type SigningKey interface {
+	EncodableKey
+	Sign(digest []byte) ([]byte, error)
+	VerifyingKey() VerifyingKey
+}
+
+type GenerateSigningKeyOpts struct {
+	Type string
+}
+
+// GenerateSigningKey creates an ed25519 or p256 (ECDSA) signing key
+func GenerateSigningKey(opt GenerateSigningKeyOpts) (SigningKey, error) {
+	switch opt.Type {
+	case "", "ed25519":
+		_, pk, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		return &signingKey{pk: pk}, nil
+	case "p256":
+		pk, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		return &signingKey{pk: pk}, nil
+	default:
+		return nil, fmt.Errorf("unsupported signing key type: %s", opt.Type)
+	}
+}
+
+// LoadSigningKeyFile loads the signing key from the provided file path
+func LoadSigningKeyFile(keyPath string) (SigningKey, error) {
+	keyData, err := os.ReadFile(keyPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read signing key file: %w", err)
+	}
+
+	block, _ := pem.Decode(keyData)
+	if block == nil {
+		return nil, fmt.Errorf("failed to decode PEM block")
+	}
+
+	pk, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse signing key: %w", err)
+	}
+
+	switch key := pk.(type) {
+	case ed25519.PrivateKey:
+		return &signingKey{pk: key}, nil
+	case *ecdsa.PrivateKey:
+		if key.Curve != elliptic.P256() {
+			return nil, fmt.Errorf("unsupported ECDSA curve for signing: %s", key.Curve.Params().Name)
+		}
+		return &signingKey{pk: key}, nil
+	default:
+		return nil, fmt.Errorf("unsupported signing key type %T", key)
+	}
+}
+
+// ParseVerifyingKey parses a PEM or DER encoded PKIX public key usable to verify signatures
+func ParseVerifyingKey(data []byte) (VerifyingKey, error) {
+	block, _ := pem.Decode(data)
+	if block != nil {
+		data = block.Bytes
+	}
+
+	pub, err := x509.ParsePKIXPublicKey(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse verifying key: %w", err)
+	}
+
+	switch key := pub.(type) {
+	case ed25519.PublicKey:
+		return &verifyingKey{pub: key}, nil
+	case *ecdsa.PublicKey:
+		if key.Curve != elliptic.P256() {
+			return nil, fmt.Errorf("unsupported ECDSA curve for signing: %s", key.Curve.Params().Name)
+		}
+		return &verifyingKey{pub: key}, nil
+	default:
+		return nil, fmt.Errorf("unsupported verifying key type %T", key)
+	}
+}
+
+// LoadVerifyingKeyFile loads a verifying key from the provided file path
+func LoadVerifyingKeyFile(keyPath string) (VerifyingKey, error) {
+	data, err := os.ReadFile(keyPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read verifying key file: %w", err)
+	}
+
+	return ParseVerifyingKey(data)
+}
+
+// SameVerifyingKey reports whether both keys are the same
+func SameVerifyingKey(a, b VerifyingKey) bool {
+	return bytes.Equal(a.Bytes(), b.Bytes())
+}
+
+type signingKey struct {
+	pk crypto.Signer
+}
+
+func (k *signingKey) Encode(dst io.Writer) error {
+	der, err := x509.MarshalPKCS8PrivateKey(k.pk)
+	if err != nil {
+		return fmt.Errorf("failed to marshal signing key: %w", err)
+	}
+
+	return pem.Encode(dst, &pem.Block{
+		Type:  "PRIVATE KEY",
+		Bytes: der,
+	})
+}
+
+func (k *signingKey) Sign(digest []byte) ([]byte, error) {
+	switch pk := k.pk.(type) {
+	case ed25519.PrivateKey:
+		return ed25519.Sign(pk, digest), nil
+	case *ecdsa.PrivateKey:
+		return ecdsa.SignASN1(rand.Reader, pk, digest)
+	default:
+		return nil, fmt.Errorf("unsupported signing key type %T", pk)
+	}
+}
+
+func (k *signingKey) VerifyingKey() VerifyingKey {
+	return &verifyingKey{pub: k.pk.Public()}
+}
+
+type verifyingKey struct {
+	pub crypto.PublicKey
+}
+
+func (k *verifyingKey) Encode(dst io.Writer) error {
+	der, err := x509.MarshalPKIXPublicKey(k.pub)
+	if err != nil {
+		return fmt.Errorf("failed to marshal verifying key: %w", err)
+	}
+
+	if err := pem.Encode(dst, &pem.Block{
+		Type:  "PUBLIC KEY",
+		Bytes: der,
+	}); err != nil {
+		return fmt.Errorf("failed to write verifying key: %w", err)
+	}
+
+	return nil
+}
+
+func (k *verifyingKey) Verify(digest []byte, signature []byte) error {
+	switch pub := k.pub.(type) {
+	case ed25519.PublicKey:
+		if !ed25519.Verify(pub, digest, signature) {
+			return fmt.Errorf("invalid signature")
+		}
+	case *ecdsa.PublicKey:
+		if !ecdsa.VerifyASN1(pub, digest, signature) {
+			return fmt.Errorf("invalid signature")
+		}
+	default:
+		return fmt.Errorf("unsupported verifying key type %T", pub)
+	}
+
+	return nil
+}
+
+func (k *verifyingKey) Algorithm() string {
+	switch k.pub.(type) {
+	case ed25519.PublicKey:
+		return SignatureEd25519
+	case *ecdsa.PublicKey:
+		return SignatureECDSAP256SHA256
+	default:
+		return "unknown"
+	}
+}
+
+func (k *verifyingKey) Bytes() []byte {
+	der, _ := x509.MarshalPKIXPublicKey(k.pub)
+	return der
+}
@@ -0,0 +1,77 @@
+package id
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// LoadSSHKeyFile loads an OpenSSH private key (ed25519, rsa or ecdsa) as an identity.
+// The passphrase of an encrypted key is obtained through the passphrase reader.
+func LoadSSHKeyFile(keyPath string) (KeyPackageIdentity, error) {
+	data, err := os.ReadFile(keyPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read SSH key file: %w", err)
+	}
+	defer clear(data)
+
+	raw, err := ssh.ParseRawPrivateKey(data)
+	var missing *ssh.PassphraseMissingError
+	if errors.As(err, &missing) {
+		passphrase, perr := passphraseReader(keyPath)
+		if perr != nil {
+			return nil, perr
+		}
+
+		raw, err = ssh.ParseRawPrivateKeyWithPassphrase(data, passphrase)
+		if errors.Is(err, x509.IncorrectPasswordError) {
+			return nil, ErrIncorrectPassphrase
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse SSH private key: %w", err)
+	}
+
+	return identityFromSSHKey(raw)
+}
+
+// identityFromSSHKey wraps a private key parsed by x/crypto/ssh into an identity
+func identityFromSSHKey(raw interface{}) (KeyPackageIdentity, error) {
+	switch pk := raw.(type) {
+	case *ed25519.PrivateKey:
+		return identityFromSSHKey(*pk)
+	case ed25519.PrivateKey:
+		identity, err := createEd25519IdKey(pk)
+		if err != nil {
+			return nil, err
+		}
+		return identity, nil
+	case *rsa.PrivateKey:
+		return createRSAIdKey(pk), nil
+	case *ecdsa.PrivateKey:
+		dhPk, err := pk.ECDH()
+		if err != nil {
+			return nil, fmt.Errorf("failed to convert ECDSA key to ECDH key: %w", err)
+		}
+		return createECDHIdKey(dhPk), nil
+	default:
+		return nil, fmt.Errorf("unsupported SSH key type %T", raw)
+	}
+}
+
+// parseSSHPublicKey converts an OpenSSH public key, as found in authorized_keys
+// or id_*.pub files, into a recipient
+func parseSSHPublicKey(key ssh.PublicKey) (PublicKey, error) {
+	cpk, ok := key.(ssh.CryptoPublicKey)
+	if !ok {
+		return nil, fmt.Errorf("unsupported SSH key type %s", key.Type())
+	}
+
+	return publicKeyFromCrypto(cpk.CryptoPublicKey())
+}
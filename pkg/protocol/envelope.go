@@ -1,6 +1,7 @@
 package protocol
 
 import (
+	"github.com/open-zhy/secm/pkg/crypto"
 	"github.com/open-zhy/secm/pkg/id"
 )
 
@@ -9,5 +10,5 @@ type EnvelopeSender interface {
 }
 
 type EnvelopeReceiver interface {
-	Unwrap(data []byte) ([]byte, error)
+	Unwrap(data []byte) (*crypto.SecureBuffer, error)
 }
@@ -1,6 +1,7 @@
 package protocol
 
 import (
+	"github.com/open-zhy/secm/pkg/crypto"
 	"github.com/open-zhy/secm/pkg/id"
 )
 
@@ -12,10 +13,10 @@ func (b *BijectiveEnvelope) WrapFor(data []byte, receiver id.Encrypter) ([]byte,
 	return data, nil // Placeholder implementation
 }
 
-func (b *BijectiveEnvelope) Unwrap(data []byte) ([]byte, error) {
+func (b *BijectiveEnvelope) Unwrap(data []byte) (*crypto.SecureBuffer, error) {
 	// Implement the bijective unwrapping logic here
 	// For example, you might use the receiver's private key to decrypt the data
-	return data, nil // Placeholder implementation
+	return crypto.SecureBufferFrom(data), nil // Placeholder implementation
 }
 
 func NewBijectiveTransporter() *BijectiveEnvelope {
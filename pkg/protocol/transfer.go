@@ -12,13 +12,13 @@ type TransferEnvelope struct {
 func (t *TransferEnvelope) WrapFor(data []byte, receiver id.Encrypter) ([]byte, error) {
 	// Implement the transfer wrapping logic here
 	// For example, you might use the receiver's public key to encrypt the data
-	return crypto.EncryptData(receiver, data)
+	return crypto.EncryptData(receiver, data, nil)
 }
 
-func (t *TransferEnvelope) Unwrap(data []byte) ([]byte, error) {
+func (t *TransferEnvelope) Unwrap(data []byte) (*crypto.SecureBuffer, error) {
 	// Implement the transfer unwrapping logic here
 	// For example, you might use the receiver's private key to decrypt the data
-	return crypto.DecryptData(t.identity, data)
+	return crypto.DecryptData(t.identity, data, nil)
 }
 
 func NewTransferEnvelope(identity id.KeyPackageIdentity) *TransferEnvelope {
@@ -0,0 +1,45 @@
+package secret
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrExpired is returned when reading a secret past its expiry
+var ErrExpired = errors.New("secret has expired")
+
+// ErrNoReadsLeft is returned when reading a secret whose reads are used up
+var ErrNoReadsLeft = errors.New("secret has no reads left")
+
+// HasPolicy reports whether the secret expires or has a read limit
+func (s *Secret) HasPolicy() bool {
+	return !s.ExpiresAt.IsZero() || s.MaxReads > 0
+}
+
+// IsExpired reports whether the secret expires and its expiry has passed
+func (s *Secret) IsExpired() bool {
+	return !s.ExpiresAt.IsZero() && !time.Now().Before(s.ExpiresAt)
+}
+
+// ReadsLeft returns the number of reads left before the secret is deleted given
+// the reads so far, ok is false when its reads are not limited
+func (s *Secret) ReadsLeft(reads int) (n int, ok bool) {
+	if s.MaxReads <= 0 {
+		return 0, false
+	}
+	return max(0, s.MaxReads-reads), true
+}
+
+// CheckPolicy returns an error when the secret cannot be read anymore given the
+// reads so far
+func (s *Secret) CheckPolicy(reads int) error {
+	if s.IsExpired() {
+		return fmt.Errorf("%w on %s", ErrExpired, s.ExpiresAt.Format("2006-01-02 15:04:05"))
+	}
+	if n, ok := s.ReadsLeft(reads); ok && n == 0 {
+		return ErrNoReadsLeft
+	}
+
+	return nil
+}
@@ -1,11 +1,15 @@
 package secret
 
 import (
+	"bytes"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/binary"
 	"encoding/json"
 	"fmt"
 	"io"
 	"os"
+	"strconv"
 	"time"
 
 	"gopkg.in/yaml.v3"
@@ -13,15 +17,54 @@ import (
 
 // Secret represents a stored secret with metadata
 type Secret struct {
-	Name        string    `yaml:"name"`
-	Description string    `yaml:"description,omitempty"`
-	Data        string    `yaml:"data"` // base64 encoded encrypted data
-	CreatedAt   time.Time `yaml:"created_at"`
-	Tags        []string  `yaml:"tags,omitempty"`
-	Type        string    `yaml:"type,omitempty"`   // optional type of secret (e.g., "api-key", "certificate")
-	Format      string    `yaml:"format,omitempty"` // original format of the secret (e.g., "text", "json", "binary")
+	Name        string     `yaml:"name"`
+	Description string     `yaml:"description,omitempty"`
+	Data        string     `yaml:"data,omitempty"` // base64 encoded encrypted data
+	Blob        string     `yaml:"blob,omitempty"` // file holding the encrypted data when stored detached, relative to the secrets directory
+	CreatedAt   time.Time  `yaml:"created_at"`
+	Tags        []string   `yaml:"tags,omitempty"`
+	Type        string     `yaml:"type,omitempty"`        // optional type of secret (e.g., "api-key", "certificate")
+	Format      string     `yaml:"format,omitempty"`      // original format of the secret (e.g., "text", "json", "binary")
+	Binding     int        `yaml:"binding,omitempty"`     // version of the metadata bound to the ciphertext, 0 when unbound
+	Signature   *Signature `yaml:"signature,omitempty"`   // detached signature of the creator
+	Recipients  []string   `yaml:"recipients,omitempty"`  // subjects of the certificates the secret was shared with or granted to, informative
+	ContentMAC  string     `yaml:"content_mac,omitempty"` // HMAC of the content keyed by the identity, set when created with deduplication
+	Version     int        `yaml:"version,omitempty"`     // number of the current content, 0 for secrets never updated
+	Size        int64      `yaml:"size,omitempty"`        // size of the current plaintext, 0 when unknown
+	UpdatedAt   time.Time  `yaml:"updated_at,omitempty"`  // when the current content was written, zero for the first version
+	History     []Version  `yaml:"history,omitempty"`     // previous contents, the oldest first
+	ModifiedAt  time.Time  `yaml:"modified_at,omitempty"` // when the metadata was last changed, zero when never
+	ExpiresAt   time.Time  `yaml:"expires_at,omitempty"`  // after which the secret cannot be read, zero when it never expires
+	MaxReads    int        `yaml:"max_reads,omitempty"`   // number of reads after which the secret is deleted, 0 when unlimited
 }
 
+// Signature is a detached signature over the ciphertext and metadata of a secret
+type Signature struct {
+	Version   int    `yaml:"version"`
+	Algorithm string `yaml:"algorithm"`
+	Signer    string `yaml:"signer"` // base64 PKIX encoding of the verifying key
+	Value     string `yaml:"value"`  // base64 encoded signature
+}
+
+const (
+	// SignatureV1 covers the ID, all the metadata and the SHA-256 of the ciphertext
+	SignatureV1 = 1
+	// SignatureV2 covers the lifecycle policy as well
+	SignatureV2 = 2
+)
+
+const (
+	// BindingNone is used by secrets encrypted without associated data
+	BindingNone = 0
+	// BindingV1 binds the secret ID, format and creation time to the ciphertext
+	BindingV1 = 1
+	// BindingV2 binds the lifecycle policy as well
+	BindingV2 = 2
+
+	// CurrentBinding is the binding applied to new secrets
+	CurrentBinding = BindingV2
+)
+
 // New creates a new Secret with the given name and encrypted data
 func New(name string, encryptedData []byte) *Secret {
 	now := time.Now()
@@ -29,6 +72,7 @@ func New(name string, encryptedData []byte) *Secret {
 		Name:      name,
 		Data:      base64.StdEncoding.EncodeToString(encryptedData),
 		CreatedAt: now,
+		Binding:   CurrentBinding,
 	}
 }
 
@@ -61,11 +105,122 @@ func Load(path string) (*Secret, error) {
 	return &secret, nil
 }
 
+// AssociatedData returns the data authenticated along with the ciphertext of
+// the secret stored under the given ID, according to its binding version.
+// Only the fields which change how the secret is interpreted or when it can be
+// read are bound. Name, description, type and tags are informative, they are left
+// out so that `secm meta set` can edit them without the identity key, the signature
+// covers them. The policy is bound from BindingV2 on, relaxing it makes the secret
+// undecryptable even when its signature is not checked.
+func (s *Secret) AssociatedData(id string) ([]byte, error) {
+	switch s.Binding {
+	case BindingNone:
+		return nil, nil
+	case BindingV1, BindingV2:
+		var buf bytes.Buffer
+		fields := []string{
+			id,
+			s.Format,
+			s.CreatedAt.UTC().Format(time.RFC3339Nano),
+		}
+		if s.Binding == BindingV1 {
+			buf.WriteString("secm-binding-v1")
+		} else {
+			var expiresAt string
+			if !s.ExpiresAt.IsZero() {
+				expiresAt = s.ExpiresAt.UTC().Format(time.RFC3339Nano)
+			}
+			buf.WriteString("secm-binding-v2")
+			fields = append(fields, expiresAt, strconv.Itoa(s.MaxReads))
+		}
+		for _, field := range fields {
+			binary.Write(&buf, binary.BigEndian, uint32(len(field)))
+			buf.WriteString(field)
+		}
+		return buf.Bytes(), nil
+	default:
+		return nil, fmt.Errorf("unsupported secret binding: %d", s.Binding)
+	}
+}
+
+// SignatureVersion returns the signature version applied to the secret, secrets
+// without lifecycle policy keep the version older releases verify
+func (s *Secret) SignatureVersion() int {
+	if s.HasPolicy() {
+		return SignatureV2
+	}
+	return SignatureV1
+}
+
+// SignedDigest returns the digest signed for the secret stored under the given ID,
+// ciphertextDigest is the SHA-256 of its encrypted data
+func (s *Secret) SignedDigest(id string, version int, ciphertextDigest []byte) ([]byte, error) {
+	h := sha256.New()
+	switch version {
+	case SignatureV1:
+		// a policy cannot be stripped by falling back to a version not covering it
+		if s.HasPolicy() {
+			return nil, fmt.Errorf("signature version %d does not cover the lifecycle policy", version)
+		}
+		h.Write([]byte("secm-signature-v1"))
+	case SignatureV2:
+		h.Write([]byte("secm-signature-v2"))
+	default:
+		return nil, fmt.Errorf("unsupported signature version: %d", version)
+	}
+
+	fields := []string{
+		id,
+		s.Name,
+		s.Description,
+		s.Type,
+		s.Format,
+		s.CreatedAt.UTC().Format(time.RFC3339Nano),
+		strconv.Itoa(s.Binding),
+		strconv.Itoa(len(s.Tags)),
+	}
+	fields = append(fields, s.Tags...)
+	if version >= SignatureV2 {
+		var expiresAt string
+		if !s.ExpiresAt.IsZero() {
+			expiresAt = s.ExpiresAt.UTC().Format(time.RFC3339Nano)
+		}
+		fields = append(fields, expiresAt, strconv.Itoa(s.MaxReads))
+	}
+	fields = append(fields, string(ciphertextDigest))
+	for _, field := range fields {
+		binary.Write(h, binary.BigEndian, uint32(len(field)))
+		h.Write([]byte(field))
+	}
+
+	return h.Sum(nil), nil
+}
+
+// LastModified returns when the secret was last changed, its content or metadata
+func (s *Secret) LastModified() time.Time {
+	modified := s.CreatedAt
+	for _, t := range []time.Time{s.UpdatedAt, s.ModifiedAt} {
+		if t.After(modified) {
+			modified = t
+		}
+	}
+
+	return modified
+}
+
 // GetData returns the decoded encrypted data
 func (s *Secret) Raw() ([]byte, error) {
+	if s.IsDetached() {
+		return nil, fmt.Errorf("secret data is stored detached in %s", s.Blob)
+	}
 	return base64.StdEncoding.DecodeString(s.Data)
 }
 
+// IsDetached reports whether the encrypted data is stored in a separate file
+func (s *Secret) IsDetached() bool {
+	return s.Blob != ""
+}
+
 // Read implements io.Reader interface for the secret
 // This allows the entire secret (including metadata) to be streamed
 func (s *Secret) Read(p []byte) (n int, err error) {
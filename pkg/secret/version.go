@@ -0,0 +1,117 @@
+package secret
+
+import (
+	"fmt"
+	"time"
+)
+
+// Version is a content of the secret superseded by an update or a rollback, kept
+// in its history. Every version is bound to the same ID and metadata.
+type Version struct {
+	Number    int        `yaml:"number"`
+	Data      string     `yaml:"data,omitempty"`
+	Blob      string     `yaml:"blob,omitempty"`
+	Size      int64      `yaml:"size,omitempty"` // size of the plaintext, 0 when unknown
+	Binding   int        `yaml:"binding,omitempty"`
+	CreatedAt time.Time  `yaml:"created_at"`
+	Signature *Signature `yaml:"signature,omitempty"`
+}
+
+// CurrentVersion returns the number of the current content, secrets never
+// updated are at version 1
+func (s *Secret) CurrentVersion() int {
+	return max(1, s.Version)
+}
+
+// Current returns the current content of the secret as a version
+func (s *Secret) Current() Version {
+	createdAt := s.UpdatedAt
+	if createdAt.IsZero() {
+		createdAt = s.CreatedAt
+	}
+
+	return Version{
+		Number:    s.CurrentVersion(),
+		Data:      s.Data,
+		Blob:      s.Blob,
+		Size:      s.Size,
+		Binding:   s.Binding,
+		CreatedAt: createdAt,
+		Signature: s.Signature,
+	}
+}
+
+// Versions returns all the versions of the secret, the oldest first and the
+// current one last
+func (s *Secret) Versions() []Version {
+	versions := make([]Version, 0, len(s.History)+1)
+	versions = append(versions, s.History...)
+	return append(versions, s.Current())
+}
+
+// AtVersion returns a copy of the secret holding the content of version n,
+// which decrypts and verifies as the secret did when n was current
+func (s *Secret) AtVersion(n int) (*Secret, error) {
+	for _, v := range s.Versions() {
+		if v.Number == n {
+			view := *s
+			view.History = nil
+			view.setContent(v)
+			return &view, nil
+		}
+	}
+
+	return nil, fmt.Errorf("secret has no version %d", n)
+}
+
+// SetVersion replaces the stored content of version n with the one of view,
+// as returned by AtVersion and re-encrypted since
+func (s *Secret) SetVersion(n int, view *Secret) {
+	if n == s.CurrentVersion() {
+		s.setContent(view.Current())
+		return
+	}
+
+	for i := range s.History {
+		if s.History[i].Number == n {
+			s.History[i] = view.Current()
+		}
+	}
+}
+
+// AddVersion pushes the current content to the history and makes v the current one
+func (s *Secret) AddVersion(v Version) {
+	s.History = append(s.History, s.Current())
+	s.setContent(v)
+}
+
+// PruneHistory drops the oldest versions so that at most keep versions remain,
+// the current one included, and returns the dropped ones
+func (s *Secret) PruneHistory(keep int) []Version {
+	drop := len(s.History) + 1 - max(1, keep)
+	if drop <= 0 {
+		return nil
+	}
+
+	pruned := s.History[:drop:drop]
+	s.History = append([]Version(nil), s.History[drop:]...)
+	if len(s.History) == 0 {
+		s.History = nil
+	}
+
+	return pruned
+}
+
+func (s *Secret) setContent(v Version) {
+	s.Data = v.Data
+	s.Blob = v.Blob
+	s.Size = v.Size
+	s.Binding = v.Binding
+	s.Signature = v.Signature
+	s.Version = 0
+	s.UpdatedAt = time.Time{}
+	if v.Number > 1 {
+		s.Version = v.Number
+		s.UpdatedAt = v.CreatedAt
+	}
+}
@@ -0,0 +1,122 @@
+package shamir
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// PEMType is the PEM block type of a printable share
+const PEMType = "SECM KEY SHARE"
+
+// setIDSize is the size of the random identifier shared by the shares of one split
+const setIDSize = 4
+
+// ArmoredShare is a share along with what is needed to combine it, printable as text
+type ArmoredShare struct {
+	Share
+	// Set identifies the shares produced by the same split
+	Set       string
+	Threshold int
+}
+
+// NewSetID returns a random identifier for the shares of a split
+func NewSetID() (string, error) {
+	id := make([]byte, setIDSize)
+	if _, err := io.ReadFull(rand.Reader, id); err != nil {
+		return "", fmt.Errorf("failed to generate share set identifier: %w", err)
+	}
+	return hex.EncodeToString(id), nil
+}
+
+// checksum detects shares mistyped or mixed up when copied by hand
+func (s *ArmoredShare) checksum() string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s|%d|%d|", s.Set, s.X, s.Threshold)
+	h.Write(s.Y)
+	return hex.EncodeToString(h.Sum(nil)[:4])
+}
+
+// Encode writes the share as a PEM block
+func (s *ArmoredShare) Encode(dst io.Writer) error {
+	return pem.Encode(dst, &pem.Block{
+		Type: PEMType,
+		Headers: map[string]string{
+			"Set":       s.Set,
+			"Share":     strconv.Itoa(int(s.X)),
+			"Threshold": strconv.Itoa(s.Threshold),
+			"Checksum":  s.checksum(),
+		},
+		Bytes: s.Y,
+	})
+}
+
+// DecodeShares parses all the share blocks found in data and verifies their checksum
+func DecodeShares(data []byte) ([]*ArmoredShare, error) {
+	var shares []*ArmoredShare
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != PEMType {
+			continue
+		}
+
+		x, err := strconv.Atoi(block.Headers["Share"])
+		if err != nil || x < 1 || x > MaxShares {
+			return nil, fmt.Errorf("invalid share number: %q", block.Headers["Share"])
+		}
+
+		threshold, err := strconv.Atoi(block.Headers["Threshold"])
+		if err != nil || threshold < MinThreshold || threshold > MaxShares {
+			return nil, fmt.Errorf("invalid share threshold: %q", block.Headers["Threshold"])
+		}
+
+		s := &ArmoredShare{
+			Share:     Share{X: byte(x), Y: block.Bytes},
+			Set:       block.Headers["Set"],
+			Threshold: threshold,
+		}
+
+		if s.checksum() != block.Headers["Checksum"] {
+			return nil, fmt.Errorf("checksum mismatch for share %d, it was altered or mistyped", x)
+		}
+
+		shares = append(shares, s)
+	}
+
+	if len(shares) == 0 {
+		return nil, fmt.Errorf("no share found")
+	}
+
+	return shares, nil
+}
+
+// CombineArmored checks the shares belong to the same split and are enough
+// to reach its threshold, then recovers the secret
+func CombineArmored(shares []*ArmoredShare) ([]byte, error) {
+	if len(shares) == 0 {
+		return nil, fmt.Errorf("no share found")
+	}
+
+	first := shares[0]
+	plain := make([]Share, 0, len(shares))
+	for _, s := range shares {
+		if s.Set != first.Set || s.Threshold != first.Threshold {
+			return nil, fmt.Errorf("shares come from different splits (%s and %s)", first.Set, s.Set)
+		}
+		plain = append(plain, s.Share)
+	}
+
+	if len(shares) < first.Threshold {
+		return nil, fmt.Errorf("%d shares given, %d are required", len(shares), first.Threshold)
+	}
+
+	return Combine(plain)
+}
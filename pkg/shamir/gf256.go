@@ -0,0 +1,41 @@
+package shamir
+
+// Arithmetic in GF(2^8) with the AES reduction polynomial x^8+x^4+x^3+x+1 (0x11b).
+// Multiplication goes through log/exp tables of the generator 3.
+
+var (
+	expTable [510]byte
+	logTable [256]byte
+)
+
+func init() {
+	x := byte(1)
+	for i := 0; i < 255; i++ {
+		expTable[i] = x
+		expTable[i+255] = x
+		logTable[x] = byte(i)
+
+		// x *= 3, i.e. x*2 ^ x reduced modulo 0x11b
+		hi := x & 0x80
+		x2 := x << 1
+		if hi != 0 {
+			x2 ^= 0x1b
+		}
+		x ^= x2
+	}
+}
+
+func mul(a, b byte) byte {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	return expTable[int(logTable[a])+int(logTable[b])]
+}
+
+// div returns a/b, b must not be zero
+func div(a, b byte) byte {
+	if a == 0 {
+		return 0
+	}
+	return expTable[int(logTable[a])+255-int(logTable[b])]
+}
@@ -0,0 +1,122 @@
+// Package shamir implements Shamir's secret sharing over GF(256).
+//
+// Every byte of the secret is the constant term of its own random polynomial of
+// degree threshold-1, a share holds the evaluation of all polynomials at a non-zero
+// x coordinate. Any threshold shares recover the secret by Lagrange interpolation
+// at x=0, fewer reveal nothing about it.
+package shamir
+
+import (
+	"crypto/rand"
+	"fmt"
+	"io"
+)
+
+const (
+	// MaxShares is the number of distinct non-zero x coordinates in GF(256)
+	MaxShares = 255
+	// MinThreshold is the minimum number of shares required to recover the secret
+	MinThreshold = 2
+)
+
+// Share is a point of the polynomials, X is never zero
+type Share struct {
+	X byte
+	Y []byte
+}
+
+// Split divides the secret into n shares, any threshold of them recovering it
+func Split(secret []byte, n, threshold int) ([]Share, error) {
+	if len(secret) == 0 {
+		return nil, fmt.Errorf("cannot split an empty secret")
+	}
+	if threshold < MinThreshold {
+		return nil, fmt.Errorf("threshold must be at least %d", MinThreshold)
+	}
+	if n < threshold {
+		return nil, fmt.Errorf("number of shares (%d) cannot be less than the threshold (%d)", n, threshold)
+	}
+	if n > MaxShares {
+		return nil, fmt.Errorf("number of shares cannot exceed %d", MaxShares)
+	}
+
+	shares := make([]Share, n)
+	for i := range shares {
+		shares[i] = Share{X: byte(i + 1), Y: make([]byte, len(secret))}
+	}
+
+	// coefficients of the current polynomial, the constant term is the secret byte
+	coefficients := make([]byte, threshold)
+	defer clear(coefficients)
+
+	for i, b := range secret {
+		coefficients[0] = b
+		if _, err := io.ReadFull(rand.Reader, coefficients[1:]); err != nil {
+			return nil, fmt.Errorf("failed to generate coefficients: %w", err)
+		}
+
+		for j := range shares {
+			shares[j].Y[i] = evaluate(coefficients, shares[j].X)
+		}
+	}
+
+	return shares, nil
+}
+
+// Combine recovers the secret from the shares, giving fewer shares than the
+// threshold yields a wrong secret without error
+func Combine(shares []Share) ([]byte, error) {
+	if len(shares) < MinThreshold {
+		return nil, fmt.Errorf("at least %d shares are required", MinThreshold)
+	}
+
+	size := len(shares[0].Y)
+	seen := make(map[byte]bool, len(shares))
+	for _, s := range shares {
+		if s.X == 0 {
+			return nil, fmt.Errorf("invalid share coordinate 0")
+		}
+		if seen[s.X] {
+			return nil, fmt.Errorf("duplicate share %d", s.X)
+		}
+		if len(s.Y) != size || size == 0 {
+			return nil, fmt.Errorf("shares have different lengths")
+		}
+		seen[s.X] = true
+	}
+
+	// Lagrange basis polynomials evaluated at x=0:
+	// l_j(0) = prod_{m != j} x_m / (x_m - x_j), subtraction being xor
+	basis := make([]byte, len(shares))
+	for j, sj := range shares {
+		num, den := byte(1), byte(1)
+		for m, sm := range shares {
+			if m == j {
+				continue
+			}
+			num = mul(num, sm.X)
+			den = mul(den, sm.X^sj.X)
+		}
+		basis[j] = div(num, den)
+	}
+
+	secret := make([]byte, size)
+	for i := range secret {
+		var b byte
+		for j, s := range shares {
+			b ^= mul(s.Y[i], basis[j])
+		}
+		secret[i] = b
+	}
+
+	return secret, nil
+}
+
+// evaluate computes the polynomial at x with Horner's method
+func evaluate(coefficients []byte, x byte) byte {
+	var y byte
+	for i := len(coefficients) - 1; i >= 0; i-- {
+		y = mul(y, x) ^ coefficients[i]
+	}
+	return y
+}
@@ -0,0 +1,170 @@
+package shamir
+
+import (
+	"bytes"
+	"crypto/rand"
+	"testing"
+)
+
+// slowMul multiplies in GF(2^8) bit by bit, as a reference for the tables
+func slowMul(a, b byte) byte {
+	var p byte
+	for b != 0 {
+		if b&1 != 0 {
+			p ^= a
+		}
+		hi := a & 0x80
+		a <<= 1
+		if hi != 0 {
+			a ^= 0x1b
+		}
+		b >>= 1
+	}
+	return p
+}
+
+func TestGF256(t *testing.T) {
+	for a := 0; a < 256; a++ {
+		for b := 0; b < 256; b++ {
+			p := mul(byte(a), byte(b))
+			if want := slowMul(byte(a), byte(b)); p != want {
+				t.Fatalf("mul(%d, %d) = %d, want %d", a, b, p, want)
+			}
+			if b != 0 && div(p, byte(b)) != byte(a) {
+				t.Fatalf("div(mul(%d, %d), %d) = %d", a, b, b, div(p, byte(b)))
+			}
+		}
+	}
+}
+
+func newSecret(t *testing.T) []byte {
+	t.Helper()
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		t.Fatal(err)
+	}
+	return secret
+}
+
+func TestSplitCombine(t *testing.T) {
+	secret := newSecret(t)
+
+	for _, tc := range []struct{ n, threshold int }{{2, 2}, {3, 2}, {5, 3}, {5, 5}, {MaxShares, 10}} {
+		shares, err := Split(secret, tc.n, tc.threshold)
+		if err != nil {
+			t.Fatalf("Split(%d, %d): %v", tc.n, tc.threshold, err)
+		}
+		if len(shares) != tc.n {
+			t.Fatalf("Split(%d, %d) returned %d shares", tc.n, tc.threshold, len(shares))
+		}
+
+		// any threshold shares, taken from the end to not only use the first ones
+		subset := shares[tc.n-tc.threshold:]
+		got, err := Combine(subset)
+		if err != nil {
+			t.Fatalf("Combine %d of %d: %v", tc.threshold, tc.n, err)
+		}
+		if !bytes.Equal(got, secret) {
+			t.Fatalf("Combine %d of %d: wrong secret", tc.threshold, tc.n)
+		}
+
+		// more shares than needed recover it too
+		if got, err := Combine(shares); err != nil || !bytes.Equal(got, secret) {
+			t.Fatalf("Combine all %d shares: err %v", tc.n, err)
+		}
+
+		// below the threshold, the interpolation yields another value
+		if tc.threshold > MinThreshold {
+			got, err := Combine(shares[:tc.threshold-1])
+			if err != nil {
+				t.Fatalf("Combine %d of %d: %v", tc.threshold-1, tc.n, err)
+			}
+			if bytes.Equal(got, secret) {
+				t.Fatalf("Combine %d shares below the threshold %d recovered the secret", tc.threshold-1, tc.threshold)
+			}
+		}
+	}
+}
+
+func TestSplitInvalid(t *testing.T) {
+	secret := newSecret(t)
+
+	for _, tc := range []struct {
+		secret       []byte
+		n, threshold int
+	}{
+		{nil, 3, 2},
+		{secret, 3, 1},
+		{secret, 2, 3},
+		{secret, MaxShares + 1, 2},
+	} {
+		if _, err := Split(tc.secret, tc.n, tc.threshold); err == nil {
+			t.Errorf("Split(%d bytes, %d, %d) succeeded", len(tc.secret), tc.n, tc.threshold)
+		}
+	}
+}
+
+func TestCombineInvalid(t *testing.T) {
+	shares, err := Split(newSecret(t), 3, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Combine(shares[:1]); err == nil {
+		t.Error("Combine of a single share succeeded")
+	}
+	if _, err := Combine([]Share{shares[0], shares[0]}); err == nil {
+		t.Error("Combine of duplicate shares succeeded")
+	}
+
+	short := Share{X: shares[1].X, Y: shares[1].Y[:10]}
+	if _, err := Combine([]Share{shares[0], short}); err == nil {
+		t.Error("Combine of shares of different lengths succeeded")
+	}
+}
+
+func TestArmoredShares(t *testing.T) {
+	secret := newSecret(t)
+	shares, err := Split(secret, 5, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	set, err := NewSetID()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	for _, s := range shares[1:4] {
+		armored := &ArmoredShare{Share: s, Set: set, Threshold: 3}
+		if err := armored.Encode(&buf); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	decoded, err := DecodeShares(buf.Bytes())
+	if err != nil {
+		t.Fatalf("DecodeShares: %v", err)
+	}
+	got, err := CombineArmored(decoded)
+	if err != nil {
+		t.Fatalf("CombineArmored: %v", err)
+	}
+	if !bytes.Equal(got, secret) {
+		t.Fatal("CombineArmored: wrong secret")
+	}
+
+	// the threshold travels with the shares, fewer are refused
+	if _, err := CombineArmored(decoded[:2]); err == nil {
+		t.Fatal("CombineArmored below the threshold succeeded")
+	}
+
+	// a mistyped share fails its checksum
+	tampered := bytes.Replace(buf.Bytes(), []byte("Share: 3"), []byte("Share: 9"), 1)
+	if bytes.Equal(tampered, buf.Bytes()) {
+		t.Fatal("share 3 not found in the encoded shares")
+	}
+	if _, err := DecodeShares(tampered); err == nil {
+		t.Fatal("DecodeShares accepted a share with a wrong number")
+	}
+}
@@ -0,0 +1,68 @@
+package workspace
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+
+	"github.com/open-zhy/secm/pkg/id"
+)
+
+// SaveCertificate writes the certificate chain issued for the identity key
+func (w *Workspace) SaveCertificate(chain []*x509.Certificate) error {
+	var buf bytes.Buffer
+	for _, cert := range chain {
+		if err := pem.Encode(&buf, &pem.Block{Type: id.CertificateType, Bytes: cert.Raw}); err != nil {
+			return fmt.Errorf("failed to encode certificate: %w", err)
+		}
+	}
+
+	if err := writeFileAtomic(w.CertPath, buf.Bytes(), 0644); err != nil {
+		return fmt.Errorf("failed to write identity certificate: %w", err)
+	}
+
+	return nil
+}
+
+// LoadCertificate returns the certificate chain of the identity, the error
+// satisfies os.IsNotExist when the identity has no certificate
+func (w *Workspace) LoadCertificate() ([]*x509.Certificate, error) {
+	if _, err := os.Stat(w.CertPath); err != nil {
+		return nil, err
+	}
+
+	return id.LoadCertificateFile(w.CertPath)
+}
+
+// TrustAnchors returns the CA certificates configured for the profile
+func (w *Workspace) TrustAnchors() (*x509.CertPool, error) {
+	config, err := w.LoadConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	if config.TrustAnchors == "" {
+		return nil, fmt.Errorf("no trust anchors configured, set trust_anchors in %s or run 'secm init --trust-anchors'", ConfigFile)
+	}
+
+	return id.LoadCertPoolFile(config.TrustAnchors)
+}
+
+// VerifyRecipient validates the certificate chain of a recipient against the trust
+// anchors of the profile, see id.VerifyRecipientCertificate. It returns the public
+// key to wrap data keys for and the subject of the certificate.
+func (w *Workspace) VerifyRecipient(chain []*x509.Certificate) (id.PublicKey, string, error) {
+	roots, err := w.TrustAnchors()
+	if err != nil {
+		return nil, "", err
+	}
+
+	pub, err := id.VerifyRecipientCertificate(chain, roots)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return pub, chain[0].Subject.String(), nil
+}
@@ -0,0 +1,76 @@
+package workspace
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/open-zhy/secm/pkg/crypto"
+	"gopkg.in/yaml.v3"
+)
+
+// ConfigFile holds the settings of the profile
+const ConfigFile = "config.yml"
+
+// Config is the per-profile configuration, missing fields take their default
+type Config struct {
+	// Cipher is the payload cipher of new secrets, see crypto.ParseCipher
+	Cipher string `yaml:"cipher,omitempty"`
+	// TrustAnchors is the PEM bundle of CA certificates recipient certificates
+	// must chain up to
+	TrustAnchors string `yaml:"trust_anchors,omitempty"`
+	// MaxVersions is the number of versions of a secret kept by updates, the
+	// current one included, see DefaultMaxVersions
+	MaxVersions int `yaml:"max_versions,omitempty"`
+}
+
+// LoadConfig reads the profile configuration, a missing file is an empty configuration
+func (w *Workspace) LoadConfig() (*Config, error) {
+	data, err := os.ReadFile(filepath.Join(w.RootDir, ConfigFile))
+	if os.IsNotExist(err) {
+		return &Config{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config: %w", err)
+	}
+
+	var config Config
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("failed to parse config: %w", err)
+	}
+
+	return &config, nil
+}
+
+// SaveConfig writes the profile configuration
+func (w *Workspace) SaveConfig(config *Config) error {
+	data, err := yaml.Marshal(config)
+	if err != nil {
+		return fmt.Errorf("failed to marshal config: %w", err)
+	}
+
+	if err := writeFileAtomic(filepath.Join(w.RootDir, ConfigFile), data, 0600); err != nil {
+		return fmt.Errorf("failed to write config: %w", err)
+	}
+
+	return nil
+}
+
+// DefaultCipher returns the payload cipher of new secrets of the profile
+func (w *Workspace) DefaultCipher() (crypto.Cipher, error) {
+	config, err := w.LoadConfig()
+	if err != nil {
+		return 0, err
+	}
+
+	if config.Cipher == "" {
+		return crypto.DefaultCipher, nil
+	}
+
+	c, err := crypto.ParseCipher(config.Cipher)
+	if err != nil {
+		return 0, fmt.Errorf("invalid cipher in %s: %w", ConfigFile, err)
+	}
+
+	return c, nil
+}
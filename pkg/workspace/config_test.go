@@ -0,0 +1,69 @@
+package workspace
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/open-zhy/secm/pkg/crypto"
+	"github.com/open-zhy/secm/pkg/id"
+	"github.com/open-zhy/secm/pkg/secret"
+)
+
+func TestSecretCipher(t *testing.T) {
+	ws := newTestWorkspace(t, generateIdentity(t, "ec25519"))
+	pub, err := ws.LoadPublicKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if c, err := ws.DefaultCipher(); err != nil || c != crypto.DefaultCipher {
+		t.Fatalf("DefaultCipher without profile config: %s, %v", c, err)
+	}
+
+	secrets := map[string]crypto.Cipher{}
+	for _, c := range crypto.Ciphers {
+		// the cipher of the profile is the one `secm create` picks without --cipher
+		if err := ws.SaveConfig(&Config{Cipher: c.String()}); err != nil {
+			t.Fatal(err)
+		}
+		profileCipher, err := ws.DefaultCipher()
+		if err != nil || profileCipher != c {
+			t.Fatalf("DefaultCipher: got %s, %v, want %s", profileCipher, err, c)
+		}
+
+		s := secret.New(c.String(), nil)
+		secrets[storeTestSecretTo(t, ws, s, []byte(c.String()), profileCipher, pub)] = c
+	}
+
+	// each secret keeps its cipher whatever the profile default became, updates included
+	for secretID, c := range secrets {
+		s := loadTestSecret(t, ws, secretID)
+		if got, err := ws.SecretCipher(s); err != nil || got != c {
+			t.Fatalf("SecretCipher: got %s, %v, want %s", got, err, c)
+		}
+
+		pruned, err := ws.UpdateSecret(secretID, s, bytes.NewReader([]byte("updated")), c, []id.Encrypter{pub})
+		if err != nil {
+			t.Fatalf("UpdateSecret: %v", err)
+		}
+		saveTestVersion(t, ws, secretID, s, pruned)
+		for _, v := range s.Versions() {
+			view, err := s.AtVersion(v.Number)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, err := ws.SecretCipher(view); err != nil || got != c {
+				t.Fatalf("SecretCipher of version %d: got %s, %v, want %s", v.Number, got, err, c)
+			}
+		}
+		checkContent(t, ws, secretID, s, 1, c.String())
+		checkContent(t, ws, secretID, s, 2, "updated")
+	}
+
+	if err := ws.SaveConfig(&Config{Cipher: "aes-128-cbc"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ws.DefaultCipher(); err == nil {
+		t.Fatal("DefaultCipher accepted an unsupported cipher")
+	}
+}
@@ -0,0 +1,109 @@
+package workspace
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/open-zhy/secm/pkg/crypto"
+	"github.com/open-zhy/secm/pkg/id"
+)
+
+// dedupKeyAD binds the dedup key file to its purpose
+const dedupKeyAD = "secm-dedup-key-v1"
+
+// ContentMAC returns the HMAC-SHA256 of the content read from src, keyed with the
+// dedup key of the workspace: only the owner of the identity can tell that two
+// secrets hold the same content or confirm a guess of it
+func (w *Workspace) ContentMAC(src io.Reader) (string, error) {
+	key, err := w.loadDedupKey()
+	if err != nil {
+		return "", err
+	}
+	defer key.Destroy()
+
+	mac := hmac.New(sha256.New, key.Bytes())
+	if _, err := io.Copy(mac, src); err != nil {
+		return "", fmt.Errorf("failed to read content: %w", err)
+	}
+
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+// loadDedupKey decrypts the dedup key of the workspace, a random key encrypted
+// to the identity like a secret, it is created on first use
+func (w *Workspace) loadDedupKey() (*crypto.SecureBuffer, error) {
+	data, err := os.ReadFile(w.DedupKeyPath)
+	if os.IsNotExist(err) {
+		return w.createDedupKey()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read dedup key: %w", err)
+	}
+
+	decrypter, err := w.LoadDecrypter()
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := crypto.DecryptData(decrypter, data, []byte(dedupKeyAD))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt dedup key: %w", err)
+	}
+
+	return key, nil
+}
+
+func (w *Workspace) createDedupKey() (*crypto.SecureBuffer, error) {
+	pub, err := w.LoadPublicKey()
+	if err != nil {
+		return nil, err
+	}
+
+	key := crypto.NewSecureBuffer(sha256.Size)
+	if _, err := io.CopyN(key, rand.Reader, sha256.Size); err != nil {
+		key.Destroy()
+		return nil, fmt.Errorf("failed to generate dedup key: %w", err)
+	}
+
+	encrypted, err := crypto.EncryptData(pub, key.Bytes(), []byte(dedupKeyAD))
+	if err == nil {
+		err = writeFileAtomic(w.DedupKeyPath, encrypted, 0600)
+	}
+	if err != nil {
+		key.Destroy()
+		return nil, fmt.Errorf("failed to save dedup key: %w", err)
+	}
+
+	return key, nil
+}
+
+// StageDedupKey encrypts the dedup key of the workspace for the recipient into
+// the rotation directory, so that content MACs keep matching after the rotation
+func (r *Rotation) StageDedupKey(from id.Decrypter, to id.Encrypter) error {
+	data, err := os.ReadFile(r.ws.DedupKeyPath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read dedup key: %w", err)
+	}
+
+	key, err := crypto.DecryptData(from, data, []byte(dedupKeyAD))
+	if err != nil {
+		return fmt.Errorf("failed to decrypt dedup key: %w", err)
+	}
+	defer key.Destroy()
+
+	encrypted, err := crypto.EncryptData(to, key.Bytes(), []byte(dedupKeyAD))
+	if err != nil {
+		return fmt.Errorf("failed to encrypt dedup key: %w", err)
+	}
+
+	return writeFileAtomic(filepath.Join(r.dir, DedupKey), encrypted, 0600)
+}
@@ -0,0 +1,52 @@
+package workspace
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestContentMAC(t *testing.T) {
+	ws := newTestWorkspace(t, generateIdentity(t, "ec25519"))
+	content := []byte("same content")
+
+	first, err := ws.ContentMAC(bytes.NewReader(content))
+	if err != nil {
+		t.Fatalf("ContentMAC: %v", err)
+	}
+	// the dedup key created by the first call is reused
+	again, err := ws.ContentMAC(bytes.NewReader(content))
+	if err != nil {
+		t.Fatalf("ContentMAC: %v", err)
+	}
+	if first != again {
+		t.Fatal("content MAC of the same content changed")
+	}
+
+	other, err := ws.ContentMAC(bytes.NewReader([]byte("other content")))
+	if err != nil {
+		t.Fatalf("ContentMAC: %v", err)
+	}
+	if other == first {
+		t.Fatal("different contents have the same MAC")
+	}
+}
+
+func TestContentMACAcrossWorkspaces(t *testing.T) {
+	content := []byte("same content")
+
+	// even with the same identity, each workspace draws its own dedup key: a MAC
+	// seen elsewhere tells nothing about the content
+	identity := generateIdentity(t, "ec25519")
+	var macs []string
+	for range 2 {
+		ws := newTestWorkspace(t, identity)
+		mac, err := ws.ContentMAC(bytes.NewReader(content))
+		if err != nil {
+			t.Fatalf("ContentMAC: %v", err)
+		}
+		macs = append(macs, mac)
+	}
+	if macs[0] == macs[1] {
+		t.Fatal("content MAC matches across workspaces")
+	}
+}
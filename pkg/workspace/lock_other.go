@@ -0,0 +1,11 @@
+//go:build !unix && !windows
+
+package workspace
+
+import "os"
+
+// tryLock opens the file at path, file locks are not supported: concurrent
+// rotations and writes are only detected by the rotation directory
+func tryLock(path string, exclusive bool) (*os.File, error) {
+	return os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+}
@@ -0,0 +1,63 @@
+package workspace
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/open-zhy/secm/pkg/crypto"
+	"github.com/open-zhy/secm/pkg/id"
+	"github.com/open-zhy/secm/pkg/secret"
+)
+
+// setTestPassphrase makes passphrase secrets decrypt with the passphrase
+func setTestPassphrase(t *testing.T, passphrase string) {
+	t.Helper()
+	SetSecretPassphraseReader(func(string) ([]byte, error) {
+		return []byte(passphrase), nil
+	})
+	t.Cleanup(func() {
+		SetSecretPassphraseReader(func(string) ([]byte, error) { return nil, id.ErrPassphraseRequired })
+	})
+}
+
+func TestPassphraseSecret(t *testing.T) {
+	if testing.Short() {
+		t.Skip("derives the keys of passphrase secrets, about a second each")
+	}
+	ws := newTestWorkspace(t, generateIdentity(t, "ec25519"))
+	recipient, err := id.NewScryptRecipient([]byte("correct horse"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := secret.New("contractor", nil)
+	secretID := storeTestSecretTo(t, ws, s, []byte("handed out"), crypto.DefaultCipher, recipient)
+
+	if protected, err := ws.IsPassphraseSecret(s); err != nil || !protected {
+		t.Fatalf("IsPassphraseSecret: %v, %v", protected, err)
+	}
+
+	// the identity of the workspace does not open it
+	if _, err := ws.DecryptSecret(secretID, s); !errors.Is(err, id.ErrPassphraseRequired) {
+		t.Fatalf("DecryptSecret without passphrase: got %v, want ErrPassphraseRequired", err)
+	}
+
+	setTestPassphrase(t, "battery staple")
+	if _, err := ws.DecryptSecret(secretID, s); !errors.Is(err, id.ErrIncorrectPassphrase) {
+		t.Fatalf("DecryptSecret with a wrong passphrase: got %v, want ErrIncorrectPassphrase", err)
+	}
+
+	setTestPassphrase(t, "correct horse")
+	got, err := ws.DecryptSecret(secretID, s)
+	if err != nil {
+		t.Fatalf("DecryptSecret: %v", err)
+	}
+	defer got.Destroy()
+	if !bytes.Equal(got.Bytes(), []byte("handed out")) {
+		t.Fatal("plaintext mismatch")
+	}
+
+	if _, err := ws.Share(s, generateIdentity(t, "ec25519").PublicKey()); err == nil {
+		t.Fatal("Share added a recipient to a passphrase secret")
+	}
+}
@@ -0,0 +1,84 @@
+package workspace
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/open-zhy/secm/pkg/secret"
+)
+
+// ReadsExt is the extension of the read counters of the secrets with a read limit
+const ReadsExt = ".reads"
+
+// readsPath returns the path of the read counter of the secret stored under secretID
+func (w *Workspace) readsPath(secretID string) string {
+	return w.SecretPath(secretID + ReadsExt)
+}
+
+// Reads returns the number of reads of the secret stored under secretID. The count
+// is local to the workspace and kept out of the secret file, so that reading a secret
+// leaves its signature, and the signer it proves, as is.
+func (w *Workspace) Reads(secretID string) (int, error) {
+	data, err := os.ReadFile(w.readsPath(secretID))
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to read read count: %w", err)
+	}
+
+	n, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid read count in %s", w.readsPath(secretID))
+	}
+
+	return n, nil
+}
+
+// CheckPolicy returns an error when the secret stored under secretID cannot be read anymore
+func (w *Workspace) CheckPolicy(secretID string, s *secret.Secret) error {
+	reads, err := w.Reads(secretID)
+	if err != nil {
+		return err
+	}
+
+	return s.CheckPolicy(reads)
+}
+
+// RecordRead counts a read of the secret stored under secretID when its reads are
+// limited. It is called before the content is revealed, so that a read interrupted
+// afterwards is counted all the same, and fails when no read is left. It reports
+// whether this is the last read, the caller then deletes the secret with BurnSecret
+// once the content is out.
+func (w *Workspace) RecordRead(secretID string, s *secret.Secret) (last bool, err error) {
+	if s.MaxReads <= 0 {
+		return false, nil
+	}
+
+	reads, err := w.Reads(secretID)
+	if err != nil {
+		return false, err
+	}
+	if err := s.CheckPolicy(reads); err != nil {
+		return false, err
+	}
+
+	reads++
+	if err := writeFileAtomic(w.readsPath(secretID), []byte(strconv.Itoa(reads)+"\n"), 0600); err != nil {
+		return false, fmt.Errorf("failed to record read: %w", err)
+	}
+
+	return reads >= s.MaxReads, nil
+}
+
+// BurnSecret deletes the secret stored under secretID after its last read, the
+// secret cannot be read anymore even when this fails, see RecordRead
+func (w *Workspace) BurnSecret(secretID string, s *secret.Secret) error {
+	if err := w.RemoveSecret(w.SecretPath(secretID+".yml"), s); err != nil {
+		return fmt.Errorf("failed to delete secret after its last read: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,154 @@
+package workspace
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/open-zhy/secm/pkg/id"
+	"github.com/open-zhy/secm/pkg/secret"
+)
+
+func TestRecordReadKeepsSignature(t *testing.T) {
+	ws := newTestWorkspace(t, generateIdentity(t, "ec25519"))
+	s := secret.New("token", nil)
+	s.MaxReads = 3
+	secretID := storeTestSecret(t, ws, s, []byte("one-time token"))
+
+	// as received from a sender, signed by another key than the workspace one
+	sender, err := id.GenerateSigningKey(id.GenerateSigningKeyOpts{Type: "ed25519"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ws.SignSecret(secretID, s, sender); err != nil {
+		t.Fatal(err)
+	}
+	secretPath := ws.SecretPath(secretID + ".yml")
+	if err := s.Save(secretPath); err != nil {
+		t.Fatal(err)
+	}
+	saved, err := os.ReadFile(secretPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for read := 1; read < s.MaxReads; read++ {
+		if last, err := ws.RecordRead(secretID, s); err != nil || last {
+			t.Fatalf("read %d: last %v, err %v", read, last, err)
+		}
+		if reads, err := ws.Reads(secretID); err != nil || reads != read {
+			t.Fatalf("read %d: Reads returned %d, %v", read, reads, err)
+		}
+	}
+
+	// the secret file is left as is, still proving who sent it
+	if current, err := os.ReadFile(secretPath); err != nil || !bytes.Equal(current, saved) {
+		t.Fatalf("reads rewrote the secret file: %v", err)
+	}
+	if _, err := ws.VerifySecret(secretID, loadTestSecret(t, ws, secretID), sender.VerifyingKey()); err != nil {
+		t.Fatalf("VerifySecret against the sender after reads: %v", err)
+	}
+
+	last, err := ws.RecordRead(secretID, s)
+	if err != nil || !last {
+		t.Fatalf("last read: last %v, err %v", last, err)
+	}
+	if err := ws.BurnSecret(secretID, s); err != nil {
+		t.Fatalf("BurnSecret: %v", err)
+	}
+	for _, path := range []string{secretPath, ws.BlobPath(s.Blob), ws.readsPath(secretID)} {
+		if exists(t, path) {
+			t.Errorf("%s left after the last read", path)
+		}
+	}
+}
+
+func TestRecordReadBeforeReveal(t *testing.T) {
+	ws := newTestWorkspace(t, generateIdentity(t, "ec25519"))
+	s := secret.New("token", nil)
+	s.MaxReads = 1
+	secretID := storeTestSecret(t, ws, s, []byte("one-time token"))
+
+	// the last read is counted, then the command dies before burning the secret
+	if last, err := ws.RecordRead(secretID, s); err != nil || !last {
+		t.Fatalf("RecordRead: last %v, err %v", last, err)
+	}
+
+	if err := ws.CheckPolicy(secretID, s); !errors.Is(err, secret.ErrNoReadsLeft) {
+		t.Fatalf("CheckPolicy after the last read: got %v, want ErrNoReadsLeft", err)
+	}
+	if _, err := ws.RecordRead(secretID, s); !errors.Is(err, secret.ErrNoReadsLeft) {
+		t.Fatalf("RecordRead after the last read: got %v, want ErrNoReadsLeft", err)
+	}
+}
+
+func TestRecordReadUnlimited(t *testing.T) {
+	ws := newTestWorkspace(t, generateIdentity(t, "ec25519"))
+	s := secret.New("password", nil)
+	secretID := storeTestSecret(t, ws, s, []byte("hunter2"))
+
+	for range 3 {
+		if last, err := ws.RecordRead(secretID, s); err != nil || last {
+			t.Fatalf("RecordRead: last %v, err %v", last, err)
+		}
+	}
+	if exists(t, ws.readsPath(secretID)) {
+		t.Fatal("reads of a secret without read limit were counted")
+	}
+}
+
+func TestExpiredSecretRefused(t *testing.T) {
+	ws := newTestWorkspace(t, generateIdentity(t, "ec25519"))
+	s := secret.New("token", nil)
+	s.ExpiresAt = time.Now().Add(-time.Minute)
+	s.MaxReads = 3
+	secretID := storeTestSecret(t, ws, s, []byte("expired token"))
+
+	if err := ws.CheckPolicy(secretID, s); !errors.Is(err, secret.ErrExpired) {
+		t.Fatalf("CheckPolicy: got %v, want ErrExpired", err)
+	}
+	if _, err := ws.RecordRead(secretID, s); !errors.Is(err, secret.ErrExpired) {
+		t.Fatalf("RecordRead: got %v, want ErrExpired", err)
+	}
+	pub, err := ws.LoadPublicKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ws.Grant(pub, secretID, loadTestSecret(t, ws, secretID)); !errors.Is(err, secret.ErrExpired) {
+		t.Fatalf("Grant: got %v, want ErrExpired", err)
+	}
+	if exists(t, ws.readsPath(secretID)) {
+		t.Fatal("read of an expired secret was counted")
+	}
+}
+
+func TestTamperedPolicyFailsVerification(t *testing.T) {
+	ws := newTestWorkspace(t, generateIdentity(t, "ec25519"))
+	signingKey, _, err := ws.EnsureSigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := secret.New("token", nil)
+	s.ExpiresAt = s.CreatedAt.Add(time.Hour)
+	s.MaxReads = 3
+	secretID := storeTestSecret(t, ws, s, []byte("limited token"))
+
+	if _, err := ws.VerifySecret(secretID, loadTestSecret(t, ws, secretID), signingKey.VerifyingKey()); err != nil {
+		t.Fatalf("VerifySecret: %v", err)
+	}
+
+	for name, edit := range map[string]func(s *secret.Secret){
+		"max_reads raised": func(s *secret.Secret) { s.MaxReads = 30 },
+		// without policy, the secret would verify under the signature version not covering it
+		"policy removed":  func(s *secret.Secret) { s.MaxReads, s.ExpiresAt = 0, time.Time{} },
+		"expiry extended": func(s *secret.Secret) { s.ExpiresAt = s.ExpiresAt.Add(24 * time.Hour) },
+	} {
+		tampered := loadTestSecret(t, ws, secretID)
+		edit(tampered)
+		if _, err := ws.VerifySecret(secretID, tampered, signingKey.VerifyingKey()); err == nil {
+			t.Errorf("%s: VerifySecret succeeded", name)
+		}
+	}
+}
@@ -0,0 +1,464 @@
+package workspace
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/open-zhy/secm/pkg/crypto"
+	"github.com/open-zhy/secm/pkg/id"
+	"github.com/open-zhy/secm/pkg/secret"
+)
+
+const (
+	// RotationDir holds the files staged by an identity rotation until it is committed
+	RotationDir = ".rotation"
+	// RetiredDir holds the identity keys replaced by a rotation until they are purged
+	RetiredDir = "retired"
+
+	// rotationLock is held exclusively by the process staging or committing a
+	// rotation and shared by the processes writing secrets, it is kept outside of
+	// the rotation directory which is removed
+	rotationLock = ".rotation.lock"
+
+	rotationJournal = "journal"
+	journalMagic    = "secm-rotation v1"
+)
+
+// A rotation goes through two phases. Every secret is first re-encrypted into the
+// rotation directory along with the new key, the live files are left untouched and
+// an interrupted rotation is simply discarded. Writing the journal commits it, the
+// staged files are then moved over the live ones. The moves are idempotent, so a
+// rotation interrupted after its commit is completed by the next workspace Load.
+// The rotating process holds a lock for the whole rotation, other processes leave
+// the rotation directory alone while it is held. Commands writing secrets share
+// the lock, a secret written during a rotation would be encrypted to the retired
+// key or overwritten by the staged files.
+
+// Rotation is an identity rotation being staged
+type Rotation struct {
+	ws    *Workspace
+	dir   string
+	files []string
+	lock  *os.File
+}
+
+// errLocked is returned by tryLock when another process holds the lock
+var errLocked = errors.New("file is locked by another process")
+
+// RotatedSecret reports what changed on a secret besides its encryption
+type RotatedSecret struct {
+	// OtherRecipients is the number of recipients the secret was shared with,
+	// they lose access and have to be granted it again
+	OtherRecipients int
+	// ForeignSigner is set when the secret was signed by another key than the
+	// one signing it again
+	ForeignSigner bool
+}
+
+// BeginRotation takes the rotation lock and creates the rotation directory, it
+// fails when another rotation is in progress
+func (w *Workspace) BeginRotation() (*Rotation, error) {
+	lock, err := tryLock(filepath.Join(w.RootDir, rotationLock), true)
+	if err != nil {
+		if errors.Is(err, errLocked) {
+			return nil, fmt.Errorf("another rotation or a write to the workspace is in progress")
+		}
+		return nil, fmt.Errorf("failed to lock the workspace for rotation: %w", err)
+	}
+
+	dir := filepath.Join(w.RootDir, RotationDir)
+	if err := os.Mkdir(dir, 0700); err != nil {
+		lock.Close()
+		if os.IsExist(err) {
+			return nil, fmt.Errorf("another rotation is in progress, %s exists", dir)
+		}
+		return nil, fmt.Errorf("failed to create rotation directory: %w", err)
+	}
+
+	return &Rotation{ws: w, dir: dir, lock: lock}, nil
+}
+
+// LockWrites shares the rotation lock for a command writing secrets, it fails
+// while a rotation is in progress and keeps one from starting until the returned
+// lock is closed
+func (w *Workspace) LockWrites() (io.Closer, error) {
+	lock, err := tryLock(filepath.Join(w.RootDir, rotationLock), false)
+	if err != nil {
+		if errors.Is(err, errLocked) {
+			return nil, fmt.Errorf("an identity rotation is in progress, try again once it is done")
+		}
+		return nil, fmt.Errorf("failed to lock the workspace: %w", err)
+	}
+
+	// also covers the platforms without file locks
+	if _, err := os.Stat(filepath.Join(w.RootDir, RotationDir)); !os.IsNotExist(err) {
+		lock.Close()
+		return nil, fmt.Errorf("an identity rotation is in progress, try again once it is done")
+	}
+
+	return lock, nil
+}
+
+// Abort discards everything staged by the rotation and releases its lock
+func (r *Rotation) Abort() error {
+	defer r.lock.Close()
+	return os.RemoveAll(r.dir)
+}
+
+// Stage re-encrypts every version of the secret stored under secretID with a new
+// data key for the recipient and signs it again with signer, the result is written
+// to the rotation directory. The cipher of the secret is kept, secrets stored inline
+// are detached on the way.
+func (r *Rotation) Stage(secretID string, s *secret.Secret, from id.KeyPackageIdentity, to id.Encrypter, signer id.SigningKey) (*RotatedSecret, error) {
+	rotated := &RotatedSecret{}
+
+	recipients, err := r.ws.CountRecipients(s)
+	if err != nil {
+		return nil, err
+	}
+	if recipients > 1 {
+		rotated.OtherRecipients = recipients - 1
+	}
+
+	if s.Signature != nil {
+		if _, err := r.ws.VerifySecret(secretID, s, signer.VerifyingKey()); err != nil {
+			rotated.ForeignSigner = true
+		}
+	}
+
+	// every version is re-encrypted, the history stays readable with the new key
+	for _, v := range s.Versions() {
+		view, err := s.AtVersion(v.Number)
+		if err != nil {
+			return nil, err
+		}
+		if err := r.stageVersion(secretID, view, from, to, signer); err != nil {
+			return nil, err
+		}
+		s.SetVersion(v.Number, view)
+	}
+
+	name := secretID + ".yml"
+	if err := s.Save(filepath.Join(r.dir, name)); err != nil {
+		return nil, err
+	}
+	r.files = append(r.files, name)
+
+	return rotated, nil
+}
+
+// stageVersion re-encrypts the content of the secret into the rotation directory
+// and signs it, s is a single version as returned by AtVersion
+func (r *Rotation) stageVersion(secretID string, s *secret.Secret, from id.KeyPackageIdentity, to id.Encrypter, signer id.SigningKey) error {
+	c, err := r.ws.SecretCipher(s)
+	if err != nil {
+		return err
+	}
+
+	ad, err := s.AssociatedData(secretID)
+	if err != nil {
+		return err
+	}
+
+	src, err := r.ws.OpenCiphertext(s)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	plaintext, err := crypto.NewDecryptReader(src, from, ad)
+	if err != nil {
+		return fmt.Errorf("failed to decrypt secret: %w", err)
+	}
+	defer plaintext.Close()
+
+	binding := s.Binding
+	s.Binding = secret.CurrentBinding
+	if ad, err = s.AssociatedData(secretID); err != nil {
+		return err
+	}
+
+	s.Data = ""
+	if s.Blob == "" {
+		s.Blob = BlobName(secretID, s.CurrentVersion())
+	}
+	blob := filepath.Base(s.Blob)
+
+	f, err := os.OpenFile(filepath.Join(r.dir, blob), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to create staging file: %w", err)
+	}
+	r.files = append(r.files, blob)
+
+	_, err = encryptTo(f, plaintext, c, []id.Encrypter{to}, ad)
+	if closeErr := f.Close(); err == nil && closeErr != nil {
+		err = fmt.Errorf("failed to write staging file: %w", closeErr)
+	}
+	if err != nil {
+		if errors.Is(err, crypto.ErrAuthentication) && binding != secret.BindingNone {
+			return fmt.Errorf("secret does not match its ciphertext, its ID or metadata may have been tampered with: %w", err)
+		}
+		return err
+	}
+
+	digest, err := fileDigest(filepath.Join(r.dir, blob))
+	if err != nil {
+		return err
+	}
+
+	return r.ws.signDigest(secretID, s, signer, digest)
+}
+
+// Commit stages the new identity key, records the rotation in the journal and
+// moves the staged files over the live ones. The replaced key is archived in the
+// retired keys directory, the returned path points to it. The lock of the rotation
+// is released, a rotation failing after its commit is completed by the next Load.
+func (r *Rotation) Commit(identity id.KeyPackageIdentity, passphrase []byte) (string, error) {
+	defer r.lock.Close()
+
+	if err := saveKey(filepath.Join(r.dir, IdentityKey), filepath.Join(r.dir, IdentityPub), identity, passphrase); err != nil {
+		return "", err
+	}
+
+	old, err := r.ws.LoadPublicKey()
+	if err != nil {
+		return "", err
+	}
+	hint := id.KeyHint(old)
+	retired := time.Now().UTC().Format("20060102T150405Z") + "-" + hex.EncodeToString(hint[:])
+
+	var journal bytes.Buffer
+	fmt.Fprintln(&journal, journalMagic)
+	fmt.Fprintf(&journal, "retired %s\n", retired)
+	for _, name := range r.files {
+		fmt.Fprintf(&journal, "file %s\n", name)
+	}
+
+	if err := writeFileAtomic(filepath.Join(r.dir, rotationJournal), journal.Bytes(), 0600); err != nil {
+		return "", fmt.Errorf("failed to write rotation journal: %w", err)
+	}
+
+	if err := r.ws.applyRotation(); err != nil {
+		return "", err
+	}
+
+	return filepath.Join(r.ws.RootDir, RetiredDir, retired+".key"), nil
+}
+
+// RecoverRotation completes a committed rotation which was interrupted, or
+// discards the files staged by one which was not committed. A rotation still
+// running in another process is left alone.
+func (w *Workspace) RecoverRotation() error {
+	dir := filepath.Join(w.RootDir, RotationDir)
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		return nil
+	}
+
+	lock, err := tryLock(filepath.Join(w.RootDir, rotationLock), true)
+	if errors.Is(err, errLocked) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to lock the workspace for rotation: %w", err)
+	}
+	defer lock.Close()
+
+	// completed by the process which held the lock meanwhile
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		return nil
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, rotationJournal)); os.IsNotExist(err) {
+		return os.RemoveAll(dir)
+	}
+
+	return w.applyRotation()
+}
+
+// applyRotation replays the journal of a committed rotation
+func (w *Workspace) applyRotation() error {
+	dir := filepath.Join(w.RootDir, RotationDir)
+
+	f, err := os.Open(filepath.Join(dir, rotationJournal))
+	if err != nil {
+		return fmt.Errorf("failed to open rotation journal: %w", err)
+	}
+	defer f.Close()
+
+	var retired string
+	var files []string
+	scanner := bufio.NewScanner(f)
+	for line := 0; scanner.Scan(); line++ {
+		text := scanner.Text()
+		if line == 0 {
+			if text != journalMagic {
+				return fmt.Errorf("invalid rotation journal")
+			}
+			continue
+		}
+
+		kind, value, ok := strings.Cut(text, " ")
+		if !ok || value != filepath.Base(value) {
+			return fmt.Errorf("invalid rotation journal entry: %q", text)
+		}
+
+		switch kind {
+		case "retired":
+			retired = value
+		case "file":
+			files = append(files, value)
+		default:
+			return fmt.Errorf("invalid rotation journal entry: %q", text)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read rotation journal: %w", err)
+	}
+	if retired == "" {
+		return fmt.Errorf("invalid rotation journal: retired key missing")
+	}
+
+	// the old key is archived before anything is moved, the archive is written
+	// atomically and never overwritten, so replaying cannot archive the new key
+	if err := w.retireKey(retired); err != nil {
+		return err
+	}
+
+	for _, name := range files {
+		if err := renameStaged(filepath.Join(dir, name), w.SecretPath(name)); err != nil {
+			return err
+		}
+	}
+
+	if err := renameStaged(filepath.Join(dir, DedupKey), w.DedupKeyPath); err != nil {
+		return err
+	}
+	if err := renameStaged(filepath.Join(dir, IdentityPub), w.PublicKeyPath); err != nil {
+		return err
+	}
+	if err := renameStaged(filepath.Join(dir, IdentityKey), w.KeyPath); err != nil {
+		return err
+	}
+	// the certificate was issued for the retired key
+	if err := os.Remove(w.CertPath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove identity certificate: %w", err)
+	}
+
+	f.Close()
+	if err := os.RemoveAll(dir); err != nil {
+		return fmt.Errorf("failed to remove rotation directory: %w", err)
+	}
+
+	return nil
+}
+
+// retireKey copies the identity key, its public key and certificate to the retired
+// keys directory
+func (w *Workspace) retireKey(name string) error {
+	retiredDir := filepath.Join(w.RootDir, RetiredDir)
+	keyPath := filepath.Join(retiredDir, name+".key")
+	if _, err := os.Stat(keyPath); err == nil {
+		return nil
+	}
+
+	if err := os.MkdirAll(retiredDir, 0700); err != nil {
+		return fmt.Errorf("failed to create retired keys directory: %w", err)
+	}
+
+	if pub, err := os.ReadFile(w.PublicKeyPath); err == nil {
+		if err := writeFileAtomic(filepath.Join(retiredDir, name+".pub"), pub, 0644); err != nil {
+			return fmt.Errorf("failed to retire public key: %w", err)
+		}
+	}
+
+	if cert, err := os.ReadFile(w.CertPath); err == nil {
+		if err := writeFileAtomic(filepath.Join(retiredDir, name+".crt"), cert, 0644); err != nil {
+			return fmt.Errorf("failed to retire identity certificate: %w", err)
+		}
+	}
+
+	key, err := os.ReadFile(w.KeyPath)
+	if err != nil {
+		return fmt.Errorf("failed to read identity key: %w", err)
+	}
+	defer clear(key)
+
+	if err := writeFileAtomic(keyPath, key, 0600); err != nil {
+		return fmt.Errorf("failed to retire identity key: %w", err)
+	}
+
+	return nil
+}
+
+// RetiredKeys returns the paths of the identity keys archived by rotations
+func (w *Workspace) RetiredKeys() ([]string, error) {
+	entries, err := os.ReadDir(filepath.Join(w.RootDir, RetiredDir))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read retired keys directory: %w", err)
+	}
+
+	var keys []string
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".key") {
+			keys = append(keys, filepath.Join(w.RootDir, RetiredDir, entry.Name()))
+		}
+	}
+
+	return keys, nil
+}
+
+// PurgeRetiredKeys deletes the retired keys directory
+func (w *Workspace) PurgeRetiredKeys() error {
+	if err := os.RemoveAll(filepath.Join(w.RootDir, RetiredDir)); err != nil {
+		return fmt.Errorf("failed to delete retired keys: %w", err)
+	}
+	return nil
+}
+
+// CountRecipients returns the number of stanzas of the secret envelope,
+// legacy data without header has a single recipient
+func (w *Workspace) CountRecipients(s *secret.Secret) (int, error) {
+	header, err := w.readHeader(s)
+	if err != nil || header == nil {
+		return 1, err
+	}
+
+	return len(header.Stanzas), nil
+}
+
+// renameStaged moves a staged file over its destination, a missing staged
+// file was already moved by a previous attempt
+func renameStaged(src, dst string) error {
+	if err := os.Rename(src, dst); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to move %s: %w", filepath.Base(src), err)
+	}
+	return nil
+}
+
+// fileDigest returns the SHA-256 of the file content
+func fileDigest(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open staging file: %w", err)
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return nil, fmt.Errorf("failed to read staging file: %w", err)
+	}
+
+	return h.Sum(nil), nil
+}
@@ -0,0 +1,171 @@
+package workspace
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRecoverRotationSkipsLockedRotation(t *testing.T) {
+	ws := newWorkspace(t.TempDir())
+
+	rotation, err := ws.BeginRotation()
+	if err != nil {
+		t.Fatalf("BeginRotation: %v", err)
+	}
+	staged := filepath.Join(rotation.dir, "staged.yml")
+	if err := os.WriteFile(staged, []byte("staged"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// another command loading the workspace meanwhile
+	if err := ws.RecoverRotation(); err != nil {
+		t.Fatalf("RecoverRotation: %v", err)
+	}
+	if _, err := os.Stat(staged); err != nil {
+		t.Fatalf("staged file of a running rotation was removed: %v", err)
+	}
+
+	if _, err := ws.BeginRotation(); err == nil {
+		t.Fatal("BeginRotation succeeded while another rotation holds the lock")
+	}
+
+	if err := rotation.Abort(); err != nil {
+		t.Fatalf("Abort: %v", err)
+	}
+	if _, err := os.Stat(rotation.dir); !os.IsNotExist(err) {
+		t.Fatalf("rotation directory left after Abort: %v", err)
+	}
+}
+
+func TestRecoverRotationDiscardsUncommitted(t *testing.T) {
+	ws := newWorkspace(t.TempDir())
+
+	// left behind by a rotation which died before its commit
+	dir := filepath.Join(ws.RootDir, RotationDir)
+	if err := os.Mkdir(dir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "staged.yml"), []byte("staged"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ws.RecoverRotation(); err != nil {
+		t.Fatalf("RecoverRotation: %v", err)
+	}
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Fatalf("uncommitted rotation was not discarded: %v", err)
+	}
+
+	// the lock is free again
+	rotation, err := ws.BeginRotation()
+	if err != nil {
+		t.Fatalf("BeginRotation: %v", err)
+	}
+	rotation.Abort()
+}
+
+func TestRecoverRotationCompletesCommitted(t *testing.T) {
+	ws := newWorkspace(t.TempDir())
+	if err := os.Mkdir(ws.SecretsDir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	for path, content := range map[string]string{
+		ws.KeyPath:             "old key",
+		ws.PublicKeyPath:       "old pub",
+		ws.SecretPath("a.yml"): "old secret",
+	} {
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// a rotation which died after writing its journal
+	dir := filepath.Join(ws.RootDir, RotationDir)
+	if err := os.Mkdir(dir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range map[string]string{
+		IdentityKey:     "new key",
+		IdentityPub:     "new pub",
+		"a.yml":         "new secret",
+		rotationJournal: journalMagic + "\nretired 20250101T000000Z-00\nfile a.yml\n",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := ws.RecoverRotation(); err != nil {
+		t.Fatalf("RecoverRotation: %v", err)
+	}
+
+	for path, want := range map[string]string{
+		ws.KeyPath:             "new key",
+		ws.PublicKeyPath:       "new pub",
+		ws.SecretPath("a.yml"): "new secret",
+		filepath.Join(ws.RootDir, RetiredDir, "20250101T000000Z-00.key"): "old key",
+	} {
+		got, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != want {
+			t.Errorf("%s = %q, want %q", filepath.Base(path), got, want)
+		}
+	}
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Fatalf("rotation directory left after recovery: %v", err)
+	}
+}
+
+func TestLockWritesDuringRotation(t *testing.T) {
+	ws := newWorkspace(t.TempDir())
+
+	rotation, err := ws.BeginRotation()
+	if err != nil {
+		t.Fatalf("BeginRotation: %v", err)
+	}
+	if _, err := ws.LockWrites(); err == nil {
+		t.Fatal("LockWrites succeeded while a rotation is in progress")
+	}
+	if err := rotation.Abort(); err != nil {
+		t.Fatalf("Abort: %v", err)
+	}
+
+	// writers share the lock, a rotation waits for all of them
+	first, err := ws.LockWrites()
+	if err != nil {
+		t.Fatalf("LockWrites: %v", err)
+	}
+	second, err := ws.LockWrites()
+	if err != nil {
+		t.Fatalf("LockWrites while another write is in progress: %v", err)
+	}
+	if _, err := ws.BeginRotation(); err == nil {
+		t.Fatal("BeginRotation succeeded while a write is in progress")
+	}
+	first.Close()
+	if _, err := ws.BeginRotation(); err == nil {
+		t.Fatal("BeginRotation succeeded while a write is in progress")
+	}
+	second.Close()
+
+	rotation, err = ws.BeginRotation()
+	if err != nil {
+		t.Fatalf("BeginRotation after the writes: %v", err)
+	}
+	rotation.Abort()
+}
+
+func TestLockWritesInterruptedRotation(t *testing.T) {
+	ws := newWorkspace(t.TempDir())
+
+	// a rotation directory without holder, left for the next Load to recover
+	if err := os.Mkdir(filepath.Join(ws.RootDir, RotationDir), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ws.LockWrites(); err == nil {
+		t.Fatal("LockWrites succeeded with a rotation directory")
+	}
+}
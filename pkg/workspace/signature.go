@@ -0,0 +1,187 @@
+package workspace
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/open-zhy/secm/pkg/id"
+	"github.com/open-zhy/secm/pkg/secret"
+)
+
+// CreateSigningKey generates the signing key of the workspace, an existing
+// key is never overwritten
+func (w *Workspace) CreateSigningKey(keyType string) (id.SigningKey, error) {
+	key, err := id.GenerateSigningKey(id.GenerateSigningKeyOpts{Type: keyType})
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate signing key: %w", err)
+	}
+
+	if err := w.SaveSigningKey(key); err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
+
+// SaveSigningKey writes the signing key of the workspace, never over an existing
+// one. It is stored unencrypted: secrets are signed without prompting, by commands
+// which do not need the identity key either.
+func (w *Workspace) SaveSigningKey(key id.SigningKey) error {
+	keyFile, err := os.OpenFile(w.SigningKeyPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to create signing key file: %w", err)
+	}
+	defer keyFile.Close()
+
+	if err := key.Encode(keyFile); err != nil {
+		return fmt.Errorf("failed to write signing key file: %w", err)
+	}
+
+	return nil
+}
+
+// LoadSigningKey loads the signing key of the workspace
+func (w *Workspace) LoadSigningKey() (id.SigningKey, error) {
+	key, err := id.LoadSigningKeyFile(w.SigningKeyPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load signing key: %w", err)
+	}
+	return key, nil
+}
+
+// HasSigningKey reports whether the workspace already has a signing key
+func (w *Workspace) HasSigningKey() bool {
+	_, err := os.Stat(w.SigningKeyPath)
+	return err == nil
+}
+
+// EnsureSigningKey loads the signing key of the workspace, an ed25519 key is
+// created for workspaces initialized before signing keys existed
+func (w *Workspace) EnsureSigningKey() (key id.SigningKey, created bool, err error) {
+	if w.HasSigningKey() {
+		key, err = w.LoadSigningKey()
+		return key, false, err
+	}
+
+	key, err = w.CreateSigningKey("ed25519")
+	return key, err == nil, err
+}
+
+// CiphertextDigest returns the SHA-256 of the encrypted data of the secret
+func (w *Workspace) CiphertextDigest(s *secret.Secret) ([]byte, error) {
+	src, err := w.OpenCiphertext(s)
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, src); err != nil {
+		return nil, fmt.Errorf("failed to read secret data: %w", err)
+	}
+
+	return h.Sum(nil), nil
+}
+
+// SignSecret attaches a detached signature over the ciphertext and metadata
+// of the secret stored under secretID
+func (w *Workspace) SignSecret(secretID string, s *secret.Secret, key id.SigningKey) error {
+	ciphertextDigest, err := w.CiphertextDigest(s)
+	if err != nil {
+		return err
+	}
+
+	return w.signDigest(secretID, s, key, ciphertextDigest)
+}
+
+// SignVersions signs every version of the secret stored under secretID again,
+// their signatures cover the metadata
+func (w *Workspace) SignVersions(secretID string, s *secret.Secret, key id.SigningKey) error {
+	for _, v := range s.Versions() {
+		view, err := s.AtVersion(v.Number)
+		if err != nil {
+			return err
+		}
+		if err := w.SignSecret(secretID, view, key); err != nil {
+			return err
+		}
+		s.SetVersion(v.Number, view)
+	}
+
+	return nil
+}
+
+// signDigest signs the secret given the SHA-256 of its encrypted data
+func (w *Workspace) signDigest(secretID string, s *secret.Secret, key id.SigningKey, ciphertextDigest []byte) error {
+	version := s.SignatureVersion()
+	digest, err := s.SignedDigest(secretID, version, ciphertextDigest)
+	if err != nil {
+		return err
+	}
+
+	value, err := key.Sign(digest)
+	if err != nil {
+		return fmt.Errorf("failed to sign secret: %w", err)
+	}
+
+	verifying := key.VerifyingKey()
+	s.Signature = &secret.Signature{
+		Version:   version,
+		Algorithm: verifying.Algorithm(),
+		Signer:    base64.StdEncoding.EncodeToString(verifying.Bytes()),
+		Value:     base64.StdEncoding.EncodeToString(value),
+	}
+
+	return nil
+}
+
+// VerifySecret checks the signature of the secret stored under secretID and returns
+// the key which produced it. When trusted is not nil, the signature must have been
+// produced by this key.
+func (w *Workspace) VerifySecret(secretID string, s *secret.Secret, trusted id.VerifyingKey) (id.VerifyingKey, error) {
+	if s.Signature == nil {
+		return nil, fmt.Errorf("secret is not signed")
+	}
+
+	signerBytes, err := base64.StdEncoding.DecodeString(s.Signature.Signer)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode signer key: %w", err)
+	}
+
+	signer, err := id.ParseVerifyingKey(signerBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	if signer.Algorithm() != s.Signature.Algorithm {
+		return nil, fmt.Errorf("signature algorithm %s does not match signer key", s.Signature.Algorithm)
+	}
+
+	if trusted != nil && !id.SameVerifyingKey(trusted, signer) {
+		return nil, fmt.Errorf("secret is not signed by the expected key")
+	}
+
+	value, err := base64.StdEncoding.DecodeString(s.Signature.Value)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode signature: %w", err)
+	}
+
+	ciphertextDigest, err := w.CiphertextDigest(s)
+	if err != nil {
+		return nil, err
+	}
+
+	digest, err := s.SignedDigest(secretID, s.Signature.Version, ciphertextDigest)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := signer.Verify(digest, value); err != nil {
+		return nil, fmt.Errorf("signature verification failed: %w", err)
+	}
+
+	return signer, nil
+}
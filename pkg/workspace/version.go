@@ -0,0 +1,142 @@
+package workspace
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/open-zhy/secm/pkg/crypto"
+	"github.com/open-zhy/secm/pkg/id"
+	"github.com/open-zhy/secm/pkg/secret"
+)
+
+// DefaultMaxVersions is the number of versions of a secret kept when the profile
+// does not set max_versions
+const DefaultMaxVersions = 10
+
+// BlobName returns the name of the detached ciphertext of version n of a secret
+func BlobName(secretID string, n int) string {
+	if n <= 1 {
+		return secretID + BlobExt
+	}
+	return fmt.Sprintf("%s.v%d%s", secretID, n, BlobExt)
+}
+
+// MaxVersions returns the number of versions of a secret kept by the profile,
+// the current one included
+func (w *Workspace) MaxVersions() (int, error) {
+	config, err := w.LoadConfig()
+	if err != nil {
+		return 0, err
+	}
+
+	switch {
+	case config.MaxVersions == 0:
+		return DefaultMaxVersions, nil
+	case config.MaxVersions < 0:
+		return 0, fmt.Errorf("invalid max_versions in %s: %d", ConfigFile, config.MaxVersions)
+	default:
+		return config.MaxVersions, nil
+	}
+}
+
+// UpdateSecret encrypts src with the cipher for the recipients as the new current
+// version of the secret stored under secretID, the previous one is kept in its
+// history. It returns the versions dropped by the retention limit, see addVersion.
+func (w *Workspace) UpdateSecret(secretID string, s *secret.Secret, src io.Reader, c crypto.Cipher, recipients []id.Encrypter) ([]secret.Version, error) {
+	// the new version is bound with the current binding, the previous one keeps its own
+	next := *s
+	next.Binding = secret.CurrentBinding
+	ad, err := next.AssociatedData(secretID)
+	if err != nil {
+		return nil, err
+	}
+
+	staged, size, err := w.StageBlob(src, c, recipients, ad)
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(staged)
+
+	return w.addVersion(secretID, s, staged, secret.Version{Binding: next.Binding, Size: size})
+}
+
+// RollbackSecret makes a copy of version n the new current version of the secret
+// stored under secretID, the history is left untouched. It returns the versions
+// dropped by the retention limit, see addVersion.
+func (w *Workspace) RollbackSecret(secretID string, s *secret.Secret, n int) ([]secret.Version, error) {
+	if n == s.CurrentVersion() {
+		return nil, fmt.Errorf("version %d is the current version", n)
+	}
+
+	view, err := s.AtVersion(n)
+	if err != nil {
+		return nil, err
+	}
+
+	src, err := w.OpenCiphertext(view)
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+
+	f, err := os.CreateTemp(w.SecretsDir, ".staging-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create staging file: %w", err)
+	}
+	defer os.Remove(f.Name())
+
+	_, err = io.Copy(f, src)
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to copy version %d: %w", n, err)
+	}
+
+	return w.addVersion(secretID, s, f.Name(), secret.Version{Binding: view.Binding, Size: view.Size})
+}
+
+// addVersion moves the staged ciphertext in place as the next version of the secret.
+// The secret is left unsigned, the caller signs and saves it, then deletes the data
+// of the returned versions, dropped from the history by the retention limit.
+func (w *Workspace) addVersion(secretID string, s *secret.Secret, staged string, v secret.Version) ([]secret.Version, error) {
+	keep, err := w.MaxVersions()
+	if err != nil {
+		return nil, err
+	}
+
+	v.Number = s.CurrentVersion() + 1
+	v.Blob = BlobName(secretID, v.Number)
+	v.CreatedAt = time.Now()
+
+	// never replace the data of another version, e.g. left behind by a failed save
+	if _, err := os.Stat(w.BlobPath(v.Blob)); err == nil {
+		return nil, fmt.Errorf("data of version %d already exists: %s", v.Number, w.BlobPath(v.Blob))
+	}
+	if err := os.Rename(staged, w.BlobPath(v.Blob)); err != nil {
+		return nil, fmt.Errorf("failed to store encrypted data: %w", err)
+	}
+
+	s.AddVersion(v)
+
+	return s.PruneHistory(keep), nil
+}
+
+// RemoveVersions deletes the detached data of the versions
+func (w *Workspace) RemoveVersions(versions []secret.Version) error {
+	for _, v := range versions {
+		if v.Blob == "" {
+			continue
+		}
+		if err := os.Remove(w.BlobPath(v.Blob)); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to delete secret data: %w", err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,123 @@
+package workspace
+
+import (
+	"bytes"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/open-zhy/secm/pkg/crypto"
+	"github.com/open-zhy/secm/pkg/id"
+	"github.com/open-zhy/secm/pkg/secret"
+)
+
+// saveTestVersion signs and saves the secret then deletes the pruned versions, as
+// `secm update` and `secm rollback` do
+func saveTestVersion(t *testing.T, ws *Workspace, secretID string, s *secret.Secret, pruned []secret.Version) {
+	t.Helper()
+	signingKey, _, err := ws.EnsureSigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ws.SignSecret(secretID, s, signingKey); err != nil {
+		t.Fatalf("SignSecret: %v", err)
+	}
+	if err := s.Save(ws.SecretPath(secretID + ".yml")); err != nil {
+		t.Fatal(err)
+	}
+	if err := ws.RemoveVersions(pruned); err != nil {
+		t.Fatalf("RemoveVersions: %v", err)
+	}
+}
+
+// blobs returns the names of the encrypted data files in the secrets directory
+func blobs(t *testing.T, ws *Workspace) []string {
+	t.Helper()
+	paths, err := filepath.Glob(filepath.Join(ws.SecretsDir, "*"+BlobExt))
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := make([]string, 0, len(paths))
+	for _, path := range paths {
+		names = append(names, filepath.Base(path))
+	}
+	slices.Sort(names)
+	return names
+}
+
+// checkContent decrypts version n of the secret
+func checkContent(t *testing.T, ws *Workspace, secretID string, s *secret.Secret, n int, want string) {
+	t.Helper()
+	view, err := s.AtVersion(n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := ws.DecryptSecret(secretID, view)
+	if err != nil {
+		t.Fatalf("DecryptSecret of version %d: %v", n, err)
+	}
+	defer got.Destroy()
+	if string(got.Bytes()) != want {
+		t.Fatalf("version %d holds %q, want %q", n, got.Bytes(), want)
+	}
+}
+
+func TestVersionLifecycle(t *testing.T) {
+	ws := newTestWorkspace(t, generateIdentity(t, "ec25519"))
+	if err := ws.SaveConfig(&Config{MaxVersions: 3}); err != nil {
+		t.Fatal(err)
+	}
+	pub, err := ws.LoadPublicKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := secret.New("token", nil)
+	secretID := storeTestSecret(t, ws, s, []byte("one"))
+	for _, content := range []string{"two", "three"} {
+		pruned, err := ws.UpdateSecret(secretID, s, bytes.NewReader([]byte(content)), crypto.DefaultCipher, []id.Encrypter{pub})
+		if err != nil {
+			t.Fatalf("UpdateSecret: %v", err)
+		}
+		saveTestVersion(t, ws, secretID, s, pruned)
+	}
+
+	want := []string{BlobName(secretID, 1), BlobName(secretID, 2), BlobName(secretID, 3)}
+	if got := blobs(t, ws); !slices.Equal(got, want) {
+		t.Fatalf("after updates: data files %v, want %v", got, want)
+	}
+	checkContent(t, ws, secretID, s, 3, "three")
+
+	// the rollback is a fourth version, the first one falls out of the retention
+	pruned, err := ws.RollbackSecret(secretID, s, 1)
+	if err != nil {
+		t.Fatalf("RollbackSecret: %v", err)
+	}
+	saveTestVersion(t, ws, secretID, s, pruned)
+
+	s = loadTestSecret(t, ws, secretID)
+	if s.CurrentVersion() != 4 {
+		t.Fatalf("current version %d after rollback, want 4", s.CurrentVersion())
+	}
+	want = []string{BlobName(secretID, 2), BlobName(secretID, 3), BlobName(secretID, 4)}
+	if got := blobs(t, ws); !slices.Equal(got, want) {
+		t.Fatalf("after rollback: data files %v, want %v", got, want)
+	}
+	checkContent(t, ws, secretID, s, 4, "one")
+	checkContent(t, ws, secretID, s, 2, "two")
+	if _, err := s.AtVersion(1); err == nil {
+		t.Fatal("pruned version 1 still in the history")
+	}
+
+	// deleting the secret deletes every version
+	secretPath := ws.SecretPath(secretID + ".yml")
+	if err := ws.RemoveSecret(secretPath, s); err != nil {
+		t.Fatalf("RemoveSecret: %v", err)
+	}
+	if got := blobs(t, ws); len(got) != 0 {
+		t.Fatalf("after delete: data files %v left", got)
+	}
+	if exists(t, secretPath) {
+		t.Fatal("secret file left after delete")
+	}
+}
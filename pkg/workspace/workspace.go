@@ -1,27 +1,67 @@
 package workspace
 
 import (
+	"bufio"
+	"bytes"
 	"encoding/base64"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"strings"
 
+	"github.com/google/uuid"
+	"github.com/open-zhy/secm/pkg/agent"
 	"github.com/open-zhy/secm/pkg/crypto"
 	"github.com/open-zhy/secm/pkg/id"
 	"github.com/open-zhy/secm/pkg/secret"
 )
 
 const (
-	DirName     = ".secm"
-	SecretsDir  = "secrets"
-	IdentityKey = "identity.key"
+	DirName      = ".secm"
+	SecretsDir   = "secrets"
+	IdentityKey  = "identity.key"
+	IdentityPub  = "identity.pub"
+	IdentityCert = "identity.crt"
+	SigningKey   = "signing.key"
+	DedupKey     = "dedup.key"
+	BlobExt      = ".enc"
 )
 
+// SecretPassphraseReader returns the passphrase of the secret stored under secretID
+type SecretPassphraseReader func(secretID string) ([]byte, error)
+
+var secretPassphraseReader SecretPassphraseReader = func(string) ([]byte, error) {
+	return nil, id.ErrPassphraseRequired
+}
+
+// SetSecretPassphraseReader sets how the passphrase of passphrase secrets is obtained
+func SetSecretPassphraseReader(r SecretPassphraseReader) {
+	secretPassphraseReader = r
+}
+
 // Workspace represents the secm workspace configuration
 type Workspace struct {
-	RootDir    string
-	SecretsDir string
-	KeyPath    string
+	RootDir        string
+	SecretsDir     string
+	KeyPath        string
+	PublicKeyPath  string
+	SigningKeyPath string
+	CertPath       string
+	DedupKeyPath   string
+}
+
+func newWorkspace(rootDir string) *Workspace {
+	return &Workspace{
+		RootDir:        rootDir,
+		SecretsDir:     filepath.Join(rootDir, SecretsDir),
+		KeyPath:        filepath.Join(rootDir, IdentityKey),
+		PublicKeyPath:  filepath.Join(rootDir, IdentityPub),
+		SigningKeyPath: filepath.Join(rootDir, SigningKey),
+		CertPath:       filepath.Join(rootDir, IdentityCert),
+		DedupKeyPath:   filepath.Join(rootDir, DedupKey),
+	}
 }
 
 // Initialize creates the workspace directory structure
@@ -31,11 +71,7 @@ func Initialize(profile string) (*Workspace, error) {
 		return nil, fmt.Errorf("failed to get home directory: %w", err)
 	}
 
-	ws := &Workspace{
-		RootDir:    filepath.Join(homeDir, DirName, profile),
-		SecretsDir: filepath.Join(homeDir, DirName, profile, SecretsDir),
-		KeyPath:    filepath.Join(homeDir, DirName, profile, IdentityKey),
-	}
+	ws := newWorkspace(filepath.Join(homeDir, DirName, profile))
 
 	// Check if workspace exists, if so we don't override. instead we throw error
 	if _, err := os.Stat(ws.KeyPath); err == nil {
@@ -62,37 +98,227 @@ func Load(profile string) (*Workspace, error) {
 		return nil, fmt.Errorf("failed to get home directory: %w", err)
 	}
 
-	ws := &Workspace{
-		RootDir:    filepath.Join(homeDir, DirName, profile),
-		SecretsDir: filepath.Join(homeDir, DirName, profile, SecretsDir),
-		KeyPath:    filepath.Join(homeDir, DirName, profile, IdentityKey),
-	}
+	ws := newWorkspace(filepath.Join(homeDir, DirName, profile))
 
 	// Check if workspace exists
 	if _, err := os.Stat(ws.RootDir); os.IsNotExist(err) {
 		return nil, fmt.Errorf("workspace not initialized, run 'secm init' first")
 	}
 
+	if err := ws.RecoverRotation(); err != nil {
+		return nil, fmt.Errorf("failed to recover interrupted identity rotation: %w", err)
+	}
+
 	return ws, nil
 }
 
+// CheckSecretID returns an error unless secretID is a UUID in its canonical form, as
+// all secret IDs are. IDs received from others are checked before they name a file.
+func CheckSecretID(secretID string) error {
+	u, err := uuid.Parse(secretID)
+	if err != nil || u.String() != secretID {
+		return fmt.Errorf("invalid secret ID: %q", secretID)
+	}
+
+	return nil
+}
+
 // SecretPath returns the full path for a secret with the given ID
 func (w *Workspace) SecretPath(id string) string {
 	return filepath.Join(w.SecretsDir, id)
 }
 
-func (w *Workspace) DecryptSecret(s *secret.Secret) ([]byte, error) {
+// BlobPath returns the full path of a detached ciphertext file
+func (w *Workspace) BlobPath(name string) string {
+	return filepath.Join(w.SecretsDir, filepath.Base(name))
+}
+
+// OpenCiphertext returns a reader on the encrypted data of the secret,
+// whether it is stored inline or detached
+func (w *Workspace) OpenCiphertext(s *secret.Secret) (io.ReadCloser, error) {
+	if s.IsDetached() {
+		f, err := os.Open(w.BlobPath(s.Blob))
+		if err != nil {
+			return nil, fmt.Errorf("failed to open secret data: %w", err)
+		}
+		return f, nil
+	}
+
 	raw, err := s.Raw()
 	if err != nil {
 		return nil, fmt.Errorf("failed to decode secret data: %w", err)
 	}
 
-	identity, err := id.LoadKeyFile(w.KeyPath)
+	return io.NopCloser(bytes.NewReader(raw)), nil
+}
+
+// StageBlob encrypts src with the cipher for the recipients into a staging file of the
+// secrets directory and returns its path along with the size of the plaintext, the caller
+// renames it once the secret is complete
+func (w *Workspace) StageBlob(src io.Reader, c crypto.Cipher, recipients []id.Encrypter, associatedData []byte) (string, int64, error) {
+	f, err := os.CreateTemp(w.SecretsDir, ".staging-*")
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to create staging file: %w", err)
+	}
+
+	size, err := encryptTo(f, src, c, recipients, associatedData)
 	if err != nil {
-		return nil, fmt.Errorf("failed to load identity: %w", err)
+		f.Close()
+		os.Remove(f.Name())
+		return "", 0, err
 	}
 
-	return crypto.DecryptData(identity, raw)
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return "", 0, fmt.Errorf("failed to write staging file: %w", err)
+	}
+
+	return f.Name(), size, nil
+}
+
+// encryptTo encrypts src into f and returns the size of the plaintext
+func encryptTo(f *os.File, src io.Reader, c crypto.Cipher, recipients []id.Encrypter, associatedData []byte) (int64, error) {
+	enc, err := crypto.NewCipherEncryptWriter(f, c, recipients, associatedData)
+	if err != nil {
+		return 0, fmt.Errorf("failed to encrypt data: %w", err)
+	}
+
+	size, err := crypto.SecureCopy(enc, src)
+	if err != nil {
+		return 0, fmt.Errorf("failed to encrypt data: %w", err)
+	}
+
+	if err := enc.Close(); err != nil {
+		return 0, fmt.Errorf("failed to encrypt data: %w", err)
+	}
+
+	return size, f.Sync()
+}
+
+// DecryptSecretTo streams the decrypted secret stored under secretID into dst,
+// it fails when the ID or the bound metadata do not match the ciphertext
+func (w *Workspace) DecryptSecretTo(secretID string, s *secret.Secret, dst io.Writer) error {
+	ad, err := s.AssociatedData(secretID)
+	if err != nil {
+		return err
+	}
+
+	decrypter, err := w.decrypterFor(secretID, s)
+	if err != nil {
+		return err
+	}
+
+	src, err := w.OpenCiphertext(s)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	plaintext, err := crypto.NewDecryptReader(src, decrypter, ad)
+	if err == nil {
+		_, err = crypto.SecureCopy(dst, plaintext)
+		plaintext.Close()
+	}
+
+	if errors.Is(err, crypto.ErrAuthentication) && s.Binding != secret.BindingNone {
+		return fmt.Errorf("secret does not match its ciphertext, its ID or metadata may have been tampered with: %w", err)
+	}
+
+	return err
+}
+
+// decrypterFor returns the identity key, or the passphrase of passphrase secrets
+func (w *Workspace) decrypterFor(secretID string, s *secret.Secret) (id.Decrypter, error) {
+	protected, err := w.IsPassphraseSecret(s)
+	if err != nil {
+		return nil, err
+	}
+
+	if !protected {
+		return w.LoadDecrypter()
+	}
+
+	passphrase, err := secretPassphraseReader(secretID)
+	if err != nil {
+		return nil, err
+	}
+
+	return id.NewScryptIdentity(passphrase)
+}
+
+// IsPassphraseSecret reports whether the data key of the secret is wrapped
+// with a passphrase instead of identities
+func (w *Workspace) IsPassphraseSecret(s *secret.Secret) (bool, error) {
+	header, err := w.readHeader(s)
+	if err != nil || header == nil {
+		return false, err
+	}
+
+	for _, stanza := range header.Stanzas {
+		if stanza.Wrap == id.WrapScrypt {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// SecretCipher returns the payload cipher of the secret
+func (w *Workspace) SecretCipher(s *secret.Secret) (crypto.Cipher, error) {
+	header, err := w.readHeader(s)
+	if err != nil {
+		return 0, err
+	}
+
+	// legacy data without header is always AES-256-GCM
+	if header == nil {
+		return crypto.CipherAES256GCM, nil
+	}
+
+	return header.Cipher, nil
+}
+
+// readHeader returns the envelope header of the secret, nil for legacy data without header
+func (w *Workspace) readHeader(s *secret.Secret) (*crypto.Header, error) {
+	src, err := w.OpenCiphertext(s)
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+
+	br := bufio.NewReader(src)
+	if prefix, _ := br.Peek(len(crypto.Magic)); !crypto.HasHeader(prefix) {
+		return nil, nil
+	}
+
+	return crypto.ReadHeader(br)
+}
+
+// DecryptSecret returns the plaintext of the secret in a secure buffer the
+// caller must destroy
+func (w *Workspace) DecryptSecret(secretID string, s *secret.Secret) (*crypto.SecureBuffer, error) {
+	buf := crypto.NewSecureBuffer(0)
+	if err := w.DecryptSecretTo(secretID, s, buf); err != nil {
+		buf.Destroy()
+		return nil, err
+	}
+
+	return buf, nil
+}
+
+// RemoveSecret deletes the secret file, its read count and the detached data of
+// all its versions
+func (w *Workspace) RemoveSecret(secretPath string, s *secret.Secret) error {
+	if err := os.Remove(secretPath); err != nil {
+		return fmt.Errorf("failed to delete secret file: %w", err)
+	}
+
+	reads := strings.TrimSuffix(secretPath, filepath.Ext(secretPath)) + ReadsExt
+	if err := os.Remove(reads); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to delete read count: %w", err)
+	}
+
+	return w.RemoveVersions(s.Versions())
 }
 
 func (w *Workspace) LoadKey() (id.KeyPackageIdentity, error) {
@@ -103,17 +329,282 @@ func (w *Workspace) LoadKey() (id.KeyPackageIdentity, error) {
 	return identity, nil
 }
 
-func (w *Workspace) Grant(grantee id.Encrypter, s *secret.Secret) (*secret.Secret, error) {
-	cleartext, err := w.DecryptSecret(s)
+// LoadDecrypter returns what unwraps the data keys of the identity: the agent
+// listening on SECM_AGENT_SOCK when it is set, the identity key otherwise
+func (w *Workspace) LoadDecrypter() (id.Decrypter, error) {
+	socket := os.Getenv(agent.SockEnv)
+	if socket == "" {
+		return w.LoadKey()
+	}
+
+	client, err := agent.Dial(socket)
+	if err != nil {
+		return nil, err
+	}
+
+	pub, err := w.LoadPublicKey()
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(pub.Bytes(), client.PublicKey().Bytes()) {
+		return nil, fmt.Errorf("agent on %s holds another identity than the profile", socket)
+	}
+
+	return client, nil
+}
+
+// SaveKey writes the identity key, encrypted with the passphrase unless it is
+// empty, along with its public key. An existing key is replaced atomically.
+func (w *Workspace) SaveKey(identity id.KeyPackageIdentity, passphrase []byte) error {
+	return saveKey(w.KeyPath, w.PublicKeyPath, identity, passphrase)
+}
+
+func saveKey(keyPath, pubPath string, identity id.KeyPackageIdentity, passphrase []byte) error {
+	var key bytes.Buffer
+	if err := id.EncodeKey(&key, identity, passphrase); err != nil {
+		return fmt.Errorf("failed to encode identity key: %w", err)
+	}
+
+	var pub bytes.Buffer
+	if err := identity.PublicKey().Encode(&pub); err != nil {
+		return fmt.Errorf("failed to encode public key: %w", err)
+	}
+
+	if err := writeFileAtomic(keyPath, key.Bytes(), 0600); err != nil {
+		return fmt.Errorf("failed to write identity key: %w", err)
+	}
+
+	if err := writeFileAtomic(pubPath, pub.Bytes(), 0644); err != nil {
+		return fmt.Errorf("failed to write public key: %w", err)
+	}
+
+	return nil
+}
+
+// LoadPublicKey returns the public key of the identity, read from identity.pub
+// so that a passphrase is not needed. Workspaces initialized before it existed
+// fall back to the identity key.
+func (w *Workspace) LoadPublicKey() (id.PublicKey, error) {
+	if _, err := os.Stat(w.PublicKeyPath); err == nil {
+		return id.LoadPublicKeyFile(w.PublicKeyPath)
+	}
+
+	identity, err := w.LoadKey()
+	if err != nil {
+		return nil, err
+	}
+
+	return identity.PublicKey(), nil
+}
+
+// IsKeyProtected reports whether the identity key is encrypted with a passphrase
+func (w *Workspace) IsKeyProtected() (bool, error) {
+	data, err := os.ReadFile(w.KeyPath)
+	if err != nil {
+		return false, fmt.Errorf("failed to read identity key: %w", err)
+	}
+
+	return id.IsEncryptedKey(data), nil
+}
+
+// Grant re-encrypts the secret stored under secretID for the grantee only,
+// the copy is bound to the same ID and metadata and keeps its policies
+func (w *Workspace) Grant(grantee id.Encrypter, secretID string, s *secret.Secret) (*secret.Secret, error) {
+	if err := w.CheckPolicy(secretID, s); err != nil {
+		return nil, err
+	}
+
+	cleartext, err := w.DecryptSecret(secretID, s)
 	if err != nil {
 		return nil, fmt.Errorf("failed to decrypt secret: %w", err)
 	}
-	encrypted, err := crypto.EncryptData(grantee, cleartext)
+	defer cleartext.Destroy()
+
+	// a grant is a read of the secret, handed to the grantee: the caller counts it
+	// against the reads of the secret, see RecordRead. The policy is bound, it is
+	// set before encrypting.
+	if s.MaxReads > 0 {
+		s.MaxReads = 1
+	}
+
+	s.Binding = secret.CurrentBinding
+	ad, err := s.AssociatedData(secretID)
+	if err != nil {
+		return nil, err
+	}
+
+	encrypted, err := crypto.EncryptData(grantee, cleartext.Bytes(), ad)
 	if err != nil {
 		return nil, fmt.Errorf("failed to encrypt secret for grantee: %w", err)
 	}
 
+	// the granted copy always travels inline without history, is only readable by
+	// the grantee and the content MAC is keyed by this identity
 	s.Data = base64.StdEncoding.EncodeToString(encrypted)
+	s.Blob = ""
+	s.Recipients = nil
+	s.ContentMAC = ""
+	s.History = nil
 
 	return s, nil
 }
+
+// Share adds recipients to the envelope of every version of the secret without
+// re-encrypting their payload
+func (w *Workspace) Share(s *secret.Secret, recipients ...id.Encrypter) (*secret.Secret, error) {
+	if protected, err := w.IsPassphraseSecret(s); err != nil || protected {
+		if err == nil {
+			err = fmt.Errorf("secrets encrypted with a passphrase cannot have recipients")
+		}
+		return nil, err
+	}
+
+	decrypter, err := w.LoadDecrypter()
+	if err != nil {
+		return nil, err
+	}
+
+	// every version is shared, rolling back does not take access away
+	for _, v := range s.Versions() {
+		view, err := s.AtVersion(v.Number)
+		if err != nil {
+			return nil, err
+		}
+
+		_, err = w.rewriteCiphertext(view, func(dst io.Writer, src io.Reader) (bool, error) {
+			if err := crypto.Rewrap(dst, src, decrypter, recipients...); err != nil {
+				return false, fmt.Errorf("failed to add recipients: %w", err)
+			}
+			return true, nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		s.SetVersion(v.Number, view)
+	}
+
+	return s, nil
+}
+
+// rewriteBlob replaces a detached ciphertext with the output of rewrite, the file
+// is replaced atomically and only when rewrite reports a change
+func (w *Workspace) rewriteBlob(name string, rewrite func(dst io.Writer, src io.Reader) (bool, error)) (bool, error) {
+	src, err := os.Open(w.BlobPath(name))
+	if err != nil {
+		return false, fmt.Errorf("failed to open secret data: %w", err)
+	}
+	defer src.Close()
+
+	dst, err := os.CreateTemp(w.SecretsDir, ".staging-*")
+	if err != nil {
+		return false, fmt.Errorf("failed to create staging file: %w", err)
+	}
+	defer os.Remove(dst.Name())
+
+	changed, err := rewrite(dst, src)
+	if err != nil || !changed {
+		dst.Close()
+		return false, err
+	}
+
+	if err := dst.Close(); err != nil {
+		return false, fmt.Errorf("failed to write staging file: %w", err)
+	}
+
+	return true, os.Rename(dst.Name(), w.BlobPath(name))
+}
+
+// rewriteCiphertext applies rewrite to the encrypted data of the secret,
+// whether it is stored inline or detached
+func (w *Workspace) rewriteCiphertext(s *secret.Secret, rewrite func(dst io.Writer, src io.Reader) (bool, error)) (bool, error) {
+	if s.IsDetached() {
+		return w.rewriteBlob(s.Blob, rewrite)
+	}
+
+	raw, err := s.Raw()
+	if err != nil {
+		return false, fmt.Errorf("failed to decode secret data: %w", err)
+	}
+
+	var buf bytes.Buffer
+	changed, err := rewrite(&buf, bytes.NewReader(raw))
+	if err != nil || !changed {
+		return false, err
+	}
+
+	s.Data = base64.StdEncoding.EncodeToString(buf.Bytes())
+
+	return true, nil
+}
+
+// UpgradeSecret wraps the data key of the secret stored under secretID again
+// with the current algorithm of the identity when it was wrapped with a
+// deprecated one, it reports whether the secret was changed and has to be saved
+func (w *Workspace) UpgradeSecret(secretID string, s *secret.Secret) (bool, error) {
+	// the data key of passphrase secrets is not wrapped for the identity
+	if protected, err := w.IsPassphraseSecret(s); err != nil || protected {
+		return false, err
+	}
+
+	ad, err := s.AssociatedData(secretID)
+	if err != nil {
+		return false, err
+	}
+
+	decrypter, err := w.LoadDecrypter()
+	if err != nil {
+		return false, err
+	}
+
+	pub, err := w.LoadPublicKey()
+	if err != nil {
+		return false, err
+	}
+
+	upgrade := func(dst io.Writer, src io.Reader) (bool, error) {
+		return crypto.UpgradeWrap(dst, src, decrypter, pub, ad)
+	}
+
+	changed, err := w.rewriteCiphertext(s, upgrade)
+	if !errors.Is(err, crypto.ErrLegacyWrap) {
+		return changed, err
+	}
+
+	// the agent never unwraps legacy RSA data keys, the identity key does it here
+	if decrypter, err = w.LoadKey(); err != nil {
+		return false, err
+	}
+
+	return w.rewriteCiphertext(s, upgrade)
+}
+
+// writeFileAtomic writes data to a staging file next to path and renames it
+// over path, so that the file is either the old or the new content
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	f, err := os.CreateTemp(filepath.Dir(path), ".staging-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+
+	if err := f.Chmod(perm); err != nil {
+		f.Close()
+		return err
+	}
+
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), path)
+}
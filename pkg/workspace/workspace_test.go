@@ -0,0 +1,261 @@
+package workspace
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/pem"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/open-zhy/secm/pkg/agent"
+	"github.com/open-zhy/secm/pkg/crypto"
+	"github.com/open-zhy/secm/pkg/id"
+	"github.com/open-zhy/secm/pkg/secret"
+)
+
+// newTestWorkspace initializes a workspace in a temporary directory with the
+// identity, decrypting without agent
+func newTestWorkspace(t *testing.T, identity id.KeyPackageIdentity) *Workspace {
+	t.Helper()
+	t.Setenv(agent.SockEnv, "")
+
+	ws := newWorkspace(t.TempDir())
+	if err := os.Mkdir(ws.SecretsDir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := ws.SaveKey(identity, nil); err != nil {
+		t.Fatalf("SaveKey: %v", err)
+	}
+
+	return ws
+}
+
+func generateIdentity(t *testing.T, keyType string) id.KeyPackageIdentity {
+	t.Helper()
+	identity, err := id.GenerateKey(id.GenerateKeyOpts{Type: keyType})
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	return identity
+}
+
+// storeTestSecret encrypts content into a new signed secret as `secm create` does
+// and returns its ID
+func storeTestSecret(t *testing.T, ws *Workspace, s *secret.Secret, content []byte) string {
+	t.Helper()
+	pub, err := ws.LoadPublicKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return storeTestSecretTo(t, ws, s, content, crypto.DefaultCipher, pub)
+}
+
+// storeTestSecretTo is storeTestSecret with the cipher and recipients of the secret
+func storeTestSecretTo(t *testing.T, ws *Workspace, s *secret.Secret, content []byte, c crypto.Cipher, recipients ...id.Encrypter) string {
+	t.Helper()
+	secretID := uuid.NewString()
+
+	ad, err := s.AssociatedData(secretID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	staged, size, err := ws.StageBlob(bytes.NewReader(content), c, recipients, ad)
+	if err != nil {
+		t.Fatalf("StageBlob: %v", err)
+	}
+	s.Size = size
+	s.Blob = BlobName(secretID, 1)
+	if err := os.Rename(staged, ws.BlobPath(s.Blob)); err != nil {
+		t.Fatal(err)
+	}
+
+	signingKey, _, err := ws.EnsureSigningKey()
+	if err != nil {
+		t.Fatalf("EnsureSigningKey: %v", err)
+	}
+	if err := ws.SignSecret(secretID, s, signingKey); err != nil {
+		t.Fatalf("SignSecret: %v", err)
+	}
+	if err := s.Save(ws.SecretPath(secretID + ".yml")); err != nil {
+		t.Fatal(err)
+	}
+
+	return secretID
+}
+
+// loadTestSecret reads back the secret stored under secretID
+func loadTestSecret(t *testing.T, ws *Workspace, secretID string) *secret.Secret {
+	t.Helper()
+	s, err := secret.Load(ws.SecretPath(secretID + ".yml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// exists reports whether the file exists
+func exists(t *testing.T, path string) bool {
+	t.Helper()
+	_, err := os.Stat(path)
+	if err != nil && !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+	return err == nil
+}
+
+func TestUpgradeSecretLegacyRSA(t *testing.T) {
+	pk, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	identity, err := id.ParseKey(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(pk)}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ws := newTestWorkspace(t, identity)
+
+	// a secret as written by releases without header, inline and unbound:
+	// [4-byte key len][PKCS#1 v1.5 wrapped key][nonce][AES-256-GCM ciphertext]
+	plaintext := []byte("written before OAEP")
+	key := make([]byte, 32)
+	nonce := make([]byte, 12)
+	rand.Read(key)
+	rand.Read(nonce)
+	wrapped, err := rsa.EncryptPKCS1v15(rand.Reader, &pk.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	blob := binary.BigEndian.AppendUint32(nil, uint32(len(wrapped)))
+	blob = append(append(blob, wrapped...), nonce...)
+	blob = gcm.Seal(blob, nonce, plaintext, nil)
+
+	s := &secret.Secret{Name: "legacy", Data: base64.StdEncoding.EncodeToString(blob)}
+	const secretID = "legacy"
+
+	if _, err := ws.DecryptSecret(secretID, s); err == nil {
+		t.Fatal("legacy PKCS#1 v1.5 secret decrypted without migration")
+	}
+
+	// what `secm migrate` does
+	changed, err := ws.UpgradeSecret(secretID, s)
+	if err != nil {
+		t.Fatalf("UpgradeSecret: %v", err)
+	}
+	if !changed {
+		t.Fatal("UpgradeSecret reported no change for a legacy secret")
+	}
+
+	header, err := ws.readHeader(s)
+	if err != nil || header == nil {
+		t.Fatalf("migrated secret has no header: %v", err)
+	}
+	if wrap := header.Stanzas[0].Wrap; wrap != id.WrapRSAOAEPSHA256 {
+		t.Fatalf("migrated secret wrapped with %s, want %s", wrap, id.WrapRSAOAEPSHA256)
+	}
+
+	got, err := ws.DecryptSecret(secretID, s)
+	if err != nil {
+		t.Fatalf("DecryptSecret of the migrated secret: %v", err)
+	}
+	defer got.Destroy()
+	if !bytes.Equal(got.Bytes(), plaintext) {
+		t.Fatal("migrated secret plaintext mismatch")
+	}
+
+	if changed, err := ws.UpgradeSecret(secretID, s); err != nil || changed {
+		t.Fatalf("UpgradeSecret of a migrated secret: changed %v, err %v", changed, err)
+	}
+}
+
+func TestCheckSecretID(t *testing.T) {
+	for _, secretID := range []string{
+		uuid.NewString(),
+		"01a14b16-dcbd-7ade-8b65-75fbc6d4de08",
+		// content-derived IDs of older releases
+		uuid.NewSHA1(uuid.NameSpaceDNS, []byte("content")).String(),
+	} {
+		if err := CheckSecretID(secretID); err != nil {
+			t.Errorf("CheckSecretID(%q): %v", secretID, err)
+		}
+	}
+
+	for _, secretID := range []string{
+		"",
+		"../../x",
+		"../01a14b16-dcbd-7ade-8b65-75fbc6d4de08",
+		"01a14b16-dcbd-7ade-8b65-75fbc6d4de08/../../x",
+		"urn:uuid:01a14b16-dcbd-7ade-8b65-75fbc6d4de08",
+		"{01a14b16-dcbd-7ade-8b65-75fbc6d4de08}",
+		"01A14B16-DCBD-7ADE-8B65-75FBC6D4DE08",
+		"01a14b16dcbd7ade8b6575fbc6d4de08",
+	} {
+		if err := CheckSecretID(secretID); err == nil {
+			t.Errorf("CheckSecretID(%q) succeeded", secretID)
+		}
+	}
+}
+
+func TestBoundMetadata(t *testing.T) {
+	ws := newTestWorkspace(t, generateIdentity(t, "ec25519"))
+	s := secret.New("token", nil)
+	s.Type = "api-key"
+	s.ExpiresAt = s.CreatedAt.Add(time.Hour)
+	s.MaxReads = 3
+	secretID := storeTestSecret(t, ws, s, []byte("bound"))
+	secretPath := ws.SecretPath(secretID + ".yml")
+	saved, err := os.ReadFile(secretPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// edits of the file, decrypted without checking the signature as `secm get` does without --verify
+	for name, edit := range map[string]func(s *secret.Secret){
+		"max_reads":  func(s *secret.Secret) { s.MaxReads = 30 },
+		"no limit":   func(s *secret.Secret) { s.MaxReads = 0 },
+		"expires_at": func(s *secret.Secret) { s.ExpiresAt = s.ExpiresAt.Add(24 * time.Hour) },
+		"no expiry":  func(s *secret.Secret) { s.ExpiresAt = time.Time{} },
+		"format":     func(s *secret.Secret) { s.Format = "binary" },
+		"binding":    func(s *secret.Secret) { s.Binding = secret.BindingV1 },
+	} {
+		edited := loadTestSecret(t, ws, secretID)
+		edit(edited)
+		if err := edited.Save(secretPath); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := ws.DecryptSecret(secretID, loadTestSecret(t, ws, secretID)); err == nil {
+			t.Errorf("%s: secret decrypted after its bound metadata was edited", name)
+		}
+	}
+
+	// the informative fields are left free for `secm meta set`
+	edited := strings.Replace(string(saved), "api-key", "password", 1)
+	if err := os.WriteFile(secretPath, []byte(edited), 0600); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ws.DecryptSecret(secretID, loadTestSecret(t, ws, secretID))
+	if err != nil {
+		t.Fatalf("DecryptSecret after editing the type: %v", err)
+	}
+	defer got.Destroy()
+	if !bytes.Equal(got.Bytes(), []byte("bound")) {
+		t.Fatal("plaintext mismatch")
+	}
+}
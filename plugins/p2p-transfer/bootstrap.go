@@ -13,6 +13,8 @@ func (i *Initializable) Initialize(cmd *cobra.Command) {
 	transferCommand.Flags().IntVar(&listenPort, "port", 0, "Listening port of the node, 0 means random")
 	transferCommand.Flags().StringVar(&peerAddr, "peer", "", "Peer address to connect with")
 	transferCommand.Flags().StringVar(&timeoutDuration, "timeout", "5m", "Duration to wait incoming connection and processing the transfer")
+	transferCommand.Flags().StringVar(&signerFile, "signer", "", "Verifying key file of the expected sender, the received secret is rejected if signed by another key")
+	transferCommand.Flags().StringArrayVar(&expectPrints, "expect-fingerprint", nil, "Fingerprint the identity of the receiver must match, as printed by 'secm id --fingerprint', can be repeated")
 	rootCmd.AddCommand(transferCommand)
 }
 
@@ -11,6 +11,8 @@ var (
 	peerAddr        string
 	listenPort      int
 	timeoutDuration string
+	signerFile      string
+	expectPrints    []string
 	rootCmd         *cobra.Command
 )
 
@@ -19,7 +21,8 @@ var transferCommand = &cobra.Command{
 	Short: "Transfer a secret on top of a p2p protocol",
 	RunE: func(cmd *cobra.Command, args []string) error {
 		option := &transfer.NodeOption{
-			Port: listenPort,
+			Port:              listenPort,
+			ExpectFingerprint: expectPrints,
 		}
 
 		if timeoutDuration != "" {
@@ -29,7 +32,8 @@ var transferCommand = &cobra.Command{
 		var peer *transfer.PeerOption
 		if peerAddr != "" {
 			peer = &transfer.PeerOption{
-				Addr: peerAddr,
+				Addr:   peerAddr,
+				Signer: signerFile,
 			}
 
 			// no need to specify as argument for peer side
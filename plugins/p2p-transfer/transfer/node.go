@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/open-zhy/secm/pkg/id"
 	"github.com/open-zhy/secm/pkg/workspace"
 
 	"github.com/libp2p/go-libp2p"
@@ -21,6 +22,8 @@ type NodeOption struct {
 	Port       int
 	Context    context.Context
 	CancelFunc context.CancelFunc
+	// ExpectFingerprint lists the identity fingerprints the receiver must match
+	ExpectFingerprint []string
 }
 
 type Node interface {
@@ -30,12 +33,12 @@ type Node interface {
 
 type TransfererNode interface {
 	Node
-	HandleSecretTransfer(s network.Stream, ws *workspace.Workspace, payload *SecretTransferPayload)
+	HandleSecretTransfer(s network.Stream, ws *workspace.Workspace, payload *SecretTransferPayload, expected []string)
 }
 
 type ReceiverNode interface {
 	Node
-	HandleSecretReceive(s network.Stream, ws *workspace.Workspace)
+	HandleSecretReceive(s network.Stream, ws *workspace.Workspace, trusted id.VerifyingKey)
 	PublicKey() []byte
 }
 
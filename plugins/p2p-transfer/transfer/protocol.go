@@ -1,9 +1,13 @@
 package transfer
 
 import (
+	"bytes"
 	"encoding/binary"
+	"os"
 
 	"github.com/open-zhy/secm/pkg/errors"
+	"github.com/open-zhy/secm/pkg/id"
+	"github.com/open-zhy/secm/pkg/screen"
 	"github.com/open-zhy/secm/pkg/workspace"
 )
 
@@ -16,6 +20,8 @@ type ProtocolPayload interface {
 }
 
 type HandshakePayload struct {
+	// IdentityPubKey is the PEM encoded public key of the receiver identity, or the DER
+	// certificate chain of identities with a certificate
 	IdentityPubKey []byte `secm:"identityPubKey"`
 	PeerPubKey     []byte `secm:"peerPubKey"`
 }
@@ -74,9 +80,10 @@ func (p *HandshakePayload) Decode(data []byte) error {
 }
 
 func createHandshakePayload(ha ReceiverNode, ws *workspace.Workspace) ([]byte, error) {
-	identity, err := ws.LoadKey()
+	// only the public key is published, the identity key stays locked
+	pub, err := ws.LoadPublicKey()
 	if err != nil {
-		return nil, errors.Wrapf(err, "failed to load identity key from %s", ws.KeyPath)
+		return nil, errors.Wrapf(err, "failed to load identity public key")
 	}
 
 	// Add the peer public key to the payload
@@ -85,8 +92,33 @@ func createHandshakePayload(ha ReceiverNode, ws *workspace.Workspace) ([]byte, e
 		return nil, errors.New("peer public key is nil")
 	}
 
+	// the sender checks the identity against this fingerprint
+	if fingerprint, err := id.PublicKeyFingerprint(pub); err == nil {
+		screen.Printf("Your identity: %s\n", fingerprint)
+	}
+
+	// the PEM encoding tells the key type apart, raw bytes of an ed25519 key
+	// would be read as an X25519 key by the sender
+	var encoded bytes.Buffer
+	if err := pub.Encode(&encoded); err != nil {
+		return nil, errors.Wrapf(err, "failed to encode identity public key")
+	}
+
+	identityBytes := encoded.Bytes()
+	chain, err := ws.LoadCertificate()
+	if err != nil && !os.IsNotExist(err) {
+		return nil, errors.Wrapf(err, "failed to load identity certificate")
+	}
+	if chain != nil {
+		// the sender validates the chain against its trust anchors
+		identityBytes = nil
+		for _, cert := range chain {
+			identityBytes = append(identityBytes, cert.Raw...)
+		}
+	}
+
 	payload := &HandshakePayload{
-		IdentityPubKey: identity.PublicKey().Bytes(),
+		IdentityPubKey: identityBytes,
 		PeerPubKey:     peerPubKeyBytes,
 	}
 
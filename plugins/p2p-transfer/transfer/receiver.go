@@ -8,6 +8,7 @@ import (
 	"github.com/libp2p/go-libp2p/core/peer"
 	"github.com/libp2p/go-libp2p/core/peerstore"
 	"github.com/open-zhy/secm/pkg/errors"
+	"github.com/open-zhy/secm/pkg/id"
 	"github.com/open-zhy/secm/pkg/screen"
 	"github.com/open-zhy/secm/pkg/workspace"
 
@@ -16,6 +17,8 @@ import (
 
 type PeerOption struct {
 	Addr string
+	// Signer is the verifying key file of the expected sender
+	Signer string
 }
 
 type ReceiverPeer struct {
@@ -24,7 +27,7 @@ type ReceiverPeer struct {
 }
 
 // NewPeer creates a new ReceiverPeer instance by establishing a connection
-func NewReceiverPeer(ctx context.Context, ha ReceiverNode, ws *workspace.Workspace, peerAddr string) (*ReceiverPeer, error) {
+func NewReceiverPeer(ctx context.Context, ha ReceiverNode, ws *workspace.Workspace, peerAddr string, trusted id.VerifyingKey) (*ReceiverPeer, error) {
 	maddr, err := ma.NewMultiaddr(peerAddr)
 	if err != nil {
 		return nil, errors.Wrapf(err, "invalid multi-address %s", peerAddr)
@@ -70,7 +73,7 @@ func NewReceiverPeer(ctx context.Context, ha ReceiverNode, ws *workspace.Workspa
 	}
 
 	// Handle secret reception in a goroutine
-	go ha.HandleSecretReceive(stream, ws)
+	go ha.HandleSecretReceive(stream, ws, trusted)
 
 	// Create a buffered stream so that read and writes are non-blocking.
 	rw := bufio.NewReadWriter(bufio.NewReader(stream), bufio.NewWriter(stream))
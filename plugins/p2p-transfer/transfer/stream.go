@@ -3,10 +3,12 @@ package transfer
 import (
 	"bytes"
 	"context"
+	"crypto/x509"
 	"encoding/binary"
 	"encoding/json"
+	"encoding/pem"
 	"io"
-	"path/filepath"
+	"os"
 
 	"github.com/libp2p/go-libp2p/core/host"
 	"github.com/libp2p/go-libp2p/core/network"
@@ -40,8 +42,9 @@ func (n *TransferStreamerNode) PublicKey() []byte {
 	return pub
 }
 
-// NewNodeStreamerWrapper creates a new NodeStreamerWrapper instance
-func (n *TransferStreamerNode) HandleSecretTransfer(s network.Stream, ws *workspace.Workspace, payload *SecretTransferPayload) {
+// HandleSecretTransfer grants the secret to the receiver identity and sends it,
+// the identity must match one of the expected fingerprints if any
+func (n *TransferStreamerNode) HandleSecretTransfer(s network.Stream, ws *workspace.Workspace, payload *SecretTransferPayload, expected []string) {
 	screen.Printf("peer connected, id=%s\n", s.ID())
 	defer s.Close()
 	//defer n.teardown()
@@ -82,16 +85,78 @@ func (n *TransferStreamerNode) HandleSecretTransfer(s network.Stream, ws *worksp
 	}
 
 	// grant read to the receiver
-	receiverPubKey, err := id.ParsePublicKey(p.IdentityPubKey)
+	var receiverPubKey id.PublicKey
+	var receiverSubject string
+	if chain, certErr := x509.ParseCertificates(p.IdentityPubKey); certErr == nil && len(chain) > 0 {
+		receiverPubKey, receiverSubject, err = ws.VerifyRecipient(chain)
+		if err != nil {
+			screen.Errorf("Refused receiver: %s\n", err)
+			return
+		}
+		screen.Printf("Receiver certificate: %s\n", receiverSubject)
+	} else {
+		// raw key bytes are ambiguous, only the PEM encoding of the key is accepted
+		if block, _ := pem.Decode(p.IdentityPubKey); block == nil {
+			screen.Errorf("Refused receiver: its public key is not PEM encoded, it may run an older version\n")
+			return
+		}
+		receiverPubKey, err = id.ParsePublicKey(p.IdentityPubKey)
+		if err != nil {
+			screen.Printf("failed to parse receiver public key: %s\n", err)
+			return
+		}
+	}
+	if fingerprint, err := id.PublicKeyFingerprint(receiverPubKey); err == nil {
+		screen.Printf("Receiver identity: %s\n", fingerprint)
+	}
+	if err := id.CheckFingerprint(receiverPubKey, expected...); err != nil {
+		screen.Errorf("Refused receiver: %s\n", err)
+		return
+	}
+	// loaded again, a previous transfer may have burnt it
+	stored, err := secret.Load(ws.SecretPath(secretId + ".yml"))
 	if err != nil {
-		screen.Printf("failed to parse receiver public key: %s\n", err)
+		screen.Printf("failed to load secret: %s\n", err)
 		return
 	}
-	sec, err = ws.Grant(receiverPubKey, sec)
+	granted := *stored
+	sec, err = ws.Grant(receiverPubKey, secretId, &granted)
 	if err != nil {
 		screen.Printf("failed to grant read access to receiver: %s\n", err)
 		return
 	}
+	if receiverSubject != "" {
+		sec.Recipients = []string{receiverSubject}
+	}
+
+	// sign the copy granted to the receiver so that it can tell who sent it
+	signingKey, _, err := ws.EnsureSigningKey()
+	if err != nil {
+		screen.Printf("failed to load signing key: %s\n", err)
+		return
+	}
+	if err := ws.SignSecret(secretId, sec, signingKey); err != nil {
+		screen.Printf("failed to sign secret: %s\n", err)
+		return
+	}
+	payload.Secret = sec
+
+	// a secret burnt by this transfer must not be brought back by a rotation
+	if stored.MaxReads > 0 {
+		lock, err := ws.LockWrites()
+		if err != nil {
+			screen.Printf("failed to lock workspace: %s\n", err)
+			return
+		}
+		defer lock.Close()
+	}
+
+	// the transfer is a read of the secret, counted before it leaves
+	last, err := ws.RecordRead(secretId, stored)
+	if err != nil {
+		screen.Printf("failed to record read: %s\n", err)
+		return
+	}
 
 	// For sending side - serialize payload to JSON and send
 	payloadData, err := json.Marshal(payload)
@@ -106,10 +171,19 @@ func (n *TransferStreamerNode) HandleSecretTransfer(s network.Stream, ws *worksp
 	}
 
 	screen.Printf("Secret '%s' sent successfully with ID: %s\n", sec.Name, secretId)
+	if last {
+		if err := ws.BurnSecret(secretId, stored); err != nil {
+			screen.Printf("%s\n", err)
+			return
+		}
+		screen.Printf("Last read of the secret, it has been deleted\n")
+	}
 }
 
 // HandleSecretReceive handles receiving a secret from a peer
-func (n *TransferStreamerNode) HandleSecretReceive(s network.Stream, ws *workspace.Workspace) {
+// When trusted is set, the secret must be signed by this key, otherwise
+// the fingerprint of the signer is printed for the user to check.
+func (n *TransferStreamerNode) HandleSecretReceive(s network.Stream, ws *workspace.Workspace, trusted id.VerifyingKey) {
 	screen.Printf("Receiving secret from peer: %s\n", s.ID())
 	defer s.Close()
 	defer n.teardown()
@@ -130,6 +204,46 @@ func (n *TransferStreamerNode) HandleSecretReceive(s network.Stream, ws *workspa
 
 	// Extract the secret and its original ID
 	receiviedSecret := payload.Secret
+	if receiviedSecret == nil {
+		screen.Println("No secret in payload")
+		return
+	}
+
+	// the ID names the secret file, the data travels inline and nothing else of the
+	// workspace of the sender is referred to
+	if err := workspace.CheckSecretID(payload.ID); err != nil {
+		screen.Errorf("Rejected secret: %s\n", err)
+		return
+	}
+	if receiviedSecret.IsDetached() || len(receiviedSecret.History) > 0 {
+		screen.Errorf("Rejected secret: it refers to detached data or previous versions\n")
+		return
+	}
+
+	// Check who sent the secret before accepting it, its policy is covered by the signature
+	if receiviedSecret.Signature == nil && receiviedSecret.HasPolicy() {
+		screen.Errorf("Rejected secret: its lifecycle policy is not signed\n")
+		return
+	}
+	if receiviedSecret.Signature == nil && trusted != nil {
+		screen.Errorf("Rejected secret: it is not signed\n")
+		return
+	}
+	if receiviedSecret.Signature != nil {
+		signer, err := ws.VerifySecret(payload.ID, receiviedSecret, trusted)
+		if err != nil {
+			screen.Errorf("Rejected secret: %s\n", err)
+			return
+		}
+
+		if trusted == nil {
+			screen.Redf("Signed by an unverified key, %s\n", id.VerifyingKeyFingerprint(signer))
+		} else {
+			screen.Successf("Signature verified\n")
+		}
+	} else {
+		screen.Redf("Received secret is not signed\n")
+	}
 
 	// Print received secret details
 	screen.Printf("Received secret:\n")
@@ -147,9 +261,33 @@ func (n *TransferStreamerNode) HandleSecretReceive(s network.Stream, ws *workspa
 		screen.Printf("  Format: %s\n", receiviedSecret.Format)
 	}
 	screen.Printf("  Created: %s\n", receiviedSecret.CreatedAt.Format("2006-01-02 15:04:05"))
+	if !receiviedSecret.ExpiresAt.IsZero() {
+		screen.Printf("  Expires: %s\n", receiviedSecret.ExpiresAt.Format("2006-01-02 15:04:05"))
+	}
+	if n, ok := receiviedSecret.ReadsLeft(0); ok {
+		screen.Printf("  Reads: %d\n", n)
+	}
+
+	// the policies of the sender travel with the secret, the reads are counted anew
+	if err := receiviedSecret.CheckPolicy(0); err != nil {
+		screen.Errorf("Rejected secret: %s\n", err)
+		return
+	}
 
-	// Save the received secret to workspace with the original ID-based filename
-	secretPath := filepath.Join(ws.SecretsDir, payload.ID+".yml")
+	// Save the received secret to workspace with the original ID-based filename,
+	// never over an existing secret
+	lock, err := ws.LockWrites()
+	if err != nil {
+		screen.Errorf("Error saving secret to workspace: %s\n", err)
+		return
+	}
+	defer lock.Close()
+
+	secretPath := ws.SecretPath(payload.ID + ".yml")
+	if _, err := os.Stat(secretPath); !os.IsNotExist(err) {
+		screen.Errorf("Rejected secret: a secret with ID %s already exists\n", payload.ID)
+		return
+	}
 	if err := receiviedSecret.Save(secretPath); err != nil {
 		screen.Printf("Error saving secret to workspace: %s\n", err)
 		return
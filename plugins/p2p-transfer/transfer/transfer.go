@@ -8,6 +8,7 @@ import (
 
 	"github.com/libp2p/go-libp2p/core/network"
 	"github.com/open-zhy/secm/pkg/errors"
+	"github.com/open-zhy/secm/pkg/id"
 	"github.com/open-zhy/secm/pkg/screen"
 	"github.com/open-zhy/secm/pkg/secret"
 	"github.com/open-zhy/secm/pkg/workspace"
@@ -45,11 +46,11 @@ func RunTransfer(cmd *cobra.Command, args []string, opt *NodeOption, peerOpt *Pe
 	screen.Infof("  Addr: %s\n", ha.Addrs())
 
 	if peerOpt == nil {
-		if err := handleInitiator(ctx, ws, ha, args[0]); err != nil {
+		if err := handleInitiator(ctx, ws, ha, args[0], opt.ExpectFingerprint); err != nil {
 			return errors.Wrapf(err, "failed to mount the initiator")
 		}
 	} else {
-		if err := handleReceiverPeer(ctx, ws, ha, peerOpt.Addr); err != nil {
+		if err := handleReceiverPeer(ctx, ws, ha, peerOpt); err != nil {
 			return errors.Wrapf(err, "failed to connect receiver")
 		}
 	}
@@ -66,7 +67,7 @@ func RunTransfer(cmd *cobra.Command, args []string, opt *NodeOption, peerOpt *Pe
 	}
 }
 
-func handleInitiator(_ context.Context, ws *workspace.Workspace, ha TransfererNode, secretId string) error {
+func handleInitiator(_ context.Context, ws *workspace.Workspace, ha TransfererNode, secretId string, expected []string) error {
 	// Load the secret
 	secretPath := ws.SecretPath(secretId + ".yml")
 	sec, err := secret.Load(secretPath)
@@ -81,17 +82,26 @@ func handleInitiator(_ context.Context, ws *workspace.Workspace, ha TransfererNo
 			ID:     secretId,
 			Secret: sec,
 		}
-		ha.HandleSecretTransfer(stream, ws, payload)
+		ha.HandleSecretTransfer(stream, ws, payload, expected)
 	})
 
 	return nil
 }
 
-func handleReceiverPeer(ctx context.Context, ws *workspace.Workspace, ha ReceiverNode, peerAddr string) error {
+func handleReceiverPeer(ctx context.Context, ws *workspace.Workspace, ha ReceiverNode, peerOpt *PeerOption) error {
+	var trusted id.VerifyingKey
+	if peerOpt.Signer != "" {
+		key, err := id.LoadVerifyingKeyFile(peerOpt.Signer)
+		if err != nil {
+			return errors.Wrapf(err, "failed to load signer key")
+		}
+		trusted = key
+	}
+
 	screen.Println("Connecting to peer to receive secret...")
 
 	// initiate peer node connection - this will trigger the initiator's stream handler
-	_, err := NewReceiverPeer(ctx, ha, ws, peerAddr)
+	_, err := NewReceiverPeer(ctx, ha, ws, peerOpt.Addr, trusted)
 	if err != nil {
 		return errors.Wrapf(err, "failed to initiate peer")
 	}